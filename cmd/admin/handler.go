@@ -0,0 +1,85 @@
+package admin
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kiln-mid/cmd/xtz"
+	"github.com/kiln-mid/pkg/db"
+	"github.com/kiln-mid/pkg/delegations"
+	"github.com/kiln-mid/pkg/gaps"
+	"github.com/kiln-mid/pkg/models"
+	"github.com/kiln-mid/pkg/utilworker"
+)
+
+// Handler represent the handler of the administration endpoints, errors are answered as the problems of the `xtz` routes.
+// Supervisor is nil in a process running no worker, `/admin/workers` is then not exposed.
+type Handler struct {
+	DelegationsClient *delegations.Client
+	GapsAuditor       *gaps.Auditor
+	Supervisor        *utilworker.Supervisor
+	LeasesRepository  db.LeasesRepository
+}
+
+// RegisterRouter expose all endpoint for the `admin` group.
+func (a *Handler) RegisterRouter(router *gin.Engine) {
+	adminRouter := router.Group("/admin")
+	adminRouter.GET("/sync-state", a.getSyncStates)
+	adminRouter.GET("/gaps", a.getGaps)
+	if a.Supervisor != nil {
+		adminRouter.GET("/workers", a.getWorkers)
+	}
+	adminRouter.GET("/leases", a.getLeases)
+}
+
+// getSyncStates return the sync state of every network and source.
+func (a *Handler) getSyncStates(c *gin.Context) {
+	states, err := a.DelegationsClient.GetSyncStates(c.Request.Context())
+	if err != nil {
+		xtz.AbortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": states})
+}
+
+// getGaps return the gaps detected by the auditor.
+// If a `status` param is provided, only gaps with this status are returned.
+func (a *Handler) getGaps(c *gin.Context) {
+	var queryParams struct {
+		Status string `form:"status" binding:"omitempty,oneof=open repaired failed"`
+	}
+
+	if err := c.ShouldBindQuery(&queryParams); err != nil {
+		xtz.AbortWithProblem(c, xtz.Problem{
+			Status:        http.StatusBadRequest,
+			Detail:        "invalid parameters",
+			InvalidParams: []xtz.InvalidParam{{Name: "status", Reason: "must be one of open, repaired or failed"}},
+		})
+		return
+	}
+
+	result, err := a.GapsAuditor.GetGaps(c.Request.Context(), models.GapStatus(queryParams.Status))
+	if err != nil {
+		xtz.AbortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": result})
+}
+
+// getWorkers return the status of every worker registered in the supervisor.
+func (a *Handler) getWorkers(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"data": a.Supervisor.Status()})
+}
+
+// getLeases return the lease of every singleton worker, telling which instance leads it.
+func (a *Handler) getLeases(c *gin.Context) {
+	leases, err := a.LeasesRepository.FindAll(c.Request.Context())
+	if err != nil {
+		xtz.AbortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": leases})
+}
@@ -0,0 +1,85 @@
+package admin_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kiln-mid/cmd/admin"
+	"github.com/kiln-mid/cmd/xtz"
+	"github.com/kiln-mid/pkg/db"
+	"github.com/kiln-mid/pkg/delegations"
+	"github.com/kiln-mid/pkg/gaps"
+	"github.com/kiln-mid/pkg/models"
+	"github.com/kiln-mid/pkg/tezos"
+	"github.com/stretchr/testify/require"
+)
+
+// errDriver is a database error whose message must not reach the clients.
+var errDriver = errors.New("Error 1045 (28000): Access denied for user 'kiln'@'10.0.0.3'")
+
+type fakeSyncStateRepository struct {
+	db.SyncStateRepository
+}
+
+func (f *fakeSyncStateRepository) FindAll(ctx context.Context) ([]models.SyncState, error) {
+	return nil, errDriver
+}
+
+type fakeGapsRepository struct {
+	db.GapsRepository
+}
+
+func (f *fakeGapsRepository) FindByStatus(ctx context.Context, status models.GapStatus) ([]models.Gap, error) {
+	return nil, errDriver
+}
+
+type fakeLeasesRepository struct {
+	db.LeasesRepository
+}
+
+func (f *fakeLeasesRepository) FindAll(ctx context.Context) ([]models.Lease, error) {
+	return nil, errDriver
+}
+
+func TestHandler_Problems(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+
+	delegationsClient := delegations.NewClient(tezos.NewClient(), nil, &fakeSyncStateRepository{})
+	handler := admin.Handler{
+		DelegationsClient: delegationsClient,
+		GapsAuditor:       gaps.NewAuditor(tezos.NewClient(), delegationsClient, nil, &fakeGapsRepository{}),
+		LeasesRepository:  &fakeLeasesRepository{},
+	}
+	handler.RegisterRouter(router)
+
+	for _, tt := range []struct {
+		target string
+		status int
+		detail string
+	}{
+		{target: "/admin/sync-state", status: http.StatusInternalServerError, detail: "the request could not be processed"},
+		{target: "/admin/gaps", status: http.StatusInternalServerError, detail: "the request could not be processed"},
+		{target: "/admin/leases", status: http.StatusInternalServerError, detail: "the request could not be processed"},
+		{target: "/admin/gaps?status=closed", status: http.StatusBadRequest, detail: "invalid parameters"},
+	} {
+		t.Run(tt.target, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.target, nil))
+
+			require.Equal(t, tt.status, w.Code)
+			require.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+			require.NotContains(t, w.Body.String(), "Access denied")
+
+			var problem xtz.Problem
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+			require.Equal(t, tt.status, problem.Status)
+			require.Equal(t, tt.detail, problem.Detail)
+		})
+	}
+}
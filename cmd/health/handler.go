@@ -0,0 +1,325 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kiln-mid/pkg/db"
+	"github.com/kiln-mid/pkg/delegations"
+	"github.com/kiln-mid/pkg/utilworker"
+)
+
+// checkTimeout bound the time spent by each check of the readiness probe.
+const checkTimeout = 2 * time.Second
+
+// lagCacheTTL is the duration a measured lag is reused, so frequent probes do not hit tzkt on every call.
+const lagCacheTTL = 10 * time.Second
+
+// Statuses of a readiness check.
+const (
+	CheckOK      = "ok"
+	CheckFailed  = "failed"
+	CheckUnknown = "unknown"
+)
+
+// Database is the part of db.Client checked by the readiness probe.
+type Database interface {
+	Ping(ctx context.Context) error
+	PendingMigrations(ctx context.Context) ([]int, error)
+}
+
+// LagMeter measure the ingestion lag, see delegations.Client.Lag.
+type LagMeter interface {
+	Lag(ctx context.Context) (delegations.Lag, error)
+}
+
+// Handler represent the handler of the health endpoints.
+// MaxLag is the ingestion lag above which the instance is not ready, 0 disables the check.
+// Supervisor is nil in a process running no worker, `/status` then reports the workers from the leases and the sync states
+// stored by the instances running them, the last checkpoint of the ingestion is the last success of IngestionWorker.
+type Handler struct {
+	Database              Database
+	DelegationsRepository db.DelegationsRepository
+	LagMeter              LagMeter
+	Supervisor            *utilworker.Supervisor
+	LeasesRepository      db.LeasesRepository
+	SyncStateRepository   db.SyncStateRepository
+	IngestionWorker       string
+	MaxLag                time.Duration
+	Version               string
+
+	mu         sync.Mutex
+	lag        delegations.Lag
+	lagErr     error
+	measuredAt time.Time
+}
+
+// RegisterRouter expose the liveness, readiness and status endpoints.
+func (h *Handler) RegisterRouter(router *gin.Engine) {
+	router.GET("/healthz", h.getHealthz)
+	router.GET("/readyz", h.getReadyz)
+	router.GET("/status", h.getStatus)
+}
+
+// Messages returned instead of the errors of the dependencies, which can hold driver messages or URLs, the errors are only logged.
+const (
+	errDatabaseUnreachable = "database unreachable"
+	errMigrationsUnknown   = "migrations could not be read"
+	errLagNotMeasured      = "ingestion lag not measured"
+	errNewestUnknown       = "database unavailable"
+	errWorkersUnknown      = "workers could not be read"
+)
+
+// States of a worker read from the database by a process running no worker.
+const (
+	WorkerLeased   = "leased"
+	WorkerUnleased = "unleased"
+)
+
+// checkFailure is the failure of a check whose message is returned to the client as is.
+type checkFailure string
+
+func (f checkFailure) Error() string {
+	return string(f)
+}
+
+// Check is the outcome of a readiness check.
+type Check struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ReadyResponse represent the response of the readiness probe.
+type ReadyResponse struct {
+	Status string           `json:"status"`
+	Checks map[string]Check `json:"checks"`
+}
+
+// NewestDelegation represent the newest stored delegation.
+type NewestDelegation struct {
+	TezosID   int       `json:"tezos_id"`
+	Timestamp time.Time `json:"timestamp"`
+	Level     int       `json:"level"`
+}
+
+// WorkerStatus represent the last outcomes of a worker. The error of the last failure is only reported by its class,
+// its message can hold driver messages, URLs or a stack trace.
+type WorkerStatus struct {
+	Name           string     `json:"name"`
+	State          string     `json:"state"`
+	Holder         string     `json:"holder,omitempty"`
+	LastSuccessAt  *time.Time `json:"last_success_at"`
+	LastFailureAt  *time.Time `json:"last_failure_at"`
+	LastErrorClass string     `json:"last_error_class,omitempty"`
+}
+
+// StatusResponse represent the response of `/status`. A value which cannot be read is null and its error is in Errors.
+type StatusResponse struct {
+	Version          string            `json:"version"`
+	NewestDelegation *NewestDelegation `json:"newest_delegation"`
+	Lag              *delegations.Lag  `json:"lag"`
+	Workers          []WorkerStatus    `json:"workers,omitempty"`
+	Errors           map[string]string `json:"errors,omitempty"`
+}
+
+// getHealthz report the process is alive, it checks no dependency so a database outage does not restart the process.
+func (h *Handler) getHealthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// getReadyz report whether the instance can serve traffic: the database is reachable, the migrations are applied and the
+// ingestion lag is under MaxLag. A lag which cannot be measured, because tzkt is unavailable, does not fail the probe since
+// the stored delegations can still be served.
+func (h *Handler) getReadyz(c *gin.Context) {
+	ctx := c.Request.Context()
+	checks := map[string]Check{}
+
+	checks["database"] = h.check(ctx, "database", errDatabaseUnreachable, func(ctx context.Context) error {
+		return h.Database.Ping(ctx)
+	})
+
+	if checks["database"].Status == CheckOK {
+		checks["migrations"] = h.check(ctx, "migrations", errMigrationsUnknown, func(ctx context.Context) error {
+			pending, err := h.Database.PendingMigrations(ctx)
+			if err != nil {
+				return err
+			}
+			if len(pending) > 0 {
+				return checkFailure(fmt.Sprintf("pending migrations %v", pending))
+			}
+			return nil
+		})
+	}
+
+	if h.MaxLag > 0 && h.LagMeter != nil {
+		checks["lag"] = h.checkLag(ctx)
+	}
+
+	response := ReadyResponse{Status: "ready", Checks: checks}
+	for _, check := range checks {
+		if check.Status == CheckFailed {
+			response.Status = "not ready"
+			c.JSON(http.StatusServiceUnavailable, response)
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// checkLag compare the ingestion lag with MaxLag.
+func (h *Handler) checkLag(ctx context.Context) Check {
+	lag, err := h.measureLag(ctx)
+	if err != nil {
+		return Check{Status: CheckUnknown, Error: errLagNotMeasured}
+	}
+
+	if maxLag := h.MaxLag.Seconds(); lag.Seconds > maxLag {
+		return Check{Status: CheckFailed, Error: fmt.Sprintf("ingestion lag of %.0fs is above %.0fs", lag.Seconds, maxLag)}
+	}
+	return Check{Status: CheckOK}
+}
+
+// check run fct with a deadline of checkTimeout and return its outcome.
+// The error of a failed check is logged, the client gets failure unless the error is a checkFailure.
+func (h *Handler) check(ctx context.Context, name string, failure string, fct func(ctx context.Context) error) Check {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	err := fct(ctx)
+	if err == nil {
+		return Check{Status: CheckOK}
+	}
+
+	var f checkFailure
+	if errors.As(err, &f) {
+		return Check{Status: CheckFailed, Error: f.Error()}
+	}
+	slog.WarnContext(ctx, "readiness check failed", "check", name, "error", err)
+	return Check{Status: CheckFailed, Error: failure}
+}
+
+// measureLag return the ingestion lag, measured at most once per lagCacheTTL.
+func (h *Handler) measureLag(ctx context.Context) (delegations.Lag, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !h.measuredAt.IsZero() && time.Since(h.measuredAt) < lagCacheTTL {
+		return h.lag, h.lagErr
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	h.lag, h.lagErr = h.LagMeter.Lag(ctx)
+	h.measuredAt = time.Now()
+	if h.lagErr != nil {
+		slog.WarnContext(ctx, "ingestion lag not measured", "error", h.lagErr)
+	}
+	return h.lag, h.lagErr
+}
+
+// getStatus report the newest stored delegation, the ingestion lag, the last outcomes of the workers and the build version.
+func (h *Handler) getStatus(c *gin.Context) {
+	ctx := c.Request.Context()
+	response := StatusResponse{Version: h.Version, Errors: map[string]string{}}
+
+	newest, err := h.DelegationsRepository.FindMostRecent(ctx)
+	switch {
+	case err != nil:
+		slog.WarnContext(ctx, "newest delegation not read", "error", err)
+		response.Errors["newest_delegation"] = errNewestUnknown
+	case newest != nil && newest.TezosID != 0:
+		response.NewestDelegation = &NewestDelegation{TezosID: newest.TezosID, Timestamp: newest.Timestamp, Level: newest.Level}
+	}
+
+	if h.LagMeter != nil {
+		lag, err := h.measureLag(ctx)
+		if err != nil {
+			response.Errors["lag"] = errLagNotMeasured
+		} else {
+			response.Lag = &lag
+		}
+	}
+
+	if h.Supervisor != nil {
+		for _, s := range h.Supervisor.Status() {
+			response.Workers = append(response.Workers, WorkerStatus{
+				Name:           s.Name,
+				State:          string(s.State),
+				LastSuccessAt:  s.LastSuccessAt,
+				LastFailureAt:  s.LastFailureAt,
+				LastErrorClass: string(s.LastErrorClass),
+			})
+		}
+	} else {
+		workers, err := h.storedWorkers(ctx)
+		if err != nil {
+			slog.WarnContext(ctx, "workers not read", "error", err)
+			response.Errors["workers"] = errWorkersUnknown
+		}
+		response.Workers = workers
+	}
+
+	if len(response.Errors) == 0 {
+		response.Errors = nil
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// storedWorkers return the workers run by other processes: a worker whose lease is not expired is leased by its holder,
+// the last success of IngestionWorker is the last update of the sync state of tzkt.
+func (h *Handler) storedWorkers(ctx context.Context) ([]WorkerStatus, error) {
+	workers := []WorkerStatus{}
+	if h.LeasesRepository != nil {
+		leases, err := h.LeasesRepository.FindAll(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("leasesRepository FindAll: %w", err)
+		}
+
+		now := time.Now()
+		for _, l := range leases {
+			state := WorkerLeased
+			if !l.ExpiresAt.After(now) {
+				state = WorkerUnleased
+			}
+			workers = append(workers, WorkerStatus{Name: l.Name, State: state, Holder: l.Holder})
+		}
+	}
+
+	if h.SyncStateRepository == nil || h.IngestionWorker == "" {
+		return workers, nil
+	}
+
+	states, err := h.SyncStateRepository.FindAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("syncStateRepository FindAll: %w", err)
+	}
+
+	var checkpointedAt *time.Time
+	for _, s := range states {
+		if s.Source == delegations.SyncSource && (checkpointedAt == nil || s.UpdatedAt.After(*checkpointedAt)) {
+			updatedAt := s.UpdatedAt
+			checkpointedAt = &updatedAt
+		}
+	}
+	if checkpointedAt == nil {
+		return workers, nil
+	}
+
+	i := slices.IndexFunc(workers, func(w WorkerStatus) bool { return w.Name == h.IngestionWorker })
+	if i < 0 {
+		workers = append(workers, WorkerStatus{Name: h.IngestionWorker, State: CheckUnknown})
+		i = len(workers) - 1
+	}
+	workers[i].LastSuccessAt = checkpointedAt
+	return workers, nil
+}
@@ -0,0 +1,260 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kiln-mid/pkg/db"
+	"github.com/kiln-mid/pkg/delegations"
+	"github.com/kiln-mid/pkg/models"
+	"github.com/kiln-mid/pkg/utilworker"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeDatabase struct {
+	pingErr    error
+	pending    []int
+	pendingErr error
+}
+
+func (f fakeDatabase) Ping(ctx context.Context) error {
+	return f.pingErr
+}
+
+func (f fakeDatabase) PendingMigrations(ctx context.Context) ([]int, error) {
+	return f.pending, f.pendingErr
+}
+
+type fakeLagMeter struct {
+	lag   delegations.Lag
+	err   error
+	calls int
+}
+
+func (f *fakeLagMeter) Lag(ctx context.Context) (delegations.Lag, error) {
+	f.calls++
+	return f.lag, f.err
+}
+
+type fakeDelegationsRepository struct {
+	db.DelegationsRepository
+	newest *models.Delegations
+	err    error
+}
+
+func (f fakeDelegationsRepository) FindMostRecent(ctx context.Context) (*models.Delegations, error) {
+	return f.newest, f.err
+}
+
+type fakeLeasesRepository struct {
+	db.LeasesRepository
+	leases []models.Lease
+	err    error
+}
+
+func (f fakeLeasesRepository) FindAll(ctx context.Context) ([]models.Lease, error) {
+	return f.leases, f.err
+}
+
+type fakeSyncStateRepository struct {
+	db.SyncStateRepository
+	states []models.SyncState
+}
+
+func (f fakeSyncStateRepository) FindAll(ctx context.Context) ([]models.SyncState, error) {
+	return f.states, nil
+}
+
+func serve(t *testing.T, h *Handler, path string) (int, map[string]any) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	h.RegisterRouter(router)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+
+	var body map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	return w.Code, body
+}
+
+func TestHandler_Readyz(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		database fakeDatabase
+		lag      fakeLagMeter
+		code     int
+		failed   string
+		message  string
+	}{
+		{name: "ready", lag: fakeLagMeter{lag: delegations.Lag{Seconds: 30}}, code: http.StatusOK},
+		{
+			name:     "database down",
+			database: fakeDatabase{pingErr: errors.New("dial tcp 10.0.0.1:3306: connection refused")},
+			code:     http.StatusServiceUnavailable,
+			failed:   "database",
+			message:  "database unreachable",
+		},
+		{name: "pending migrations", database: fakeDatabase{pending: []int{2}}, code: http.StatusServiceUnavailable, failed: "migrations", message: "pending migrations [2]"},
+		{
+			name:     "migrations not readable",
+			database: fakeDatabase{pendingErr: errors.New("gorm error: Error 1142: SELECT command denied to user 'kiln'")},
+			code:     http.StatusServiceUnavailable,
+			failed:   "migrations",
+			message:  "migrations could not be read",
+		},
+		{name: "lagging", lag: fakeLagMeter{lag: delegations.Lag{Seconds: 3600}}, code: http.StatusServiceUnavailable, failed: "lag", message: "ingestion lag of 3600s is above 900s"},
+		{name: "tzkt unavailable", lag: fakeLagMeter{err: errors.New("tzkt unavailable")}, code: http.StatusOK},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Handler{Database: tt.database, LagMeter: &tt.lag, MaxLag: 15 * time.Minute}
+
+			code, body := serve(t, h, "/readyz")
+			require.Equal(t, tt.code, code)
+			if tt.failed != "" {
+				checks := body["checks"].(map[string]any)
+				require.Equal(t, CheckFailed, checks[tt.failed].(map[string]any)["status"])
+				require.Equal(t, tt.message, checks[tt.failed].(map[string]any)["error"])
+			}
+		})
+	}
+}
+
+func TestHandler_LagCache(t *testing.T) {
+	lag := &fakeLagMeter{lag: delegations.Lag{Seconds: 1}}
+	h := &Handler{Database: fakeDatabase{}, LagMeter: lag, MaxLag: time.Minute}
+
+	serve(t, h, "/readyz")
+	serve(t, h, "/readyz")
+	require.Equal(t, 1, lag.calls)
+}
+
+func TestHandler_Status(t *testing.T) {
+	timestamp := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	h := &Handler{
+		DelegationsRepository: fakeDelegationsRepository{newest: &models.Delegations{TezosID: 42, Level: 100, Timestamp: timestamp}},
+		LagMeter:              &fakeLagMeter{lag: delegations.Lag{HeadLevel: 110, NewestLevel: 100, Levels: 10, Seconds: 60}},
+		Version:               "v1.2.3",
+	}
+
+	code, body := serve(t, h, "/status")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "v1.2.3", body["version"])
+	require.Equal(t, float64(100), body["newest_delegation"].(map[string]any)["level"])
+	require.Equal(t, "2024-01-01T10:00:00Z", body["newest_delegation"].(map[string]any)["timestamp"])
+	require.Equal(t, float64(10), body["lag"].(map[string]any)["levels"])
+	require.Nil(t, body["errors"])
+
+	code, body = serve(t, h, "/healthz")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "ok", body["status"])
+}
+
+func TestHandler_StatusErrors(t *testing.T) {
+	h := &Handler{
+		DelegationsRepository: fakeDelegationsRepository{err: errors.New("gorm error: driver: bad connection")},
+		LagMeter:              &fakeLagMeter{err: errors.New("delegationsRepository FindMostRecent: fetcher: Get \"https://tzkt.internal/v1/head\": timeout")},
+	}
+
+	code, body := serve(t, h, "/status")
+	require.Equal(t, http.StatusOK, code)
+	require.Nil(t, body["newest_delegation"])
+	require.Nil(t, body["lag"])
+
+	// The errors of the dependencies are logged, not returned.
+	require.Equal(t, map[string]any{
+		"newest_delegation": "database unavailable",
+		"lag":               "ingestion lag not measured",
+	}, body["errors"])
+}
+
+func TestHandler_StatusSupervisedWorkers(t *testing.T) {
+	supervisor := utilworker.NewSupervisor()
+	require.NoError(t, supervisor.Register("worker-panicking", func(ctx context.Context) error {
+		panic("connect to user:secret@tcp(db:3306)")
+	}, utilworker.Options{Interval: time.Millisecond, Backoff: utilworker.Backoff{Initial: time.Hour}}))
+	supervisor.Start(context.Background())
+	defer supervisor.Shutdown(context.Background())
+
+	require.Eventually(t, func() bool {
+		return supervisor.Status()[0].LastFailureAt != nil
+	}, time.Second, time.Millisecond)
+
+	h := &Handler{DelegationsRepository: fakeDelegationsRepository{}, Supervisor: supervisor}
+	code, body := serve(t, h, "/status")
+	require.Equal(t, http.StatusOK, code)
+
+	workers := body["workers"].([]any)
+	require.Len(t, workers, 1)
+	worker := workers[0].(map[string]any)
+	require.Equal(t, "worker-panicking", worker["name"])
+	require.Equal(t, "panic", worker["last_error_class"])
+	require.NotNil(t, worker["last_failure_at"])
+
+	// Neither the panic value nor the stack trace is returned.
+	raw, err := json.Marshal(body)
+	require.NoError(t, err)
+	require.NotContains(t, string(raw), "secret")
+	require.NotContains(t, string(raw), "goroutine")
+}
+
+func TestHandler_StatusStoredWorkers(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	checkpointedAt := now.Add(-time.Minute)
+
+	h := &Handler{
+		DelegationsRepository: fakeDelegationsRepository{},
+		LeasesRepository: fakeLeasesRepository{leases: []models.Lease{
+			{Name: "worker-delegations", Holder: "ingest-1", ExpiresAt: now.Add(time.Minute)},
+			{Name: "worker-gaps", Holder: "ingest-2", ExpiresAt: now.Add(-time.Minute)},
+		}},
+		SyncStateRepository: fakeSyncStateRepository{states: []models.SyncState{
+			{Network: "ghostnet", Source: delegations.SyncSource, UpdatedAt: checkpointedAt.Add(-time.Hour)},
+			{Network: "mainnet", Source: delegations.SyncSource, UpdatedAt: checkpointedAt},
+		}},
+		IngestionWorker: "worker-delegations",
+	}
+
+	code, body := serve(t, h, "/status")
+	require.Equal(t, http.StatusOK, code)
+	require.Nil(t, body["errors"])
+	require.Equal(t, []any{
+		map[string]any{
+			"name":            "worker-delegations",
+			"state":           WorkerLeased,
+			"holder":          "ingest-1",
+			"last_success_at": checkpointedAt.Format(time.RFC3339),
+			"last_failure_at": nil,
+		},
+		map[string]any{
+			"name":            "worker-gaps",
+			"state":           WorkerUnleased,
+			"holder":          "ingest-2",
+			"last_success_at": nil,
+			"last_failure_at": nil,
+		},
+	}, body["workers"])
+
+	// Without leases, the ingestion is still reported from its sync state.
+	h.LeasesRepository = fakeLeasesRepository{}
+	_, body = serve(t, h, "/status")
+	require.Equal(t, []any{
+		map[string]any{
+			"name":            "worker-delegations",
+			"state":           CheckUnknown,
+			"last_success_at": checkpointedAt.Format(time.RFC3339),
+			"last_failure_at": nil,
+		},
+	}, body["workers"])
+
+	h.LeasesRepository = fakeLeasesRepository{err: errors.New("Error 1146 (42S02): Table 'db.leases' doesn't exist")}
+	_, body = serve(t, h, "/status")
+	require.Nil(t, body["workers"])
+	require.Equal(t, map[string]any{"workers": "workers could not be read"}, body["errors"])
+}
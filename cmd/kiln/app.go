@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/kiln-mid/pkg/db"
+	"github.com/kiln-mid/pkg/delegations"
+	"github.com/kiln-mid/pkg/gaps"
+	"github.com/kiln-mid/pkg/retention"
+	"github.com/kiln-mid/pkg/tezos"
+	"github.com/kiln-mid/pkg/utilconfig"
+	"github.com/kiln-mid/pkg/utilhttp"
+	"github.com/kiln-mid/pkg/utillog"
+	"github.com/kiln-mid/pkg/utilmetrics"
+	"github.com/kiln-mid/pkg/utiltrace"
+	"golang.org/x/time/rate"
+)
+
+// app hold the configuration, the clients and the repositories shared by every command, built by newApp.
+type app struct {
+	config                utilconfig.Config
+	logger                *slog.Logger
+	metrics               *utilmetrics.Metrics
+	shutdownTracing       func(context.Context) error
+	dbClient              db.Client
+	tezosClient           *tezos.Client
+	delegationsRepository db.DelegationsRepository
+	syncStateRepository   db.SyncStateRepository
+	leasesRepository      db.LeasesRepository
+	delegationsClient     *delegations.Client
+	retentionClient       *retention.Client
+	gapsAuditor           *gaps.Auditor
+
+	// waitWorkers, when set, wait for the worker runs using the database, Close leaves the database open while they run.
+	waitWorkers func(ctx context.Context) error
+}
+
+const (
+	// tracingShutdownTimeout bound the time spent flushing the spans in flight when a command exits.
+	tracingShutdownTimeout = 5 * time.Second
+	// abandonedRunsTimeout bound the time given to the worker runs canceled at the shutdown deadline to return before the
+	// database is closed.
+	abandonedRunsTimeout = 5 * time.Second
+)
+
+// newFlagSet return the flag set of a command with the configuration flags registered, and the loader reading them.
+func newFlagSet(name string) (*flag.FlagSet, *utilconfig.Loader) {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	loader := &utilconfig.Loader{}
+	loader.RegisterFlags(flags)
+	return flags, loader
+}
+
+// newApp load the configuration, connect to the database and wire the clients.
+func newApp(loader *utilconfig.Loader) (*app, error) {
+	config, err := loader.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	// The packages log with the default logger, so the fields carried by their contexts are written in the configured format.
+	logger, err := utillog.New(os.Stderr, config.Log.Format, config.Log.Level)
+	if err != nil {
+		return nil, err
+	}
+	slog.SetDefault(logger)
+
+	shutdownTracing, err := utiltrace.Setup(context.Background(), utiltrace.Options{
+		Exporter:    config.Tracing.Exporter,
+		Endpoint:    config.Tracing.Endpoint,
+		SampleRatio: config.Tracing.SampleRatio,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	dbClient, err := db.CreateClient(config.DB.DSN, config.DB.ReplicaDSNs...)
+	if err != nil {
+		return nil, err
+	}
+
+	metrics := utilmetrics.New()
+	if err := dbClient.Use(metrics.GormPlugin()); err != nil {
+		return nil, fmt.Errorf("metrics plugin: %w", err)
+	}
+	if err := dbClient.Use(utiltrace.GormPlugin()); err != nil {
+		return nil, fmt.Errorf("tracing plugin: %w", err)
+	}
+
+	dbClient.Replicas.MaxLag = config.DB.MaxReplicationLag
+	dbClient.Bulk = db.BulkOptions{BatchSize: config.DB.BatchSize, LoadData: config.DB.LoadData}
+
+	a := &app{
+		config:                config,
+		logger:                logger,
+		metrics:               metrics,
+		shutdownTracing:       shutdownTracing,
+		dbClient:              dbClient,
+		tezosClient:           tezos.NewClient(),
+		delegationsRepository: db.NewClientDelegationsAdapter(dbClient),
+	}
+
+	a.tezosClient.BaseUrl = config.Tezos.BaseURL
+	a.tezosClient.Network = config.Tezos.Network
+	a.tezosClient.HTTP = metrics.InstrumentClient(utilhttp.NewClient(config.Tezos.Timeout))
+
+	// Every request to tzkt goes through a single limiter, parallel backfill workers and the ingestion workers share its rate.
+	// The limiter wraps the instrumented client so the recorded latency is the one of tzkt, without the wait for the limiter.
+	if rateLimit := config.Tezos.RateLimit; rateLimit > 0 {
+		a.tezosClient.HTTP = utilhttp.NewRateLimitedClient(a.tezosClient.HTTP, rate.NewLimiter(rate.Limit(rateLimit), max(1, int(rateLimit))))
+	}
+	// The span of a tzkt call includes the wait for the limiter, which is part of the latency seen by the caller.
+	a.tezosClient.HTTP = utiltrace.InstrumentClient(a.tezosClient.HTTP)
+
+	a.retentionClient = retention.NewClient(db.NewPartitionsAdapter(dbClient.DB), retention.Policy{
+		Months:      config.Retention.Months,
+		MonthsAhead: config.Retention.MonthsAhead,
+		Mode:        retention.Mode(config.Retention.Mode),
+	})
+
+	a.syncStateRepository = db.NewSyncStateAdapter(dbClient.DB)
+	a.delegationsClient = delegations.NewClient(a.tezosClient, a.delegationsRepository, a.syncStateRepository)
+	a.delegationsClient.SetRetention(a.retentionClient)
+	a.delegationsClient.SetCountLimit(config.HTTP.CountLimit)
+	a.delegationsClient.SetObserver(metrics)
+
+	a.gapsAuditor = gaps.NewAuditor(a.tezosClient, a.delegationsClient, a.delegationsRepository, db.NewGapsAdapter(dbClient.DB))
+	a.gapsAuditor.LookbackDays = config.Workers.GapsLookbackDays
+
+	holder := config.Leader.Holder
+	if holder == "" {
+		holder = db.DefaultLeaseHolder()
+	}
+	a.leasesRepository = db.NewLeasesAdapter(dbClient.DB, holder, config.Leader.TTL)
+
+	return a, nil
+}
+
+// Close flush the spans in flight and close the database connections.
+// The database is left open, to be released by the exit of the process, while worker runs abandoned at the shutdown deadline still use it.
+func (a *app) Close() error {
+	if a.waitWorkers != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), abandonedRunsTimeout)
+		err := a.waitWorkers(ctx)
+		cancel()
+		if err != nil {
+			slog.Warn("database left open, worker runs abandoned at the shutdown deadline are still running", "error", err)
+			return a.closeTracing()
+		}
+	}
+
+	return errors.Join(a.closeTracing(), a.dbClient.Close())
+}
+
+// closeTracing flush the spans in flight.
+func (a *app) closeTracing() error {
+	ctx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+	defer cancel()
+
+	return a.shutdownTracing(ctx)
+}
+
+// newRouter return a gin engine recovering from panics, giving every request an id, logging it with the app logger, tracing it
+// and recording it in the metrics served at `/metrics`.
+func (a *app) newRouter() *gin.Engine {
+	r := gin.New()
+	r.Use(utillog.Middleware(a.logger), utiltrace.Middleware(), a.metrics.Middleware(), gin.Recovery())
+	r.GET("/metrics", gin.WrapH(a.metrics.Handler()))
+	return r
+}
+
+// listenAndServe serve handler on port until ctx is done, then wait up to shutdownTimeout for the requests in flight.
+// onShutdown is called once ctx is done, with its own shutdownTimeout, while the server drains the requests in flight. It can be nil.
+func listenAndServe(ctx context.Context, port int, shutdownTimeout time.Duration, handler http.Handler, onShutdown func(ctx context.Context)) error {
+	server := &http.Server{
+		Addr:    ":" + strconv.Itoa(port),
+		Handler: handler,
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.InfoContext(ctx, "shutting down, waiting for in-flight requests and worker runs")
+
+	// The server stops accepting connections first, the requests in flight and onShutdown each get the whole shutdownTimeout.
+	shutdownErr := make(chan error, 1)
+	go func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		shutdownErr <- server.Shutdown(shutdownCtx)
+	}()
+
+	if onShutdown != nil {
+		onShutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		onShutdown(onShutdownCtx)
+		cancel()
+	}
+
+	if err := <-shutdownErr; err != nil {
+		return fmt.Errorf("server shutdown: %w", err)
+	}
+
+	if err := <-errc; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// timeFormats are the formats accepted by parseTime.
+var timeFormats = []string{time.RFC3339, "2006-01-02T15:04:05", time.DateOnly}
+
+// parseTime parse a date or a date time in UTC, as accepted by the --from and --to flags.
+func parseTime(value string) (time.Time, error) {
+	for _, format := range timeFormats {
+		if t, err := time.ParseInLocation(format, value, time.UTC); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, expected YYYY-MM-DD or RFC 3339", value)
+}
+
+// parseRange parse the --from and --to flags, from must be before to.
+func parseRange(from string, to string) (time.Time, time.Time, error) {
+	if from == "" || to == "" {
+		return time.Time{}, time.Time{}, errors.New("--from and --to are required")
+	}
+
+	fromTime, err := parseTime(from)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("--from: %w", err)
+	}
+
+	toTime, err := parseTime(to)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("--to: %w", err)
+	}
+
+	if !fromTime.Before(toTime) {
+		return time.Time{}, time.Time{}, fmt.Errorf("--from %s must be before --to %s", from, to)
+	}
+	return fromTime, toTime, nil
+}
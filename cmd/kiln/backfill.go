@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/kiln-mid/pkg/backfill"
+	"github.com/kiln-mid/pkg/db"
+)
+
+// runBackfill fetch the delegations between --from included and --to excluded from tzkt and store them.
+// The range is split into chunks fetched by --workers in parallel, running the same command again resumes an interrupted backfill.
+func runBackfill(ctx context.Context, args []string) error {
+	flags, loader := newFlagSet("backfill")
+	from := flags.String("from", "", "start of the range, included, as YYYY-MM-DD, RFC 3339 or a level")
+	to := flags.String("to", "", "end of the range, excluded, as YYYY-MM-DD, RFC 3339 or a level")
+	workers := flags.Int("workers", backfill.DefaultWorkers, "number of chunks fetched in parallel")
+	chunkDuration := flags.Duration("chunk", backfill.DefaultChunkDuration, "duration of the chunks of a time range")
+	chunkLevels := flags.Int("chunk-levels", backfill.DefaultChunkLevels, "number of levels of the chunks of a level range")
+	pageSize := flags.Int("page-size", backfill.DefaultPageSize, "number of delegations fetched per request")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	r, err := parseBackfillRange(*from, *to)
+	if err != nil {
+		return err
+	}
+
+	a, err := newApp(loader)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+
+	backfiller := backfill.NewBackfiller(a.delegationsClient, db.NewBackfillAdapter(a.dbClient.DB), backfill.Options{
+		Workers:       *workers,
+		ChunkDuration: *chunkDuration,
+		ChunkLevels:   *chunkLevels,
+		PageSize:      *pageSize,
+		Progress:      os.Stderr,
+	})
+
+	report, err := backfiller.Run(ctx, r)
+	if err != nil {
+		return fmt.Errorf("backfill %s: %w", report.Job, err)
+	}
+
+	fmt.Fprintf(stdout, "Backfill %s completed: %d chunks, %d already done, %d delegations created\n", report.Job, report.Chunks, report.Resumed, report.Created)
+	return nil
+}
+
+// parseBackfillRange parse the --from and --to flags, both are levels when they are integers, times otherwise.
+func parseBackfillRange(from string, to string) (backfill.Range, error) {
+	fromLevel, fromErr := strconv.Atoi(from)
+	toLevel, toErr := strconv.Atoi(to)
+	if fromErr == nil && toErr == nil {
+		return backfill.Range{FromLevel: fromLevel, ToLevel: toLevel}, nil
+	}
+
+	fromTime, toTime, err := parseRange(from, to)
+	if err != nil {
+		return backfill.Range{}, err
+	}
+	return backfill.Range{From: fromTime, To: toTime}, nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// runConfig run `config print`, which write the effective configuration as YAML with the database passwords redacted.
+func runConfig(ctx context.Context, args []string) error {
+	if len(args) == 0 || args[0] != "print" {
+		return errors.New("usage: kiln config print [flags]")
+	}
+
+	flags, loader := newFlagSet("config print")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	config, err := loader.Load()
+	if err != nil {
+		return err
+	}
+
+	if err := config.Print(stdout); err != nil {
+		return fmt.Errorf("print: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/kiln-mid/pkg/models"
+)
+
+// exportPageSize is the number of delegations read per query by the export.
+const exportPageSize = 5000
+
+// runExport write the delegations stored between --from included and --to excluded, ordered by id, as CSV or JSON lines.
+func runExport(ctx context.Context, args []string) error {
+	flags, loader := newFlagSet("export")
+	from := flags.String("from", "", "start of the range, included, as YYYY-MM-DD or RFC 3339")
+	to := flags.String("to", "", "end of the range, excluded, as YYYY-MM-DD or RFC 3339")
+	format := flags.String("format", "csv", "output format, csv or json")
+	output := flags.String("output", "", "file written, the standard output when empty")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	fromTime, toTime, err := parseRange(*from, *to)
+	if err != nil {
+		return err
+	}
+
+	var write func(w io.Writer, d []models.Delegations, header bool) error
+	switch *format {
+	case "csv":
+		write = writeCSV
+	case "json":
+		write = writeJSONLines
+	default:
+		return fmt.Errorf("--format %q: expected csv or json", *format)
+	}
+
+	a, err := newApp(loader)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+
+	var out io.Writer = stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	w := bufio.NewWriter(out)
+
+	var afterID uint
+	var exported int
+	for {
+		delegations, err := a.delegationsRepository.FindAfterID(ctx, fromTime, toTime, afterID, exportPageSize)
+		if err != nil {
+			return err
+		}
+
+		if len(*delegations) == 0 {
+			break
+		}
+
+		if err := write(w, *delegations, exported == 0); err != nil {
+			return err
+		}
+
+		exported += len(*delegations)
+		afterID = (*delegations)[len(*delegations)-1].ID
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Exported %d delegations\n", exported)
+	return nil
+}
+
+// writeCSV write delegations as CSV rows, preceded by a header row when header is true.
+func writeCSV(w io.Writer, d []models.Delegations, header bool) error {
+	cw := csv.NewWriter(w)
+	if header {
+		if err := cw.Write([]string{"id", "tezos_id", "timestamp", "amount", "delegator", "level"}); err != nil {
+			return err
+		}
+	}
+
+	for _, delegation := range d {
+		err := cw.Write([]string{
+			strconv.FormatUint(uint64(delegation.ID), 10),
+			strconv.Itoa(delegation.TezosID),
+			delegation.Timestamp.UTC().Format(time.RFC3339),
+			strconv.Itoa(delegation.Amount),
+			delegation.Delegator,
+			strconv.Itoa(delegation.Level),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeJSONLines write delegations as one JSON object per line.
+func writeJSONLines(w io.Writer, d []models.Delegations, _ bool) error {
+	encoder := json.NewEncoder(w)
+	for _, delegation := range d {
+		if err := encoder.Encode(delegation); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/kiln-mid/cmd/admin"
+	"github.com/kiln-mid/cmd/health"
+	"github.com/kiln-mid/pkg/utilworker"
+)
+
+// delegationsWorker is the name of the worker ingesting new delegations, `/status` of `serve` reports its last checkpoint.
+const delegationsWorker = "worker-delegations"
+
+// runIngest run the ingestion, partitions and gaps workers until the process is stopped.
+// The administration endpoints are served on the ingest port so the workers can be supervised.
+func runIngest(ctx context.Context, args []string) error {
+	flags, loader := newFlagSet("ingest")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	a, err := newApp(loader)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+
+	workers := a.config.Workers
+
+	location, err := workers.ScheduleLocation()
+	if err != nil {
+		return fmt.Errorf("SCHEDULE_TIMEZONE: %w", err)
+	}
+
+	partitionsSchedule, err := utilworker.ParseSchedule(workers.PartitionsSchedule, location)
+	if err != nil {
+		return fmt.Errorf("PARTITIONS_SCHEDULE: %w", err)
+	}
+
+	gapsSchedule, err := utilworker.ParseSchedule(workers.GapsSchedule, location)
+	if err != nil {
+		return fmt.Errorf("GAPS_SCHEDULE: %w", err)
+	}
+
+	// Every worker is a singleton, only the instance holding the lease of a worker runs it.
+	var elector utilworker.Elector
+	if a.config.Leader.Enabled {
+		elector = a.leasesRepository
+	}
+	heartbeat := a.config.Leader.TTL / 3
+
+	supervisor := utilworker.NewSupervisor()
+	a.waitWorkers = supervisor.Wait
+
+	err = supervisor.Register(delegationsWorker, func(ctx context.Context) error {
+		delegations, last, err := a.delegationsClient.PollNew(ctx)
+		if err != nil {
+			return err
+		}
+
+		if _, err := a.delegationsClient.CreateAndCheckpoint(ctx, delegations, last); err != nil {
+			return err
+		}
+
+		// The lag is only measured for the metrics, failing to measure it does not fail the ingestion.
+		if _, err := a.delegationsClient.Lag(ctx); err != nil {
+			slog.WarnContext(ctx, "ingestion lag not measured", "error", err)
+		}
+
+		return nil
+	}, utilworker.Options{
+		Interval:  workers.DelegationsInterval,
+		Timeout:   workers.DelegationsTimeout,
+		Elector:   elector,
+		Heartbeat: heartbeat,
+		Observer:  a.metrics,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = supervisor.Register("worker-partitions", func(ctx context.Context) error {
+		report, err := a.retentionClient.Run(ctx)
+		if err != nil {
+			return err
+		}
+
+		slog.InfoContext(ctx, "partitions managed", "created", report.Created, "expired", report.Expired)
+
+		return nil
+	}, utilworker.Options{
+		Schedule:  partitionsSchedule,
+		Jitter:    5 * time.Minute,
+		CatchUp:   utilworker.CatchUpOnce,
+		Timeout:   workers.PartitionsTimeout,
+		Elector:   elector,
+		Heartbeat: heartbeat,
+		Observer:  a.metrics,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = supervisor.Register("worker-gaps", a.gapsAuditor.Run, utilworker.Options{
+		Schedule:  gapsSchedule,
+		Timeout:   workers.GapsTimeout,
+		Elector:   elector,
+		Heartbeat: heartbeat,
+		Observer:  a.metrics,
+	})
+	if err != nil {
+		return err
+	}
+
+	r := a.newRouter()
+
+	ad := admin.Handler{
+		DelegationsClient: a.delegationsClient,
+		GapsAuditor:       a.gapsAuditor,
+		Supervisor:        supervisor,
+		LeasesRepository:  a.leasesRepository,
+	}
+
+	ad.RegisterRouter(r)
+
+	h := health.Handler{
+		Database:              a.dbClient,
+		DelegationsRepository: a.delegationsRepository,
+		LagMeter:              a.delegationsClient,
+		Supervisor:            supervisor,
+		MaxLag:                a.config.HTTP.ReadyMaxLag,
+		Version:               buildVersion(),
+	}
+
+	h.RegisterRouter(r)
+
+	supervisor.Start(context.Background())
+
+	return listenAndServe(ctx, a.config.HTTP.IngestPort, a.config.HTTP.ShutdownTimeout, r, func(ctx context.Context) {
+		if err := supervisor.Shutdown(ctx); err != nil {
+			slog.ErrorContext(ctx, "supervisor shutdown failed", "error", err)
+		}
+	})
+}
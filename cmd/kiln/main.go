@@ -0,0 +1,100 @@
+// Command kiln serve the delegations API, ingest delegations from tzkt and run the maintenance tasks.
+//
+// Usage:
+//
+//	kiln <command> [flags]
+//
+// Run `kiln help` for the list of commands.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	// The time zones of SCHEDULE_TIMEZONE are embedded, the image running kiln may lack a zoneinfo database.
+	_ "time/tzdata"
+)
+
+// command is a kiln subcommand, run receives the arguments following the command name.
+type command struct {
+	name  string
+	usage string
+	run   func(ctx context.Context, args []string) error
+}
+
+// commands is the list of kiln subcommands, in the order they are printed by `kiln help`.
+var commands = []command{
+	{name: "serve", usage: "serve the delegations API and the administration endpoints", run: runServe},
+	{name: "ingest", usage: "run the ingestion and maintenance workers", run: runIngest},
+	{name: "backfill", usage: "fetch and store the delegations of a time range, --from and --to", run: runBackfill},
+	{name: "migrate", usage: "apply the pending database migrations", run: runMigrate},
+	{name: "verify", usage: "compare the delegations stored per day with tzkt, --from and --to", run: runVerify},
+	{name: "export", usage: "write the delegations of a time range as CSV or JSON lines, --from and --to", run: runExport},
+	{name: "partitions", usage: "`manage` apply the partitioning and retention policy once, `list` print the partitions", run: runPartitions},
+	{name: "config", usage: "`print` print the effective configuration with secrets redacted", run: runConfig},
+	{name: "sync", usage: "`list` print the sync states, `set` overwrite the sync state of a network", run: runSync},
+}
+
+// stdout and stderr are the writers the commands print to, the tests replace them.
+var (
+	stdout io.Writer = os.Stdout
+	stderr io.Writer = os.Stderr
+)
+
+func main() {
+	os.Exit(run(commands, os.Args[1:]))
+}
+
+// run dispatch args to the command of cmds they name and return the exit code of the process.
+func run(cmds []command, args []string) int {
+	if len(args) == 0 {
+		printUsage(cmds)
+		return 2
+	}
+
+	name, args := args[0], args[1:]
+	if name == "help" || name == "-h" || name == "--help" {
+		printUsage(cmds)
+		return 0
+	}
+
+	for _, cmd := range cmds {
+		if cmd.name != name {
+			continue
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		err := cmd.run(ctx, args)
+		stop()
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "kiln %s: %s\n", name, err)
+			return 1
+		}
+		return 0
+	}
+
+	fmt.Fprintf(stderr, "kiln: unknown command %q\n\n", name)
+	printUsage(cmds)
+	return 2
+}
+
+// printUsage print the list of commands.
+func printUsage(cmds []command) {
+	fmt.Fprintln(stderr, "Usage: kiln <command> [flags]")
+	fmt.Fprintln(stderr)
+	fmt.Fprintln(stderr, "Commands:")
+	for _, cmd := range cmds {
+		fmt.Fprintf(stderr, "  %-12s %s\n", cmd.name, cmd.usage)
+	}
+	fmt.Fprintln(stderr)
+	fmt.Fprintln(stderr, "Run `kiln <command> -h` for the flags of a command.")
+}
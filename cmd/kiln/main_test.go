@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// captureOutput replace stdout and stderr with buffers until the end of the test.
+func captureOutput(t *testing.T) (*bytes.Buffer, *bytes.Buffer) {
+	out, errOut := &bytes.Buffer{}, &bytes.Buffer{}
+	previousOut, previousErr := stdout, stderr
+	stdout, stderr = out, errOut
+	t.Cleanup(func() {
+		stdout, stderr = previousOut, previousErr
+	})
+	return out, errOut
+}
+
+func TestRun_Dispatch(t *testing.T) {
+	var called string
+	var calledArgs []string
+	record := func(name string, err error) func(ctx context.Context, args []string) error {
+		return func(ctx context.Context, args []string) error {
+			called, calledArgs = name, args
+			return err
+		}
+	}
+	cmds := []command{
+		{name: "first", usage: "first command", run: record("first", nil)},
+		{name: "failing", usage: "failing command", run: record("failing", errors.New("boom"))},
+		{name: "help-flag", usage: "command asked for its flags", run: record("help-flag", flag.ErrHelp)},
+	}
+
+	for _, tt := range []struct {
+		name   string
+		args   []string
+		code   int
+		called string
+		with   []string
+		stderr []string
+	}{
+		{name: "no command", code: 2, stderr: []string{"Usage: kiln <command> [flags]", "first", "failing"}},
+		{name: "help", args: []string{"help"}, code: 0, stderr: []string{"Usage: kiln <command> [flags]"}},
+		{name: "-h", args: []string{"-h"}, code: 0, stderr: []string{"Usage: kiln <command> [flags]"}},
+		{name: "--help", args: []string{"--help"}, code: 0, stderr: []string{"Usage: kiln <command> [flags]"}},
+		{name: "command", args: []string{"first", "--flag", "value"}, code: 0, called: "first", with: []string{"--flag", "value"}},
+		{name: "command without arguments", args: []string{"first"}, code: 0, called: "first", with: []string{}},
+		{name: "command failure", args: []string{"failing"}, code: 1, called: "failing", with: []string{}, stderr: []string{"kiln failing: boom"}},
+		{name: "command help", args: []string{"help-flag", "-h"}, code: 0, called: "help-flag", with: []string{"-h"}},
+		{name: "unknown command", args: []string{"unknown"}, code: 2, stderr: []string{`kiln: unknown command "unknown"`, "Usage: kiln <command> [flags]"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, errOut := captureOutput(t)
+			called, calledArgs = "", nil
+
+			require.Equal(t, tt.code, run(cmds, tt.args))
+			require.Equal(t, tt.called, called)
+			if tt.called != "" {
+				require.Equal(t, tt.with, calledArgs)
+			}
+			for _, s := range tt.stderr {
+				require.Contains(t, errOut.String(), s)
+			}
+			if len(tt.stderr) == 0 {
+				require.Empty(t, errOut.String())
+			}
+		})
+	}
+}
+
+func TestRun_Usage(t *testing.T) {
+	_, errOut := captureOutput(t)
+
+	require.Equal(t, 0, run(commands, []string{"help"}))
+	for _, cmd := range commands {
+		require.Contains(t, errOut.String(), "  "+cmd.name+" ")
+	}
+}
+
+func TestRun_Flags(t *testing.T) {
+	t.Setenv("MYSQL_DSN", "")
+
+	// Every case fails, or succeeds, before connecting to the database.
+	for _, tt := range []struct {
+		name   string
+		args   []string
+		code   int
+		stdout string
+		stderr string
+	}{
+		{name: "serve unknown flag", args: []string{"serve", "--unknown"}, code: 1, stderr: "flag provided but not defined: -unknown"},
+		{name: "serve help", args: []string{"serve", "-h"}, code: 0, stderr: "Usage of serve:"},
+		{name: "ingest unknown flag", args: []string{"ingest", "--unknown"}, code: 1, stderr: "kiln ingest: flag provided but not defined: -unknown"},
+		{name: "ingest help", args: []string{"ingest", "-h"}, code: 0, stderr: "-db-dsn"},
+		{name: "backfill without range", args: []string{"backfill"}, code: 1, stderr: "kiln backfill: --from and --to are required"},
+		{name: "backfill invalid workers", args: []string{"backfill", "--workers", "many"}, code: 1, stderr: `invalid value "many" for flag -workers`},
+		{name: "backfill invalid range", args: []string{"backfill", "--from", "2024-01-02", "--to", "2024-01-01"}, code: 1, stderr: "--from 2024-01-02 must be before --to 2024-01-01"},
+		{name: "migrate unknown flag", args: []string{"migrate", "--unknown"}, code: 1, stderr: "kiln migrate: flag provided but not defined: -unknown"},
+		{name: "verify without range", args: []string{"verify", "--repair"}, code: 1, stderr: "kiln verify: --from and --to are required"},
+		{name: "verify invalid bucket", args: []string{"verify", "--bucket", "daily"}, code: 1, stderr: `invalid value "daily" for flag -bucket`},
+		{name: "export invalid format", args: []string{"export", "--from", "2024-01-01", "--to", "2024-01-02", "--format", "xml"}, code: 1, stderr: `kiln export: --format "xml": expected csv or json`},
+		{name: "export invalid time", args: []string{"export", "--from", "yesterday", "--to", "2024-01-02"}, code: 1, stderr: "kiln export: --from:"},
+		{name: "partitions without command", args: []string{"partitions"}, code: 1, stderr: "kiln partitions: usage: kiln partitions manage|list [flags]"},
+		{name: "partitions unknown command", args: []string{"partitions", "drop"}, code: 1, stderr: `kiln partitions: unknown partitions command "drop", expected manage or list`},
+		{name: "partitions unknown flag", args: []string{"partitions", "list", "--unknown"}, code: 1, stderr: "flag provided but not defined: -unknown"},
+		{name: "config without command", args: []string{"config"}, code: 1, stderr: "kiln config: usage: kiln config print [flags]"},
+		{name: "config print invalid value", args: []string{"config", "print", "--db-dsn", "user@tcp(db)/kiln", "--tzkt-timeout", "soon"}, code: 1, stderr: "kiln config: -tzkt-timeout:"},
+		{name: "config print missing dsn", args: []string{"config", "print"}, code: 1, stderr: "MYSQL_DSN: is required"},
+		{name: "config print", args: []string{"config", "print", "--db-dsn", "user@tcp(db)/kiln", "--tzkt-network", "ghostnet"}, code: 0, stdout: "ghostnet"},
+		{name: "sync without command", args: []string{"sync"}, code: 1, stderr: "kiln sync: usage: kiln sync list|set [flags]"},
+		{name: "sync unknown command", args: []string{"sync", "reset"}, code: 1, stderr: `kiln sync: unknown sync command "reset", expected list or set`},
+		{name: "sync set invalid level", args: []string{"sync", "set", "--level", "tip"}, code: 1, stderr: `invalid value "tip" for flag -level`},
+		{name: "sync list unknown flag", args: []string{"sync", "list", "--network", "mainnet"}, code: 1, stderr: "flag provided but not defined: -network"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			out, errOut := captureOutput(t)
+
+			require.Equal(t, tt.code, run(commands, tt.args), errOut.String())
+			require.Contains(t, errOut.String(), tt.stderr)
+			require.Contains(t, out.String(), tt.stdout)
+		})
+	}
+}
+
+func TestPrintMigrations(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		versions []int
+		output   string
+	}{
+		{name: "up to date", versions: nil, output: "Database is up to date.\n"},
+		{name: "applied", versions: []int{2, 3}, output: "Applied migrations [2 3]\n"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			out, _ := captureOutput(t)
+
+			printMigrations(tt.versions)
+			require.Equal(t, tt.output, out.String())
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// runMigrate apply the pending database migrations.
+func runMigrate(ctx context.Context, args []string) error {
+	flags, loader := newFlagSet("migrate")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	a, err := newApp(loader)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+
+	versions, err := a.dbClient.Migrate(ctx)
+	if err != nil {
+		return err
+	}
+
+	printMigrations(versions)
+	return nil
+}
+
+// printMigrations print the versions of the migrations applied, or that the database was up to date.
+func printMigrations(versions []int) {
+	if len(versions) == 0 {
+		fmt.Fprintln(stdout, "Database is up to date.")
+		return
+	}
+
+	fmt.Fprintf(stdout, "Applied migrations %v\n", versions)
+}
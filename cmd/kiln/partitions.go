@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/kiln-mid/pkg/db"
+)
+
+// runPartitions run `partitions manage` or `partitions list`.
+func runPartitions(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: kiln partitions manage|list [flags]")
+	}
+	if args[0] != "manage" && args[0] != "list" {
+		return fmt.Errorf("unknown partitions command %q, expected manage or list", args[0])
+	}
+
+	flags, loader := newFlagSet("partitions " + args[0])
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	a, err := newApp(loader)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+
+	switch args[0] {
+	case "manage":
+		return managePartitions(ctx, a)
+	default:
+		return listPartitions(ctx, a)
+	}
+}
+
+// managePartitions partition the delegations table if needed, create partitions ahead of time and apply the retention policy.
+func managePartitions(ctx context.Context, a *app) error {
+	report, err := a.retentionClient.Run(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stdout, "Retention boundary: %s\n", report.Boundary)
+	fmt.Fprintf(stdout, "Created partitions: %v\n", report.Created)
+	fmt.Fprintf(stdout, "Expired partitions: %v\n", report.Expired)
+	return nil
+}
+
+// listPartitions print the partitions of the delegations table.
+func listPartitions(ctx context.Context, a *app) error {
+	partitions, err := db.NewPartitionsAdapter(a.dbClient.DB).FindPartitions(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range partitions {
+		fmt.Fprintf(stdout, "%s\t%s\t%d\n", p.Name, p.LessThan.Format("2006-01-02"), p.Rows)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+
+	"github.com/kiln-mid/cmd/admin"
+	"github.com/kiln-mid/cmd/health"
+	"github.com/kiln-mid/cmd/xtz"
+)
+
+// runServe serve the delegations API and the administration endpoints, no worker is started.
+func runServe(ctx context.Context, args []string) error {
+	flags, loader := newFlagSet("serve")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	a, err := newApp(loader)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+
+	r := a.newRouter()
+
+	x := xtz.Handler{
+		DelegationsClient: a.delegationsClient,
+		ClosedMaxAge:      a.config.HTTP.CacheMaxAgeClosed,
+		LiveMaxAge:        a.config.HTTP.CacheMaxAgeLive,
+		CacheSize:         a.config.HTTP.ResponseCacheSize,
+	}
+
+	x.RegisterRouter(r)
+
+	ad := admin.Handler{
+		DelegationsClient: a.delegationsClient,
+		GapsAuditor:       a.gapsAuditor,
+		LeasesRepository:  a.leasesRepository,
+	}
+
+	ad.RegisterRouter(r)
+
+	h := health.Handler{
+		Database:              a.dbClient,
+		DelegationsRepository: a.delegationsRepository,
+		LagMeter:              a.delegationsClient,
+		LeasesRepository:      a.leasesRepository,
+		SyncStateRepository:   a.syncStateRepository,
+		IngestionWorker:       delegationsWorker,
+		MaxLag:                a.config.HTTP.ReadyMaxLag,
+		Version:               buildVersion(),
+	}
+
+	h.RegisterRouter(r)
+
+	return listenAndServe(ctx, a.config.HTTP.Port, a.config.HTTP.ShutdownTimeout, r, nil)
+}
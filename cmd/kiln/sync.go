@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/kiln-mid/pkg/delegations"
+	"github.com/kiln-mid/pkg/models"
+	"github.com/kiln-mid/pkg/tezos"
+)
+
+// runSync run `sync list` or `sync set`.
+func runSync(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: kiln sync list|set [flags]")
+	}
+
+	switch args[0] {
+	case "list":
+		return listSyncStates(ctx, args[1:])
+	case "set":
+		return setSyncState(ctx, args[1:])
+	default:
+		return fmt.Errorf("unknown sync command %q, expected list or set", args[0])
+	}
+}
+
+// listSyncStates print the sync state of every network and source.
+func listSyncStates(ctx context.Context, args []string) error {
+	flags, loader := newFlagSet("sync list")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	a, err := newApp(loader)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+
+	states, err := a.delegationsClient.GetSyncStates(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range states {
+		fmt.Fprintf(stdout, "%s\t%s\tlevel=%d\toperation_id=%d\tupdated_at=%s\n", s.Network, s.Source, s.Level, s.OperationID, s.UpdatedAt)
+	}
+	return nil
+}
+
+// setSyncState overwrite the sync state of the tzkt source of a network to rewind or fast-forward the ingestion.
+// The worker resume from the first delegation whose operation id is greater than --operation-id.
+func setSyncState(ctx context.Context, args []string) error {
+	flags, loader := newFlagSet("sync set")
+	network := flags.String("network", tezos.DefaultNetwork, "network of the sync state")
+	level := flags.Int("level", 0, "level of the last delegation ingested")
+	operationID := flags.Int("operation-id", 0, "tzkt operation id of the last delegation ingested")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	a, err := newApp(loader)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+
+	return a.delegationsClient.SetSyncState(ctx, models.SyncState{
+		Network:     *network,
+		Source:      delegations.SyncSource,
+		Level:       *level,
+		OperationID: *operationID,
+	})
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/kiln-mid/pkg/verify"
+)
+
+// runVerify compare the delegations stored between --from and --to with tzkt and write a JSON report.
+// The command fails when a bucket differs from tzkt and has not been repaired.
+func runVerify(ctx context.Context, args []string) error {
+	flags, loader := newFlagSet("verify")
+	from := flags.String("from", "", "start of the range, included, as YYYY-MM-DD, RFC 3339 or a level")
+	to := flags.String("to", "", "end of the range, excluded, as YYYY-MM-DD, RFC 3339 or a level")
+	bucketDuration := flags.Duration("bucket", verify.DefaultBucketDuration, "duration of the buckets of a time range")
+	bucketLevels := flags.Int("bucket-levels", verify.DefaultBucketLevels, "number of levels of the buckets of a level range")
+	repair := flags.Bool("repair", false, "store the missing and mismatched delegations and delete the extra ones")
+	output := flags.String("output", "", "file the JSON report is written to, the standard output when empty")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	r, err := parseBackfillRange(*from, *to)
+	if err != nil {
+		return err
+	}
+
+	a, err := newApp(loader)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+
+	verifier := verify.NewVerifier(a.delegationsClient, a.delegationsRepository, verify.Options{
+		BucketDuration: *bucketDuration,
+		BucketLevels:   *bucketLevels,
+		Repair:         *repair,
+	})
+
+	report, err := verifier.Run(ctx, r)
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer = stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return err
+	}
+
+	if report.Unresolved() {
+		return fmt.Errorf("%d buckets differ from tzkt: %d missing, %d extra, %d mismatched", report.Divergent-report.Repaired, report.Missing, report.Extra, report.Mismatched)
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"runtime/debug"
+)
+
+// version is the version of the build, set with `-ldflags "-X main.version=v1.2.3"`.
+var version = ""
+
+// buildVersion return the version of the build, or the VCS revision recorded by the Go toolchain when it is not set.
+func buildVersion() string {
+	if version != "" {
+		return version
+	}
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+
+	revision, modified := "", false
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			modified = setting.Value == "true"
+		}
+	}
+	if revision == "" {
+		return info.Main.Version
+	}
+	if modified {
+		revision += "-dirty"
+	}
+	return revision
+}
@@ -0,0 +1,107 @@
+package xtz
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kiln-mid/pkg/models"
+)
+
+// etagFormat is the version of the format of the pages, it is part of the ETag so a change of the response invalidates the
+// pages cached by the clients.
+const etagFormat = 1
+
+// pageVersion identify a page of delegations and the version of the delegations it is read from.
+// key is the key of the page in the cache, etag its ETag and lastModified the timestamp of the last delegation inserted.
+type pageVersion struct {
+	key          string
+	etag         string
+	lastModified time.Time
+}
+
+// cachedPage is a page of delegations rendered for the version of etag.
+type cachedPage struct {
+	etag string
+	body []byte
+	link string
+}
+
+// newPageVersion return the version of a page given the last delegation inserted in its year and the data version, which
+// counts the delegations updated or deleted.
+func newPageVersion(year int, page int, limit int, last *models.Delegations, dataVersion int64) pageVersion {
+	key := fmt.Sprintf("%d/%d/%d", year, page, limit)
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d/%s/%d/%d/%d", etagFormat, key, last.ID, last.TezosID, dataVersion)))
+	return pageVersion{
+		key:          key,
+		etag:         `"` + hex.EncodeToString(sum[:12]) + `"`,
+		lastModified: last.Timestamp,
+	}
+}
+
+// matchETag report whether the `If-None-Match` header matches etag, with the weak comparison of RFC 9110.
+func matchETag(header string, etag string) bool {
+	if header == "" || etag == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// cachedPage return the page of version kept in the cache, a page of an older version is not reused.
+func (a *Handler) cachedPage(version pageVersion) (cachedPage, bool) {
+	if a.cache == nil {
+		return cachedPage{}, false
+	}
+	page, ok := a.cache.Get(version.key)
+	if !ok || page.etag != version.etag {
+		return cachedPage{}, false
+	}
+	return page, true
+}
+
+// writePage write page with its cache headers.
+func (a *Handler) writePage(c *gin.Context, year int, version pageVersion, page cachedPage) {
+	if version.etag != "" {
+		a.setCacheHeaders(c, year, version)
+	}
+	if page.link != "" {
+		c.Header("Link", page.link)
+	}
+	c.Data(http.StatusOK, "application/json; charset=utf-8", page.body)
+}
+
+// setCacheHeaders set the validators of version and the `Cache-Control` of the year: a past year only changes when
+// delegations are backfilled and is cached for ClosedMaxAge, the current delegations change with every poll and are
+// cached for LiveMaxAge.
+func (a *Handler) setCacheHeaders(c *gin.Context, year int, version pageVersion) {
+	maxAge := a.LiveMaxAge
+	if year != 0 && year < time.Now().UTC().Year() {
+		maxAge = a.ClosedMaxAge
+	}
+
+	c.Header("ETag", version.etag)
+	c.Header("Last-Modified", version.lastModified.UTC().Format(http.TimeFormat))
+	c.Header("Cache-Control", "public, max-age="+strconv.Itoa(int(maxAge.Seconds())))
+}
+
+// listURL return the URL of the list of delegations of year, the base of the page links. Other query params are left out
+// so the links of a cached page do not depend on the request which rendered it.
+func listURL(path string, year int) *url.URL {
+	u := &url.URL{Path: path}
+	if year != 0 {
+		u.RawQuery = url.Values{"year": {strconv.Itoa(year)}}.Encode()
+	}
+	return u
+}
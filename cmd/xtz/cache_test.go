@@ -0,0 +1,195 @@
+package xtz_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kiln-mid/cmd/xtz"
+	"github.com/kiln-mid/pkg/delegations"
+	"github.com/kiln-mid/pkg/models"
+	"github.com/kiln-mid/pkg/tezos"
+	"github.com/stretchr/testify/require"
+)
+
+// newCachingRouter return a router serving the `xtz` routes from repository with a response cache.
+func newCachingRouter(repository *fakeDelegationsRepository) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+
+	handler := &xtz.Handler{
+		DelegationsClient: delegations.NewClient(tezos.NewClient(), repository, nil),
+		ClosedMaxAge:      24 * time.Hour,
+		LiveMaxAge:        10 * time.Second,
+		CacheSize:         8,
+	}
+	handler.RegisterRouter(router)
+
+	return router
+}
+
+func getList(router *gin.Engine, target string, ifNoneMatch string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	if ifNoneMatch != "" {
+		req.Header.Set("If-None-Match", ifNoneMatch)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestHandler_CacheControl(t *testing.T) {
+	current := time.Now().UTC().Year()
+	router := newCachingRouter(&fakeDelegationsRepository{delegations: []models.Delegations{
+		{ID: 2, TezosID: 2, Timestamp: time.Date(current, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{ID: 1, TezosID: 1, Timestamp: time.Date(current-1, 6, 1, 12, 0, 0, 0, time.UTC)},
+	}})
+
+	for _, tt := range []struct {
+		target       string
+		cacheControl string
+		lastModified string
+	}{
+		{target: "/xtz/delegations", cacheControl: "public, max-age=10"},
+		{target: "/xtz/delegations?year=" + strconv.Itoa(current), cacheControl: "public, max-age=10"},
+		{
+			target:       "/xtz/delegations?year=" + strconv.Itoa(current-1),
+			cacheControl: "public, max-age=86400",
+			lastModified: time.Date(current-1, 6, 1, 12, 0, 0, 0, time.UTC).Format(http.TimeFormat),
+		},
+	} {
+		t.Run(tt.target, func(t *testing.T) {
+			w := getList(router, tt.target, "")
+
+			require.Equal(t, http.StatusOK, w.Code)
+			require.NotEmpty(t, w.Header().Get("ETag"))
+			require.Equal(t, tt.cacheControl, w.Header().Get("Cache-Control"))
+			if tt.lastModified != "" {
+				require.Equal(t, tt.lastModified, w.Header().Get("Last-Modified"))
+			}
+		})
+	}
+}
+
+func TestHandler_ETag(t *testing.T) {
+	repository := &fakeDelegationsRepository{delegations: []models.Delegations{
+		{ID: 1, TezosID: 1, Timestamp: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}}
+	router := newRouterWithRepository(repository)
+
+	w := getList(router, "/xtz/delegations", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	etag := w.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+
+	// Another filter is another version.
+	require.NotEqual(t, etag, getList(router, "/xtz/delegations?limit=10", "").Header().Get("ETag"))
+
+	pages := repository.pages
+	for _, ifNoneMatch := range []string{etag, "W/" + etag, `"other", ` + etag, "*"} {
+		w = getList(router, "/xtz/delegations", ifNoneMatch)
+		require.Equal(t, http.StatusNotModified, w.Code, ifNoneMatch)
+		require.Empty(t, w.Body.String())
+		require.Equal(t, etag, w.Header().Get("ETag"))
+	}
+	require.Equal(t, pages, repository.pages, "a 304 must not read the delegations")
+
+	require.Equal(t, http.StatusOK, getList(router, "/xtz/delegations", `"other"`).Code)
+
+	// An insert changes the version, the former ETag no longer matches.
+	repository.delegations = append([]models.Delegations{{ID: 2, TezosID: 2, Timestamp: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)}}, repository.delegations...)
+	w = getList(router, "/xtz/delegations", etag)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NotEqual(t, etag, w.Header().Get("ETag"))
+}
+
+func TestHandler_ETagEmpty(t *testing.T) {
+	w := getList(newRouter(nil), "/xtz/delegations", "*")
+
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Empty(t, w.Header().Get("ETag"))
+}
+
+func TestHandler_ResponseCache(t *testing.T) {
+	repository := &fakeDelegationsRepository{delegations: []models.Delegations{
+		{ID: 1, TezosID: 1, Timestamp: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}}
+	router := newCachingRouter(repository)
+
+	first := getList(router, "/xtz/delegations?year=2024", "")
+	require.Equal(t, http.StatusOK, first.Code)
+	require.Equal(t, 1, repository.pages)
+
+	cached := getList(router, "/xtz/delegations?year=2024&unknown=1", "")
+	require.Equal(t, http.StatusOK, cached.Code)
+	require.Equal(t, 1, repository.pages, "a cached page must not read the delegations")
+	require.Equal(t, first.Body.String(), cached.Body.String())
+	require.Equal(t, first.Header().Get("ETag"), cached.Header().Get("ETag"))
+	require.Equal(t, "application/json; charset=utf-8", cached.Header().Get("Content-Type"))
+
+	// The worker inserts a delegation, the cached page is stale.
+	repository.delegations = append([]models.Delegations{{ID: 2, TezosID: 2, Timestamp: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)}}, repository.delegations...)
+	fresh := getList(router, "/xtz/delegations?year=2024", "")
+	require.Equal(t, http.StatusOK, fresh.Code)
+	require.Equal(t, 2, repository.pages)
+	require.NotEqual(t, first.Header().Get("ETag"), fresh.Header().Get("ETag"))
+	require.Contains(t, fresh.Body.String(), `"id":2`)
+}
+
+func TestHandler_ETagDataVersion(t *testing.T) {
+	repository := &fakeDelegationsRepository{delegations: []models.Delegations{
+		{ID: 1, TezosID: 1, Timestamp: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}}
+	router := newCachingRouter(repository)
+
+	first := getList(router, "/xtz/delegations?year=2024", "")
+	require.Equal(t, http.StatusOK, first.Code)
+	etag := first.Header().Get("ETag")
+
+	// The hash is filled in place, the last inserted delegation is unchanged but the data version is bumped.
+	_, err := repository.FillHash(context.Background(), 1, testHash)
+	require.NoError(t, err)
+
+	w := getList(router, "/xtz/delegations?year=2024", etag)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NotEqual(t, etag, w.Header().Get("ETag"))
+	require.Equal(t, 2, repository.pages, "the cached page of the former version must not be reused")
+	require.Contains(t, w.Body.String(), testHash)
+}
+
+// fixedRetention is a retention policy whose boundary is moved by the test.
+type fixedRetention struct {
+	boundary time.Time
+}
+
+func (r *fixedRetention) Boundary() time.Time {
+	return r.boundary
+}
+
+func TestHandler_CacheOutOfRetention(t *testing.T) {
+	repository := &fakeDelegationsRepository{delegations: []models.Delegations{
+		{ID: 1, TezosID: 1, Timestamp: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}}
+	retention := &fixedRetention{}
+	client := delegations.NewClient(tezos.NewClient(), repository, nil)
+	client.SetRetention(retention)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	handler := &xtz.Handler{DelegationsClient: client, CacheSize: 8}
+	handler.RegisterRouter(router)
+
+	first := getList(router, "/xtz/delegations?year=2024", "")
+	require.Equal(t, http.StatusOK, first.Code)
+
+	// The partitions of 2024 expire, neither the cache nor the ETag of the client serve the year.
+	retention.boundary = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, ifNoneMatch := range []string{"", first.Header().Get("ETag")} {
+		w := getList(router, "/xtz/delegations?year=2024", ifNoneMatch)
+		require.Equal(t, http.StatusGone, w.Code, ifNoneMatch)
+	}
+}
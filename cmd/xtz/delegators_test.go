@@ -0,0 +1,109 @@
+package xtz_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers/legacy"
+	"github.com/kiln-mid/cmd/xtz"
+	"github.com/kiln-mid/pkg/models"
+	"github.com/stretchr/testify/require"
+)
+
+// address return a valid tz1 address made of c.
+func address(c string) string {
+	return "tz1" + strings.Repeat(c, 33)
+}
+
+func TestHandler_LookupDelegators(t *testing.T) {
+	doc, err := xtz.OpenAPI()
+	require.NoError(t, err)
+	documented, err := legacy.NewRouter(doc)
+	require.NoError(t, err)
+
+	repository := &fakeDelegationsRepository{delegations: []models.Delegations{
+		{TezosID: 3, Delegator: address("a"), Timestamp: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{TezosID: 2, Delegator: address("a"), Timestamp: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{TezosID: 1, Delegator: address("b"), Timestamp: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}}
+	router := newRouterWithRepository(repository)
+
+	tooMany := make([]string, 5001)
+	for i := range tooMany {
+		tooMany[i] = address("c")
+	}
+	tooManyBody, err := json.Marshal(xtz.LookupRequest{Addresses: tooMany})
+	require.NoError(t, err)
+
+	for _, tt := range []struct {
+		name   string
+		body   string
+		status int
+		ids    []int
+		param  string
+	}{
+		{
+			name:   "latest delegation or null",
+			body:   `{"addresses": ["` + address("b") + `", "` + address("c") + `", "` + address("a") + `", "` + address("b") + `"]}`,
+			status: http.StatusOK,
+			ids:    []int{1, 0, 3, 1},
+		},
+		{name: "invalid address", body: `{"addresses": ["tz1", "` + address("a") + `"]}`, status: http.StatusBadRequest, param: "addresses.0"},
+		{name: "no address", body: `{"addresses": []}`, status: http.StatusBadRequest, param: "addresses"},
+		{name: "too many addresses", body: string(tooManyBody), status: http.StatusBadRequest, param: "addresses"},
+		{name: "not json", body: `addresses`, status: http.StatusBadRequest},
+		{name: "too large", body: `{"addresses": ["` + strings.Repeat("a", 2<<20) + `"]}`, status: http.StatusRequestEntityTooLarge},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			repository.lookups = 0
+
+			req := httptest.NewRequest(http.MethodPost, "/xtz/delegators/lookup", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			require.Equal(t, tt.status, w.Code, w.Body.String())
+
+			if tt.status != http.StatusOK {
+				require.Zero(t, repository.lookups)
+				var problem xtz.Problem
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+				if tt.param != "" {
+					require.Equal(t, tt.param, problem.InvalidParams[0].Name)
+				}
+				return
+			}
+
+			require.Equal(t, 1, repository.lookups)
+			var response xtz.LookupResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			ids := []int{}
+			for _, result := range response.Data {
+				if result.Delegation == nil {
+					ids = append(ids, 0)
+					continue
+				}
+				require.Equal(t, result.Address, result.Delegation.Delegator)
+				ids = append(ids, result.Delegation.TezosID)
+			}
+			require.Equal(t, tt.ids, ids)
+
+			validationReq := httptest.NewRequest(http.MethodPost, "/xtz/delegators/lookup", strings.NewReader(tt.body))
+			route, pathParams, err := documented.FindRoute(validationReq)
+			require.NoError(t, err)
+			require.NoError(t, openapi3filter.ValidateResponse(context.Background(), &openapi3filter.ResponseValidationInput{
+				RequestValidationInput: &openapi3filter.RequestValidationInput{Request: validationReq, PathParams: pathParams, Route: route},
+				Status:                 w.Code,
+				Header:                 w.Header(),
+				Body:                   io.NopCloser(bytes.NewReader(w.Body.Bytes())),
+			}))
+		})
+	}
+}
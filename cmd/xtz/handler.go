@@ -1,34 +1,67 @@
 package xtz
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/kiln-mid/pkg/delegations"
 	"github.com/kiln-mid/pkg/models"
+	"github.com/kiln-mid/pkg/utilcache"
 )
 
 // Handler represent the handler of delegationsRepository
+// ClosedMaxAge and LiveMaxAge are the `Cache-Control` max-age of the pages of a past year and of the other pages, which change
+// with every delegation ingested. CacheSize is the number of pages kept in memory, 0 disables the cache.
 type Handler struct {
 	DelegationsClient *delegations.Client
+	ClosedMaxAge      time.Duration
+	LiveMaxAge        time.Duration
+	CacheSize         int
+
+	cache *utilcache.LRU[string, cachedPage]
 }
 
-// RegisterRouter expose all endpoint for the `xtz` group.
+// RegisterRouter expose all endpoint for the `xtz` group, validated against the OpenAPI document served at `/openapi.json`.
 func (a *Handler) RegisterRouter(router *gin.Engine) {
-	delegationsRouter := router.Group("/xtz")
+	// The embedded document is validated by the tests, it cannot fail at runtime.
+	doc, err := OpenAPI()
+	if err != nil {
+		panic(err)
+	}
+	registerDocs(router, doc)
+
+	if a.CacheSize > 0 {
+		a.cache = utilcache.NewLRU[string, cachedPage](a.CacheSize)
+	}
+
+	delegationsRouter := router.Group("/xtz", limitBody(maxBodyBytes), ValidateRequests(doc))
 
 	delegationsRouter.GET("/delegations", a.getLastDelegations)
+	delegationsRouter.GET("/delegations/:id", a.getDelegation)
+	delegationsRouter.GET("/operations/:hash", a.getOperation)
+	delegationsRouter.POST("/delegators/lookup", a.lookupDelegators)
 }
 
 // Response represent the response gived by to the client
+// Total is the number of delegations matching the query, estimated from the table statistics when TotalEstimated is set.
 type Response struct {
-	Data []models.Delegations `json:"data"`
-	Page int                  `json:"Page"`
+	Data           []models.Delegations `json:"data"`
+	Page           int                  `json:"Page"`
+	Limit          int                  `json:"limit"`
+	Total          int64                `json:"total"`
+	TotalEstimated bool                 `json:"total_estimated"`
+	HasMore        bool                 `json:"has_more"`
+	Links          Links                `json:"links"`
 }
 
 // getLastDelegations return all last delegations found if no query params are found.
 // If a `year` param is provided, it will search all delegations based on the year provided.
 // page and limit param try to mitigate the volume of data returned to the client.
+// The page is versioned by the last delegation inserted in its year and the data version: a request whose `If-None-Match` holds the current ETag
+// gets a 304 and a cached page is reused, without reading the delegations.
 func (a *Handler) getLastDelegations(c *gin.Context) {
 	var queryParams struct {
 		Year  int `form:"year" binding:"omitempty,min=1000,max=9999"`
@@ -37,9 +70,7 @@ func (a *Handler) getLastDelegations(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindQuery(&queryParams); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Check Year field is valid and follow the following format `YYYY`",
-		})
+		AbortWithProblem(c, bindingProblem(err))
 		return
 	}
 
@@ -51,15 +82,173 @@ func (a *Handler) getLastDelegations(c *gin.Context) {
 		queryParams.Limit = 100
 	}
 
-	delegations, err := a.DelegationsClient.GetDelegations(c.Request.Context(), queryParams.Year, queryParams.Page, queryParams.Limit)
+	ctx := c.Request.Context()
+
+	// A year past the retention boundary is gone, even when a client or the cache still holds its pages.
+	if err := a.DelegationsClient.CheckRetention(queryParams.Year); err != nil {
+		AbortWithError(c, err)
+		return
+	}
+
+	// The version is read before the page, so a delegation inserted or changed in between changes the ETag of the next request.
+	last, err := a.DelegationsClient.LastInserted(ctx, queryParams.Year)
+	if err != nil {
+		AbortWithError(c, err)
+		return
+	}
+	dataVersion, err := a.DelegationsClient.DataVersion(ctx)
+	if err != nil {
+		AbortWithError(c, err)
+		return
+	}
+
+	var version pageVersion
+	if last != nil {
+		version = newPageVersion(queryParams.Year, queryParams.Page, queryParams.Limit, last, dataVersion)
+		if matchETag(c.GetHeader("If-None-Match"), version.etag) {
+			a.setCacheHeaders(c, queryParams.Year, version)
+			c.Status(http.StatusNotModified)
+			return
+		}
+		if page, ok := a.cachedPage(version); ok {
+			a.writePage(c, queryParams.Year, version, page)
+			return
+		}
+	}
+
+	result, err := a.DelegationsClient.GetDelegations(ctx, queryParams.Year, queryParams.Page, queryParams.Limit)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		AbortWithError(c, err)
 		return
 	}
 
 	response := Response{
-		Data: *delegations,
-		Page: queryParams.Page,
+		Data:           result.Delegations,
+		Page:           queryParams.Page,
+		Limit:          queryParams.Limit,
+		Total:          result.Total,
+		TotalEstimated: !result.TotalExact,
+		HasMore:        result.HasMore,
+		Links:          pageLinks(listURL(c.Request.URL.Path, queryParams.Year), queryParams.Page, queryParams.Limit, result.HasMore),
+	}
+
+	body, err := json.Marshal(response)
+	if err != nil {
+		AbortWithError(c, err)
+		return
+	}
+
+	page := cachedPage{etag: version.etag, body: body, link: response.Links.header()}
+	if last != nil && a.cache != nil {
+		a.cache.Add(version.key, page)
+	}
+	a.writePage(c, queryParams.Year, version, page)
+}
+
+// getDelegation return the delegation whose tzkt operation id is the `id` param.
+// With the `refresh` param, a delegation which is not stored is fetched from tzkt and stored.
+func (a *Handler) getDelegation(c *gin.Context) {
+	var params struct {
+		ID int `uri:"id" binding:"required,min=1"`
+	}
+	if err := c.ShouldBindUri(&params); err != nil {
+		AbortWithProblem(c, bindingProblem(err))
+		return
+	}
+	refresh, ok := bindRefresh(c)
+	if !ok {
+		return
+	}
+
+	delegation, err := a.DelegationsClient.GetDelegation(c.Request.Context(), params.ID, refresh)
+	if err != nil {
+		abortWithLookupError(c, err, refresh)
+		return
+	}
+
+	c.JSON(http.StatusOK, delegation)
+}
+
+// getOperation return the delegation of the operation whose hash is the `hash` param.
+// With the `refresh` param, a delegation which is not stored is fetched from tzkt and stored.
+func (a *Handler) getOperation(c *gin.Context) {
+	refresh, ok := bindRefresh(c)
+	if !ok {
+		return
+	}
+
+	delegation, err := a.DelegationsClient.GetOperation(c.Request.Context(), c.Param("hash"), refresh)
+	if err != nil {
+		abortWithLookupError(c, err, refresh)
+		return
+	}
+
+	c.JSON(http.StatusOK, delegation)
+}
+
+// bindRefresh return the `refresh` query param, the request is aborted when it is invalid.
+func bindRefresh(c *gin.Context) (bool, bool) {
+	var queryParams struct {
+		Refresh bool `form:"refresh"`
+	}
+	if err := c.ShouldBindQuery(&queryParams); err != nil {
+		AbortWithProblem(c, bindingProblem(err))
+		return false, false
+	}
+	return queryParams.Refresh, true
+}
+
+// abortWithLookupError write the problem of an error of a single delegation lookup, telling whether tzkt was asked on a 404.
+func abortWithLookupError(c *gin.Context, err error, refresh bool) {
+	if !errors.Is(err, delegations.ErrNotFound) {
+		AbortWithError(c, err)
+		return
+	}
+
+	detail := "the delegation is not stored, refresh=true looks it up on tzkt"
+	if refresh {
+		detail = "the delegation is neither stored nor known by tzkt"
+	}
+	AbortWithProblem(c, Problem{Status: http.StatusNotFound, Detail: detail})
+}
+
+// LookupRequest represent the body of a lookup of the latest delegation of many delegators.
+type LookupRequest struct {
+	Addresses []string `json:"addresses" binding:"required,min=1,max=5000"`
+}
+
+// LookupResult represent the latest delegation of a delegator, Delegation is null when none is stored.
+type LookupResult struct {
+	Address    string              `json:"address"`
+	Delegation *models.Delegations `json:"delegation"`
+}
+
+// LookupResponse represent the response of a lookup, with a result per address in the order of the request.
+type LookupResponse struct {
+	Data []LookupResult `json:"data"`
+}
+
+// lookupDelegators return the latest delegation of every address of the body, with a single query whatever the number of addresses.
+func (a *Handler) lookupDelegators(c *gin.Context) {
+	var body LookupRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		AbortWithProblem(c, bindingProblem(err))
+		return
+	}
+
+	latest, err := a.DelegationsClient.LatestByDelegators(c.Request.Context(), body.Addresses)
+	if err != nil {
+		AbortWithError(c, err)
+		return
+	}
+
+	response := LookupResponse{Data: make([]LookupResult, 0, len(body.Addresses))}
+	for _, address := range body.Addresses {
+		result := LookupResult{Address: address}
+		if d, ok := latest[address]; ok {
+			result.Delegation = &d
+		}
+		response.Data = append(response.Data, result)
 	}
 
 	c.JSON(http.StatusOK, response)
@@ -20,7 +20,7 @@ import (
 )
 
 func TestGetLastDelegations(t *testing.T) {
-	utilconfig.LoadConfig()
+	require.NoError(t, utilconfig.LoadConfig())
 
 	gin.SetMode(gin.TestMode)
 	router := gin.Default()
@@ -28,11 +28,14 @@ func TestGetLastDelegations(t *testing.T) {
 	dbClient, err := db.CreateClient(os.Getenv("MYSQL_TEST_DSN"))
 	require.NoError(t, err)
 
+	_, err = dbClient.Migrate(context.Background())
+	require.NoError(t, err)
+
 	dr := db.NewDelegationsAdapter(dbClient.DB)
 
 	tezosClient := tezos.NewClient()
 
-	delegationsClient := delegations.NewClient(tezosClient, dr)
+	delegationsClient := delegations.NewClient(tezosClient, dr, db.NewSyncStateAdapter(dbClient.DB))
 
 	dr.CreateMany(context.Background(), &[]models.Delegations{
 		{
@@ -84,7 +87,7 @@ func TestGetLastDelegations(t *testing.T) {
 					Delegator: "foobar",
 					Timestamp: time.Date(2023, 1, 1, 11, 0, 0, 0, time.UTC),
 				},
-			}, Page: 1},
+			}, Page: 1, Limit: 100, Total: 2},
 		},
 		{
 			name:               "Success - With Year",
@@ -99,22 +102,32 @@ func TestGetLastDelegations(t *testing.T) {
 					Delegator: "foobar",
 					Timestamp: time.Date(2023, 1, 1, 11, 0, 0, 0, time.UTC),
 				},
-			}, Page: 1},
+			}, Page: 1, Limit: 100, Total: 1},
 		},
 		{
 			name:               "Error - Invalid Year",
 			queryParams:        map[string]string{"year": "1000"},
-			expectedStatusCode: http.StatusInternalServerError,
-			expectedResponse: map[string]string{
-				"error": "Here are the following available years: 2023,2024",
+			expectedStatusCode: http.StatusBadRequest,
+			expectedResponse: xtz.Problem{
+				Type:          "about:blank",
+				Title:         "Bad Request",
+				Status:        http.StatusBadRequest,
+				Detail:        "invalid year: no delegation stored for 1000, the available years are 2023,2024",
+				Instance:      "/xtz/delegations",
+				InvalidParams: []xtz.InvalidParam{{Name: "year", Reason: "no delegation stored for 1000, the available years are 2023,2024"}},
 			},
 		},
 		{
 			name:               "Error - Bad Request",
 			queryParams:        map[string]string{"year": "12"},
 			expectedStatusCode: http.StatusBadRequest,
-			expectedResponse: map[string]string{
-				"error": "Check Year field is valid and follow the following format `YYYY`",
+			expectedResponse: xtz.Problem{
+				Type:          "about:blank",
+				Title:         "Bad Request",
+				Status:        http.StatusBadRequest,
+				Detail:        "invalid query parameter \"year\": number must be at least 1000",
+				Instance:      "/xtz/delegations",
+				InvalidParams: []xtz.InvalidParam{{Name: "year", Reason: "number must be at least 1000"}},
 			},
 		},
 	}
@@ -0,0 +1,146 @@
+package xtz_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/h2non/gock"
+	"github.com/kiln-mid/cmd/xtz"
+	"github.com/kiln-mid/pkg/models"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler_LookupRefresh(t *testing.T) {
+	defer gock.Off()
+	gock.DisableNetworking()
+	gock.Intercept()
+
+	tzkt := `[{"id": 42, "hash": "` + testHash + `", "level": 7, "timestamp": "2024-01-01T10:00:00Z", "amount": 10, "sender": {"address": "tz1"}}]`
+
+	expected := models.Delegations{TezosID: 42, Hash: testHash, Level: 7, Amount: 10, Delegator: "tz1", Timestamp: time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)}
+	// withoutHash is the delegation as ingested before the hash was stored.
+	withoutHash := models.Delegations{ID: 3, TezosID: 42, Level: 7, Amount: 10, Delegator: "tz1", Timestamp: time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)}
+	filled := withoutHash
+	filled.Hash = testHash
+
+	for _, tt := range []struct {
+		name     string
+		target   string
+		existing []models.Delegations
+		mock     func()
+		status   int
+		stored   []models.Delegations
+	}{
+		{
+			name:   "not stored without refresh",
+			target: "/xtz/delegations/42",
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "fetched by id",
+			target: "/xtz/delegations/42?refresh=true",
+			mock: func() {
+				gock.New("https://api.tzkt.io").Get("/v1/operations/delegations").MatchParam("id", "42").Reply(200).BodyString(tzkt)
+			},
+			status: http.StatusOK,
+			stored: []models.Delegations{expected},
+		},
+		{
+			name:   "fetched by hash",
+			target: "/xtz/operations/" + testHash + "?refresh=true",
+			mock: func() {
+				gock.New("https://api.tzkt.io").Get("/v1/operations/delegations").MatchParam("hash", testHash).Reply(200).BodyString(tzkt)
+			},
+			status: http.StatusOK,
+			stored: []models.Delegations{expected},
+		},
+		{
+			name:     "stored without hash fetched by hash",
+			target:   "/xtz/operations/" + testHash + "?refresh=true",
+			existing: []models.Delegations{withoutHash},
+			mock: func() {
+				gock.New("https://api.tzkt.io").Get("/v1/operations/delegations").MatchParam("hash", testHash).Reply(200).BodyString(tzkt)
+			},
+			status: http.StatusOK,
+			stored: []models.Delegations{filled},
+		},
+		{
+			name:     "stored without hash fetched by id",
+			target:   "/xtz/delegations/42?refresh=true",
+			existing: []models.Delegations{withoutHash},
+			mock: func() {
+				gock.New("https://api.tzkt.io").Get("/v1/operations/delegations").MatchParam("id", "42").Reply(200).BodyString(tzkt)
+			},
+			status: http.StatusOK,
+			stored: []models.Delegations{filled},
+		},
+		{
+			name:     "stored without hash and tzkt unavailable",
+			target:   "/xtz/delegations/42?refresh=true",
+			existing: []models.Delegations{withoutHash},
+			mock: func() {
+				gock.New("https://api.tzkt.io").Get("/v1/operations/delegations").ReplyError(errors.New("connection refused"))
+			},
+			status: http.StatusOK,
+			stored: []models.Delegations{withoutHash},
+		},
+		{
+			name:   "unknown by tzkt",
+			target: "/xtz/delegations/42?refresh=true",
+			mock: func() {
+				gock.New("https://api.tzkt.io").Get("/v1/operations/delegations").MatchParam("id", "42").Reply(200).BodyString(`[]`)
+			},
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "tzkt unavailable",
+			target: "/xtz/delegations/42?refresh=true",
+			mock: func() {
+				gock.New("https://api.tzkt.io").Get("/v1/operations/delegations").ReplyError(errors.New("connection refused"))
+			},
+			status: http.StatusServiceUnavailable,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			defer gock.Flush()
+			if tt.mock != nil {
+				tt.mock()
+			}
+
+			repository := &fakeDelegationsRepository{delegations: append([]models.Delegations{}, tt.existing...)}
+			router := newRouterWithRepository(repository)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.target, nil))
+			require.Equal(t, tt.status, w.Code, w.Body.String())
+			require.True(t, gock.IsDone())
+
+			if tt.stored == nil {
+				require.Empty(t, repository.delegations)
+				return
+			}
+			require.Equal(t, tt.stored, repository.delegations)
+
+			// The stored row is returned, with its row id when it existed.
+			var delegation models.Delegations
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &delegation))
+			require.Equal(t, tt.stored[0], delegation)
+		})
+	}
+}
+
+func TestHandler_LookupNotFoundDetail(t *testing.T) {
+	router := newRouter(nil)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/xtz/operations/"+testHash, nil))
+	require.Equal(t, http.StatusNotFound, w.Code)
+
+	var problem xtz.Problem
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+	require.Equal(t, "the delegation is not stored, refresh=true looks it up on tzkt", problem.Detail)
+}
@@ -0,0 +1,163 @@
+package xtz
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/gin-gonic/gin"
+)
+
+// openAPIDocument is the OpenAPI document of the `xtz` routes, every route registered by RegisterRouter must be described.
+//
+//go:embed openapi.yaml
+var openAPIDocument []byte
+
+// docsPage is the page rendering the OpenAPI document with Swagger UI.
+//
+//go:embed docs.html
+var docsPage []byte
+
+// swaggerUI holds the assets of swagger-ui-dist 5.18.2, vendored so `/docs` works offline and loads no third party script.
+//
+//go:embed swagger-ui/swagger-ui-bundle.js swagger-ui/swagger-ui.css
+var swaggerUI embed.FS
+
+// loadOpenAPI parse and validate the embedded OpenAPI document once.
+var loadOpenAPI = sync.OnceValues(func() (*openapi3.T, error) {
+	doc, err := openapi3.NewLoader().LoadFromData(openAPIDocument)
+	if err != nil {
+		return nil, fmt.Errorf("load openapi document: %w", err)
+	}
+	if err := doc.Validate(context.Background()); err != nil {
+		return nil, fmt.Errorf("invalid openapi document: %w", err)
+	}
+	return doc, nil
+})
+
+// OpenAPI return the OpenAPI document of the `xtz` routes.
+func OpenAPI() (*openapi3.T, error) {
+	return loadOpenAPI()
+}
+
+// registerDocs expose the OpenAPI document at `/openapi.json` and its documentation at `/docs`, with the Swagger UI assets under `/docs/assets`.
+func registerDocs(router *gin.Engine, doc *openapi3.T) {
+	document, err := doc.MarshalJSON()
+	if err != nil {
+		panic(fmt.Sprintf("marshal openapi document: %s", err))
+	}
+
+	router.GET("/openapi.json", func(c *gin.Context) {
+		c.Data(http.StatusOK, "application/json", document)
+	})
+	router.GET("/docs", func(c *gin.Context) {
+		c.Data(http.StatusOK, "text/html; charset=utf-8", docsPage)
+	})
+
+	assets, err := fs.Sub(swaggerUI, "swagger-ui")
+	if err != nil {
+		panic(fmt.Sprintf("swagger ui assets: %s", err))
+	}
+	router.StaticFS("/docs/assets", http.FS(assets))
+}
+
+// OpenAPIPath convert a gin route, like `/xtz/delegations/:id`, to an OpenAPI path, like `/xtz/delegations/{id}`.
+func OpenAPIPath(route string) string {
+	segments := strings.Split(route, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// ValidateRequests return a gin middleware rejecting with a 400 the requests whose parameters or body do not match the
+// operation of their route in doc. Query parameters absent from the request are set to their default value.
+func ValidateRequests(doc *openapi3.T) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		path := OpenAPIPath(c.FullPath())
+		pathItem := doc.Paths.Find(path)
+		if pathItem == nil {
+			c.Next()
+			return
+		}
+		operation := pathItem.GetOperation(c.Request.Method)
+		if operation == nil {
+			c.Next()
+			return
+		}
+
+		pathParams := make(map[string]string, len(c.Params))
+		for _, p := range c.Params {
+			pathParams[p.Key] = p.Value
+		}
+
+		input := &openapi3filter.RequestValidationInput{
+			Request:    c.Request,
+			PathParams: pathParams,
+			Route: &routers.Route{
+				Spec:      doc,
+				Path:      path,
+				PathItem:  pathItem,
+				Method:    c.Request.Method,
+				Operation: operation,
+			},
+			Options: &openapi3filter.Options{AuthenticationFunc: openapi3filter.NoopAuthenticationFunc},
+		}
+		if err := openapi3filter.ValidateRequest(c.Request.Context(), input); err != nil {
+			AbortWithProblem(c, validationProblem(err))
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// validationProblem return the problem of a validation error, a 400 naming the invalid parameter or a 413 for a body too large.
+func validationProblem(err error) Problem {
+	problem := Problem{Status: http.StatusBadRequest, Detail: err.Error()}
+
+	if problem, ok := tooLargeProblem(err); ok {
+		return problem
+	}
+
+	var requestErr *openapi3filter.RequestError
+	if !errors.As(err, &requestErr) {
+		return problem
+	}
+
+	reason := requestErr.Reason
+	var schemaErr *openapi3.SchemaError
+	switch {
+	case errors.As(requestErr.Err, &schemaErr):
+		reason = schemaErr.Reason
+	case reason == "" && requestErr.Err != nil:
+		reason = requestErr.Err.Error()
+	}
+
+	switch {
+	case requestErr.Parameter != nil:
+		problem.Detail = fmt.Sprintf("invalid %s parameter %q: %s", requestErr.Parameter.In, requestErr.Parameter.Name, reason)
+		problem.InvalidParams = []InvalidParam{{Name: requestErr.Parameter.Name, Reason: reason}}
+	case requestErr.RequestBody != nil:
+		// The field of the body is named by its path, like `addresses.0`.
+		name := "body"
+		if schemaErr != nil && len(schemaErr.JSONPointer()) > 0 {
+			name = strings.Join(schemaErr.JSONPointer(), ".")
+		}
+		problem.Detail = "invalid request body: " + reason
+		problem.InvalidParams = []InvalidParam{{Name: name, Reason: reason}}
+	default:
+		problem.Detail = reason
+	}
+	return problem
+}
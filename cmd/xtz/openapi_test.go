@@ -0,0 +1,283 @@
+package xtz_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers/legacy"
+	"github.com/gin-gonic/gin"
+	"github.com/kiln-mid/cmd/xtz"
+	"github.com/kiln-mid/pkg/db"
+	"github.com/kiln-mid/pkg/delegations"
+	"github.com/kiln-mid/pkg/models"
+	"github.com/kiln-mid/pkg/tezos"
+	"github.com/stretchr/testify/require"
+)
+
+// testHash is the hash of an operation.
+const testHash = "ooLCq9wNzGa2mNoCgAoW5wvXbnN6nFkFGr7a1xCZt6WGSGhcSbX"
+
+type fakeDelegationsRepository struct {
+	db.DelegationsRepository
+	delegations []models.Delegations
+	err         error
+	lookups     int
+	pages       int
+	dataVersion int64
+}
+
+func (f *fakeDelegationsRepository) FindAndOrderByTimestamp(ctx context.Context, limit int, offset int) (*[]models.Delegations, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	f.pages++
+	d := f.delegations[min(offset, len(f.delegations)):min(offset+limit, len(f.delegations))]
+	return &d, nil
+}
+
+func (f *fakeDelegationsRepository) FindByTezosID(ctx context.Context, tezosID int) (*models.Delegations, error) {
+	for _, d := range f.delegations {
+		if d.TezosID == tezosID {
+			return &d, nil
+		}
+	}
+	return nil, db.ErrNotFound
+}
+
+func (f *fakeDelegationsRepository) FindByHash(ctx context.Context, hash string) (*models.Delegations, error) {
+	for _, d := range f.delegations {
+		if d.Hash == hash {
+			return &d, nil
+		}
+	}
+	return nil, db.ErrNotFound
+}
+
+func (f *fakeDelegationsRepository) FindLatestByDelegators(ctx context.Context, delegators []string) (map[string]models.Delegations, error) {
+	f.lookups++
+	latest := map[string]models.Delegations{}
+	for _, delegator := range delegators {
+		for _, d := range f.delegations {
+			if current, ok := latest[delegator]; d.Delegator == delegator && (!ok || d.Timestamp.After(current.Timestamp)) {
+				latest[delegator] = d
+			}
+		}
+	}
+	return latest, nil
+}
+
+func (f *fakeDelegationsRepository) CreateMany(ctx context.Context, d *[]models.Delegations) (int64, error) {
+	var inserted int64
+	for _, delegation := range *d {
+		if _, err := f.FindByTezosID(ctx, delegation.TezosID); err == nil {
+			continue
+		}
+		f.delegations = append(f.delegations, delegation)
+		inserted++
+	}
+	return inserted, nil
+}
+
+func (f *fakeDelegationsRepository) FillHash(ctx context.Context, tezosID int, hash string) (int64, error) {
+	for i, d := range f.delegations {
+		if d.TezosID == tezosID && d.Hash == "" {
+			f.delegations[i].Hash = hash
+			f.dataVersion++
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+func (f *fakeDelegationsRepository) FindDataVersion(ctx context.Context) (int64, error) {
+	if f.err != nil {
+		return 0, f.err
+	}
+	return f.dataVersion, nil
+}
+
+func (f *fakeDelegationsRepository) FindAvailableYear(ctx context.Context) (*[]int, error) {
+	years := []int{}
+	for _, d := range f.delegations {
+		if len(years) == 0 || years[len(years)-1] != d.Timestamp.Year() {
+			years = append(years, d.Timestamp.Year())
+		}
+	}
+	return &years, nil
+}
+
+func (f *fakeDelegationsRepository) CountFromYear(ctx context.Context, year int, maxExact int) (int64, bool, error) {
+	count := 0
+	for _, delegation := range f.delegations {
+		if year == 0 || delegation.Timestamp.Year() == year {
+			count++
+		}
+	}
+	return int64(count), count <= maxExact, nil
+}
+
+func (f *fakeDelegationsRepository) FindFromYear(ctx context.Context, year int, limit int, offset int) (*[]models.Delegations, error) {
+	f.pages++
+	d := []models.Delegations{}
+	for _, delegation := range f.delegations {
+		if delegation.Timestamp.Year() == year {
+			d = append(d, delegation)
+		}
+	}
+	d = d[min(offset, len(d)):min(offset+limit, len(d))]
+	return &d, nil
+}
+
+func (f *fakeDelegationsRepository) FindLastInserted(ctx context.Context, year int) (*models.Delegations, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	var last *models.Delegations
+	for i, d := range f.delegations {
+		if (year == 0 || d.Timestamp.Year() == year) && (last == nil || d.ID > last.ID) {
+			last = &f.delegations[i]
+		}
+	}
+	return last, nil
+}
+
+// newRouter return a router serving the `xtz` routes from stored, without database.
+func newRouter(stored []models.Delegations) *gin.Engine {
+	return newRouterWithRepository(&fakeDelegationsRepository{delegations: stored})
+}
+
+// newRouterWithRepository return a router serving the `xtz` routes from repository.
+func newRouterWithRepository(repository db.DelegationsRepository) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+
+	handler := &xtz.Handler{DelegationsClient: delegations.NewClient(tezos.NewClient(), repository, nil)}
+	handler.RegisterRouter(router)
+
+	return router
+}
+
+func TestOpenAPI_Routes(t *testing.T) {
+	doc, err := xtz.OpenAPI()
+	require.NoError(t, err)
+
+	registered := map[string]bool{}
+	for _, route := range newRouter(nil).Routes() {
+		if !strings.HasPrefix(route.Path, "/xtz/") {
+			continue
+		}
+		path := xtz.OpenAPIPath(route.Path)
+		registered[route.Method+" "+path] = true
+
+		pathItem := doc.Paths.Find(path)
+		require.NotNil(t, pathItem, "route %s %s is not documented", route.Method, path)
+		require.NotNil(t, pathItem.GetOperation(route.Method), "route %s %s is not documented", route.Method, path)
+	}
+
+	for path, pathItem := range doc.Paths.Map() {
+		for method := range pathItem.Operations() {
+			require.True(t, registered[method+" "+path], "documented operation %s %s has no route", method, path)
+		}
+	}
+}
+
+func TestOpenAPI_Responses(t *testing.T) {
+	doc, err := xtz.OpenAPI()
+	require.NoError(t, err)
+
+	documented, err := legacy.NewRouter(doc)
+	require.NoError(t, err)
+
+	router := newRouter([]models.Delegations{
+		{ID: 1, TezosID: 1, Amount: 1, Level: 1, Delegator: "foobar", Timestamp: time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC), Hash: testHash},
+		{ID: 2, TezosID: 2, Amount: 2, Level: 2, Delegator: "foobar", Timestamp: time.Date(2023, 1, 1, 11, 0, 0, 0, time.UTC)},
+	})
+
+	for _, tt := range []struct {
+		target string
+		status int
+		body   string
+	}{
+		{target: "/xtz/delegations", status: http.StatusOK},
+		{target: "/xtz/delegations?year=2023&page=1&limit=1", status: http.StatusOK},
+		{target: "/xtz/delegations?year=12", status: http.StatusBadRequest, body: `{
+			"type": "about:blank", "title": "Bad Request", "status": 400, "instance": "/xtz/delegations",
+			"detail": "invalid query parameter \"year\": number must be at least 1000",
+			"invalid-params": [{"name": "year", "reason": "number must be at least 1000"}]
+		}`},
+		{target: "/xtz/delegations?page=0", status: http.StatusBadRequest, body: `{
+			"type": "about:blank", "title": "Bad Request", "status": 400, "instance": "/xtz/delegations",
+			"detail": "invalid query parameter \"page\": number must be at least 1",
+			"invalid-params": [{"name": "page", "reason": "number must be at least 1"}]
+		}`},
+		{target: "/xtz/delegations?year=2022", status: http.StatusBadRequest, body: `{
+			"type": "about:blank", "title": "Bad Request", "status": 400, "instance": "/xtz/delegations",
+			"detail": "invalid year: no delegation stored for 2022, the available years are 2024,2023",
+			"invalid-params": [{"name": "year", "reason": "no delegation stored for 2022, the available years are 2024,2023"}]
+		}`},
+		{target: "/xtz/delegations?limit=abc", status: http.StatusBadRequest},
+		{target: "/xtz/delegations/1", status: http.StatusOK},
+		{target: "/xtz/delegations/3", status: http.StatusNotFound},
+		{target: "/xtz/delegations/0", status: http.StatusBadRequest},
+		{target: "/xtz/operations/" + testHash, status: http.StatusOK},
+		{target: "/xtz/operations/oops", status: http.StatusBadRequest},
+		{target: "/xtz/operations/" + testHash + "?refresh=maybe", status: http.StatusBadRequest},
+	} {
+		t.Run(tt.target, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			require.Equal(t, tt.status, w.Code, w.Body.String())
+			if tt.body != "" {
+				require.JSONEq(t, tt.body, w.Body.String())
+			}
+
+			route, pathParams, err := documented.FindRoute(req)
+			require.NoError(t, err)
+
+			require.NoError(t, openapi3filter.ValidateResponse(context.Background(), &openapi3filter.ResponseValidationInput{
+				RequestValidationInput: &openapi3filter.RequestValidationInput{Request: req, PathParams: pathParams, Route: route},
+				Status:                 w.Code,
+				Header:                 w.Header(),
+				Body:                   io.NopCloser(bytes.NewReader(w.Body.Bytes())),
+			}))
+		})
+	}
+}
+
+func TestDocs(t *testing.T) {
+	router := newRouter(nil)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	page := w.Body.String()
+
+	// The page only loads assets served by the API.
+	require.NotContains(t, page, "http://")
+	require.NotContains(t, page, "https://")
+
+	for _, tt := range []struct {
+		path        string
+		contentType string
+	}{
+		{path: "/docs/assets/swagger-ui-bundle.js", contentType: "javascript"},
+		{path: "/docs/assets/swagger-ui.css", contentType: "text/css"},
+	} {
+		require.Contains(t, page, tt.path)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		require.Equal(t, http.StatusOK, w.Code, tt.path)
+		require.Contains(t, w.Header().Get("Content-Type"), tt.contentType)
+		require.NotZero(t, w.Body.Len())
+	}
+}
@@ -0,0 +1,47 @@
+package xtz
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Links represent the links to the previous and the next pages, relative to the host. They are empty on the first and the last page.
+type Links struct {
+	Prev string `json:"prev,omitempty"`
+	Next string `json:"next,omitempty"`
+}
+
+// pageLinks return the links of the pages around page, keeping the other query parameters of u.
+func pageLinks(u *url.URL, page int, limit int, hasMore bool) Links {
+	var links Links
+	if page > 1 {
+		links.Prev = pageURL(u, page-1, limit)
+	}
+	if hasMore {
+		links.Next = pageURL(u, page+1, limit)
+	}
+	return links
+}
+
+// pageURL return u with the page and limit query parameters set.
+func pageURL(u *url.URL, page int, limit int) string {
+	query := u.Query()
+	query.Set("page", strconv.Itoa(page))
+	query.Set("limit", strconv.Itoa(limit))
+
+	link := url.URL{Path: u.Path, RawQuery: query.Encode()}
+	return link.String()
+}
+
+// header return the value of the `Link` header of the links, see RFC 8288.
+func (l Links) header() string {
+	var values []string
+	if l.Prev != "" {
+		values = append(values, "<"+l.Prev+`>; rel="prev"`)
+	}
+	if l.Next != "" {
+		values = append(values, "<"+l.Next+`>; rel="next"`)
+	}
+	return strings.Join(values, ", ")
+}
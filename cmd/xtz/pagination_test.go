@@ -0,0 +1,100 @@
+package xtz_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kiln-mid/cmd/xtz"
+	"github.com/kiln-mid/pkg/delegations"
+	"github.com/kiln-mid/pkg/models"
+	"github.com/kiln-mid/pkg/tezos"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler_Pagination(t *testing.T) {
+	stored := []models.Delegations{}
+	for i := 5; i > 0; i-- {
+		stored = append(stored, models.Delegations{ID: uint(i), TezosID: i, Timestamp: time.Date(2024, 1, i, 0, 0, 0, 0, time.UTC)})
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	client := delegations.NewClient(tezos.NewClient(), &fakeDelegationsRepository{delegations: stored}, nil)
+	client.SetCountLimit(3)
+	(&xtz.Handler{DelegationsClient: client}).RegisterRouter(router)
+
+	for _, tt := range []struct {
+		target         string
+		ids            []int
+		total          int64
+		totalEstimated bool
+		hasMore        bool
+		links          xtz.Links
+		link           string
+	}{
+		{
+			target:  "/xtz/delegations?limit=2",
+			ids:     []int{5, 4},
+			total:   5,
+			hasMore: true,
+			// The total is above the count limit of 3, the fake repository reports it as estimated.
+			totalEstimated: true,
+			links:          xtz.Links{Next: "/xtz/delegations?limit=2&page=2"},
+			link:           `</xtz/delegations?limit=2&page=2>; rel="next"`,
+		},
+		{
+			target:         "/xtz/delegations?year=2024&page=2&limit=2",
+			ids:            []int{3, 2},
+			total:          5,
+			totalEstimated: true,
+			hasMore:        true,
+			links:          xtz.Links{Prev: "/xtz/delegations?limit=2&page=1&year=2024", Next: "/xtz/delegations?limit=2&page=3&year=2024"},
+			link:           `</xtz/delegations?limit=2&page=1&year=2024>; rel="prev", </xtz/delegations?limit=2&page=3&year=2024>; rel="next"`,
+		},
+		{
+			// The last page gives an exact total without counting.
+			target: "/xtz/delegations?page=3&limit=2",
+			ids:    []int{1},
+			total:  5,
+			links:  xtz.Links{Prev: "/xtz/delegations?limit=2&page=2"},
+			link:   `</xtz/delegations?limit=2&page=2>; rel="prev"`,
+		},
+		{
+			target: "/xtz/delegations?page=1&limit=5",
+			ids:    []int{5, 4, 3, 2, 1},
+			total:  5,
+		},
+		{
+			target:         "/xtz/delegations?page=4&limit=2",
+			ids:            []int{},
+			total:          5,
+			totalEstimated: true,
+			links:          xtz.Links{Prev: "/xtz/delegations?limit=2&page=3"},
+			link:           `</xtz/delegations?limit=2&page=3>; rel="prev"`,
+		},
+	} {
+		t.Run(tt.target, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.target, nil))
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+			var response xtz.Response
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+
+			ids := []int{}
+			for _, d := range response.Data {
+				ids = append(ids, d.TezosID)
+			}
+			require.Equal(t, tt.ids, ids)
+			require.Equal(t, tt.total, response.Total)
+			require.Equal(t, tt.totalEstimated, response.TotalEstimated)
+			require.Equal(t, tt.hasMore, response.HasMore)
+			require.Equal(t, tt.links, response.Links)
+			require.Equal(t, tt.link, w.Header().Get("Link"))
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package xtz
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/kiln-mid/pkg/delegations"
+)
+
+// problemContentType is the media type of the error bodies, see RFC 7807.
+const problemContentType = "application/problem+json"
+
+// retryAfter is the `Retry-After` header of the 503 responses, in seconds.
+const retryAfter = "5"
+
+// Problem represent an error body following RFC 7807. Type is always `about:blank` so Title is the status text, Detail
+// explains this occurrence of the problem and InvalidParams names the parameters rejected by a 400.
+type Problem struct {
+	Type              string         `json:"type"`
+	Title             string         `json:"title"`
+	Status            int            `json:"status"`
+	Detail            string         `json:"detail,omitempty"`
+	Instance          string         `json:"instance,omitempty"`
+	InvalidParams     []InvalidParam `json:"invalid-params,omitempty"`
+	RetentionBoundary *time.Time     `json:"retention_boundary,omitempty"`
+}
+
+// InvalidParam represent a parameter rejected by a 400 and the reason why.
+type InvalidParam struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// maxBodyBytes bound the size of a request body, a lookup of 5000 addresses takes about 200KB.
+const maxBodyBytes = 1 << 20
+
+// limitBody return a gin middleware failing the reads of a request body larger than limit bytes, they are rejected with a 413.
+func limitBody(limit int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		c.Next()
+	}
+}
+
+// AbortWithProblem write p as the response and stop the handlers chain, it is shared with the administration endpoints.
+func AbortWithProblem(c *gin.Context, p Problem) {
+	p.Type = "about:blank"
+	p.Title = http.StatusText(p.Status)
+	p.Instance = c.Request.URL.Path
+
+	body, err := json.Marshal(p)
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if p.Status == http.StatusServiceUnavailable {
+		c.Header("Retry-After", retryAfter)
+	}
+	c.Abort()
+	c.Data(p.Status, problemContentType, body)
+}
+
+// AbortWithError write the problem matching err. Errors of the database or tzkt are logged and replaced by a generic detail,
+// so their messages never reach the clients.
+func AbortWithError(c *gin.Context, err error) {
+	var invalidErr *delegations.InvalidArgumentError
+	var retentionErr *delegations.OutOfRetentionError
+	switch {
+	case errors.As(err, &invalidErr):
+		AbortWithProblem(c, Problem{
+			Status:        http.StatusBadRequest,
+			Detail:        invalidErr.Error(),
+			InvalidParams: []InvalidParam{{Name: invalidErr.Field, Reason: invalidErr.Reason}},
+		})
+	case errors.As(err, &retentionErr):
+		AbortWithProblem(c, Problem{Status: http.StatusGone, Detail: retentionErr.Error(), RetentionBoundary: &retentionErr.Boundary})
+	case errors.Is(err, delegations.ErrNotFound):
+		AbortWithProblem(c, Problem{Status: http.StatusNotFound, Detail: "the resource asked is not stored"})
+	case errors.Is(err, delegations.ErrUnavailable):
+		slog.WarnContext(c.Request.Context(), "request failed", "error", err)
+		AbortWithProblem(c, Problem{Status: http.StatusServiceUnavailable, Detail: "a dependency is unavailable, retry later"})
+	default:
+		slog.ErrorContext(c.Request.Context(), "request failed", "error", err)
+		AbortWithProblem(c, Problem{Status: http.StatusInternalServerError, Detail: "the request could not be processed"})
+	}
+}
+
+// bindingProblem return the problem of an error of gin binding, a 400 naming every invalid parameter or a 413 for a body too large.
+func bindingProblem(err error) Problem {
+	problem := Problem{Status: http.StatusBadRequest, Detail: "invalid parameters"}
+
+	if problem, ok := tooLargeProblem(err); ok {
+		return problem
+	}
+
+	var validationErrs validator.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		problem.Detail = err.Error()
+		return problem
+	}
+	for _, fieldErr := range validationErrs {
+		reason := "does not satisfy " + fieldErr.Tag()
+		switch fieldErr.Tag() {
+		case "min":
+			reason = "must be at least " + fieldErr.Param()
+		case "max":
+			reason = "must be at most " + fieldErr.Param()
+		}
+		problem.InvalidParams = append(problem.InvalidParams, InvalidParam{Name: strings.ToLower(fieldErr.Field()), Reason: reason})
+	}
+	return problem
+}
+
+// tooLargeProblem return the 413 problem of err when it is caused by a body larger than allowed by limitBody.
+func tooLargeProblem(err error) (Problem, bool) {
+	var maxBytesErr *http.MaxBytesError
+	if !errors.As(err, &maxBytesErr) {
+		return Problem{}, false
+	}
+	return Problem{Status: http.StatusRequestEntityTooLarge, Detail: fmt.Sprintf("the request body is larger than %d bytes", maxBytesErr.Limit)}, true
+}
@@ -0,0 +1,47 @@
+package xtz_test
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/kiln-mid/cmd/xtz"
+	"github.com/kiln-mid/pkg/db"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler_RepositoryErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		err        error
+		status     int
+		retryAfter string
+	}{
+		{name: "database unavailable", err: &db.QueryError{Err: driver.ErrBadConn}, status: http.StatusServiceUnavailable, retryAfter: "5"},
+		{name: "failed query", err: &db.QueryError{Err: &mysql.MySQLError{Number: 1146, Message: "Table 'kiln.delegations' doesn't exist"}}, status: http.StatusInternalServerError},
+		{name: "other error", err: errors.New("secret internals"), status: http.StatusInternalServerError},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newRouterWithRepository(&fakeDelegationsRepository{err: tt.err})
+
+			req := httptest.NewRequest(http.MethodGet, "/xtz/delegations", nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			require.Equal(t, tt.status, w.Code)
+			require.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+			require.Equal(t, tt.retryAfter, w.Header().Get("Retry-After"))
+
+			var problem xtz.Problem
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+			require.Equal(t, tt.status, problem.Status)
+			require.Equal(t, http.StatusText(tt.status), problem.Title)
+			require.NotContains(t, w.Body.String(), tt.err.Error())
+			require.NotContains(t, w.Body.String(), "gorm")
+		})
+	}
+}
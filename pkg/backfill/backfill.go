@@ -0,0 +1,338 @@
+package backfill
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/kiln-mid/pkg/db"
+	"github.com/kiln-mid/pkg/delegations"
+	"github.com/kiln-mid/pkg/models"
+	"github.com/kiln-mid/pkg/tezos"
+)
+
+const (
+	// DefaultWorkers is the default number of chunks fetched in parallel.
+	DefaultWorkers = 4
+	// DefaultChunkDuration is the default duration of the chunks of a time range.
+	DefaultChunkDuration = 24 * time.Hour
+	// DefaultChunkLevels is the default number of levels of the chunks of a level range.
+	DefaultChunkLevels = 10000
+	// DefaultPageSize is the default number of delegations fetched per request.
+	DefaultPageSize = 1000
+	// DefaultProgressInterval is the default interval between two progress lines.
+	DefaultProgressInterval = 10 * time.Second
+)
+
+// TezosGenesis is the timestamp of the first block of the tezos mainnet, no delegation exists before.
+var TezosGenesis = time.Date(2018, 6, 30, 17, 39, 57, 0, time.UTC)
+
+// Range is the range of a backfill, either a time range [From, To) or a level range [FromLevel, ToLevel).
+type Range struct {
+	From      time.Time
+	To        time.Time
+	FromLevel int
+	ToLevel   int
+}
+
+// IsLevel report whether the range is a level range.
+func (r Range) IsLevel() bool {
+	return r.FromLevel != 0 || r.ToLevel != 0
+}
+
+// Validate check the range is a non empty time range between the tezos genesis and now, or a non empty level range.
+func (r Range) Validate(now time.Time) error {
+	if r.IsLevel() {
+		if !r.From.IsZero() || !r.To.IsZero() {
+			return errors.New("a range is either a time range or a level range")
+		}
+		if r.FromLevel < 1 {
+			return fmt.Errorf("from level %d must be greater than 0", r.FromLevel)
+		}
+		if r.ToLevel <= r.FromLevel {
+			return fmt.Errorf("to level %d must be greater than from level %d", r.ToLevel, r.FromLevel)
+		}
+		return nil
+	}
+
+	if r.From.IsZero() || r.To.IsZero() {
+		return errors.New("from and to are required")
+	}
+	if !r.From.Before(r.To) {
+		return fmt.Errorf("from %s must be before to %s", r.From, r.To)
+	}
+	if r.To.Before(TezosGenesis) {
+		return fmt.Errorf("to %s is before the tezos genesis %s", r.To, TezosGenesis)
+	}
+	if r.From.After(now) {
+		return fmt.Errorf("from %s is in the future", r.From)
+	}
+	return nil
+}
+
+// Job return the identifier of the backfill of the range, chunks are checkpointed under this identifier.
+func (r Range) Job(chunkDuration time.Duration, chunkLevels int) string {
+	if r.IsLevel() {
+		return fmt.Sprintf("level:%d-%d/%d", r.FromLevel, r.ToLevel, chunkLevels)
+	}
+	return fmt.Sprintf("time:%s-%s/%s", r.From.UTC().Format(time.RFC3339), r.To.UTC().Format(time.RFC3339), chunkDuration)
+}
+
+// Split cut the range into consecutive pending chunks of chunkDuration or chunkLevels, the last chunk may be shorter.
+func (r Range) Split(job string, chunkDuration time.Duration, chunkLevels int) []models.BackfillChunk {
+	chunks := []models.BackfillChunk{}
+
+	if r.IsLevel() {
+		for from := r.FromLevel; from < r.ToLevel; from += chunkLevels {
+			chunks = append(chunks, models.BackfillChunk{
+				Job:       job,
+				Number:    len(chunks),
+				FromLevel: from,
+				ToLevel:   min(from+chunkLevels, r.ToLevel),
+				Status:    models.BackfillChunkPending,
+			})
+		}
+		return chunks
+	}
+
+	for from := r.From.UTC(); from.Before(r.To); from = from.Add(chunkDuration) {
+		chunkFrom, chunkTo := from, from.Add(chunkDuration)
+		if chunkTo.After(r.To) {
+			chunkTo = r.To.UTC()
+		}
+		chunks = append(chunks, models.BackfillChunk{
+			Job:    job,
+			Number: len(chunks),
+			From:   &chunkFrom,
+			To:     &chunkTo,
+			Status: models.BackfillChunkPending,
+		})
+	}
+	return chunks
+}
+
+// Options represent how a backfill is split and run, default values are used for fields equal to 0.
+// Progress receive a progress line every ProgressInterval, nothing is written when nil.
+type Options struct {
+	Workers          int
+	ChunkDuration    time.Duration
+	ChunkLevels      int
+	PageSize         int
+	ProgressInterval time.Duration
+	Progress         io.Writer
+}
+
+// withDefaults return the options with default values applied to fields equal to 0.
+func (o Options) withDefaults() Options {
+	if o.Workers <= 0 {
+		o.Workers = DefaultWorkers
+	}
+	if o.ChunkDuration <= 0 {
+		o.ChunkDuration = DefaultChunkDuration
+	}
+	if o.ChunkLevels <= 0 {
+		o.ChunkLevels = DefaultChunkLevels
+	}
+	if o.PageSize <= 0 {
+		o.PageSize = DefaultPageSize
+	}
+	if o.ProgressInterval <= 0 {
+		o.ProgressInterval = DefaultProgressInterval
+	}
+	return o
+}
+
+// Report is the outcome of a backfill run.
+type Report struct {
+	Job     string
+	Chunks  int
+	Resumed int
+	Created int64
+}
+
+// Backfiller fetch the delegations of a range from tzkt chunk by chunk, with chunks fetched in parallel and checkpointed in the database.
+type Backfiller struct {
+	options            Options
+	delegationsClient  *delegations.Client
+	backfillRepository db.BackfillRepository
+	now                func() time.Time
+}
+
+// NewBackfiller return a new Backfiller storing delegations through delegationsClient and checkpointing chunks with br.
+// Parallel chunks share the tzkt client of delegationsClient, and so its rate limit.
+func NewBackfiller(delegationsClient *delegations.Client, br db.BackfillRepository, options Options) *Backfiller {
+	return &Backfiller{
+		options:            options.withDefaults(),
+		delegationsClient:  delegationsClient,
+		backfillRepository: br,
+		now:                time.Now,
+	}
+}
+
+// Run backfill the range. Chunks are recorded on the first run, a later run of the same range only fetches the chunks left pending,
+// each from its last checkpoint. The first chunk error stops the other workers and is returned, the progress is kept.
+func (b *Backfiller) Run(ctx context.Context, r Range) (Report, error) {
+	if err := r.Validate(b.now()); err != nil {
+		return Report{}, err
+	}
+
+	job := r.Job(b.options.ChunkDuration, b.options.ChunkLevels)
+	report := Report{Job: job}
+
+	chunks, err := b.backfillRepository.FindChunks(ctx, job)
+	if err != nil {
+		return report, fmt.Errorf("backfillRepository FindChunks: %w", err)
+	}
+
+	if len(chunks) == 0 {
+		if err := b.backfillRepository.CreateChunks(ctx, r.Split(job, b.options.ChunkDuration, b.options.ChunkLevels)); err != nil {
+			return report, fmt.Errorf("backfillRepository CreateChunks: %w", err)
+		}
+
+		if chunks, err = b.backfillRepository.FindChunks(ctx, job); err != nil {
+			return report, fmt.Errorf("backfillRepository FindChunks: %w", err)
+		}
+	}
+
+	pending := []models.BackfillChunk{}
+	for _, chunk := range chunks {
+		if chunk.Status != models.BackfillChunkDone {
+			pending = append(pending, chunk)
+		}
+	}
+	report.Chunks = len(chunks)
+	report.Resumed = len(chunks) - len(pending)
+
+	progress := newProgress(len(chunks), report.Resumed, b.now())
+	stopProgress := b.reportProgress(progress)
+	defer stopProgress()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	queue := make(chan models.BackfillChunk)
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+
+	for range b.options.Workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for chunk := range queue {
+				if err := b.runChunk(ctx, chunk, progress); err != nil {
+					errOnce.Do(func() {
+						firstErr = fmt.Errorf("chunk %d: %w", chunk.Number, err)
+						cancel()
+					})
+				}
+			}
+		}()
+	}
+
+	for _, chunk := range pending {
+		select {
+		case queue <- chunk:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	report.Created = progress.Snapshot(b.now()).Created
+
+	if firstErr != nil {
+		return report, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+// runChunk page through the delegations of a chunk by operation id, store them and checkpoint the chunk after each page.
+// Pages are chained on the operations returned by tzkt, a page whose delegations are all skipped does not end the chunk.
+func (b *Backfiller) runChunk(ctx context.Context, chunk models.BackfillChunk, progress *Progress) error {
+	options := tezos.TezosDelegationsOption{
+		FromLevel:     chunk.FromLevel,
+		BeforeLevel:   chunk.ToLevel,
+		IDGreaterThan: chunk.LastOperationID,
+		Limit:         b.options.PageSize,
+	}
+	if chunk.From != nil && chunk.To != nil {
+		options.From, options.Before = *chunk.From, *chunk.To
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		delegations, last, err := b.delegationsClient.PollPage(ctx, options)
+		if err != nil {
+			return fmt.Errorf("PollPage: %w", err)
+		}
+
+		if last.ID == 0 {
+			chunk.Status = models.BackfillChunkDone
+			if err := b.backfillRepository.SaveProgress(ctx, &chunk); err != nil {
+				return fmt.Errorf("backfillRepository SaveProgress: %w", err)
+			}
+			progress.ChunkDone()
+			return nil
+		}
+
+		var nbCreated int64
+		if len(delegations) > 0 {
+			nbCreated, err = b.delegationsClient.Create(ctx, delegations)
+			if err != nil {
+				return fmt.Errorf("create: %w", err)
+			}
+			progress.Add(nbCreated)
+		}
+
+		options.IDGreaterThan = last.ID
+		chunk.LastOperationID = options.IDGreaterThan
+		chunk.Rows += nbCreated
+		if err := b.backfillRepository.SaveProgress(ctx, &chunk); err != nil {
+			return fmt.Errorf("backfillRepository SaveProgress: %w", err)
+		}
+	}
+}
+
+// reportProgress write a progress line every ProgressInterval until the returned function is called, which writes a last line.
+func (b *Backfiller) reportProgress(progress *Progress) func() {
+	if b.options.Progress == nil {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(b.options.ProgressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				fmt.Fprintln(b.options.Progress, progress.Snapshot(b.now()))
+			case <-done:
+				fmt.Fprintln(b.options.Progress, progress.Snapshot(b.now()))
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
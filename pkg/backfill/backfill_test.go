@@ -0,0 +1,212 @@
+package backfill
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/h2non/gock"
+	"github.com/kiln-mid/pkg/db"
+	"github.com/kiln-mid/pkg/delegations"
+	"github.com/kiln-mid/pkg/models"
+	"github.com/kiln-mid/pkg/tezos"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeDelegationsRepository struct {
+	db.DelegationsRepository
+	mu      sync.Mutex
+	created []models.Delegations
+}
+
+func (f *fakeDelegationsRepository) CreateMany(ctx context.Context, d *[]models.Delegations) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.created = append(f.created, *d...)
+	return int64(len(*d)), nil
+}
+
+type fakeBackfillRepository struct {
+	mu     sync.Mutex
+	chunks []models.BackfillChunk
+}
+
+func (f *fakeBackfillRepository) CreateChunks(ctx context.Context, chunks []models.BackfillChunk) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := range chunks {
+		chunks[i].ID = uint(len(f.chunks) + 1)
+		f.chunks = append(f.chunks, chunks[i])
+	}
+	return nil
+}
+
+func (f *fakeBackfillRepository) FindChunks(ctx context.Context, job string) ([]models.BackfillChunk, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	chunks := []models.BackfillChunk{}
+	for _, chunk := range f.chunks {
+		if chunk.Job == job {
+			chunks = append(chunks, chunk)
+		}
+	}
+	return chunks, nil
+}
+
+func (f *fakeBackfillRepository) SaveProgress(ctx context.Context, chunk *models.BackfillChunk) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.chunks[chunk.ID-1] = *chunk
+	return nil
+}
+
+func TestRange_Split(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 1, 3, 12, 0, 0, 0, time.UTC)
+
+	chunks := Range{From: from, To: to}.Split("job", 24*time.Hour, 0)
+	require.Len(t, chunks, 3)
+	require.Equal(t, from, *chunks[0].From)
+	require.Equal(t, from.AddDate(0, 0, 1), *chunks[0].To)
+	require.Equal(t, from.AddDate(0, 0, 2), *chunks[2].From)
+	require.Equal(t, to, *chunks[2].To)
+	require.Equal(t, 2, chunks[2].Number)
+
+	chunks = Range{FromLevel: 100, ToLevel: 250}.Split("job", 0, 100)
+	require.Len(t, chunks, 2)
+	require.Equal(t, 100, chunks[0].FromLevel)
+	require.Equal(t, 200, chunks[0].ToLevel)
+	require.Equal(t, 200, chunks[1].FromLevel)
+	require.Equal(t, 250, chunks[1].ToLevel)
+	require.Nil(t, chunks[1].From)
+}
+
+func TestRange_Validate(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, tt := range []struct {
+		name  string
+		r     Range
+		valid bool
+	}{
+		{name: "time range", r: Range{From: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), To: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)}, valid: true},
+		{name: "level range", r: Range{FromLevel: 1, ToLevel: 10}, valid: true},
+		{name: "missing to", r: Range{From: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}},
+		{name: "reversed", r: Range{From: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), To: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}},
+		{name: "before genesis", r: Range{From: time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC), To: time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)}},
+		{name: "in the future", r: Range{From: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), To: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}},
+		{name: "empty level range", r: Range{FromLevel: 10, ToLevel: 10}},
+		{name: "mixed", r: Range{From: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), ToLevel: 10}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.r.Validate(now)
+			if tt.valid {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestSnapshot_ETA(t *testing.T) {
+	p := newProgress(10, 2, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	require.Equal(t, time.Duration(-1), p.Snapshot(time.Date(2024, 1, 1, 0, 1, 0, 0, time.UTC)).ETA)
+
+	p.ChunkDone()
+	p.ChunkDone()
+	p.Add(500)
+
+	snapshot := p.Snapshot(time.Date(2024, 1, 1, 0, 1, 0, 0, time.UTC))
+	require.Equal(t, 4, snapshot.Done)
+	require.Equal(t, 3*time.Minute, snapshot.ETA)
+	require.Equal(t, "chunks 4/10 (40.0%), 500 delegations created, 8/s, ETA 3m0s", snapshot.String())
+}
+
+func TestBackfiller_Resume(t *testing.T) {
+	defer gock.Off()
+	gock.DisableNetworking()
+	gock.Intercept()
+
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	r := Range{From: from, To: from.AddDate(0, 0, 2)}
+
+	// The first day is done and the second one stopped after the operation 10.
+	backfillRepository := &fakeBackfillRepository{}
+	chunks := r.Split(r.Job(24*time.Hour, DefaultChunkLevels), 24*time.Hour, DefaultChunkLevels)
+	chunks[0].Status = models.BackfillChunkDone
+	chunks[1].LastOperationID = 10
+	require.NoError(t, backfillRepository.CreateChunks(context.Background(), chunks))
+
+	gock.New("https://api.tzkt.io").Get("/v1/operations/delegations").
+		MatchParam("timestamp.ge", from.AddDate(0, 0, 1).Format(time.RFC3339)).
+		MatchParam("id.gt", "10").
+		Reply(200).BodyString(`[{"id": 11, "level": 5, "timestamp": "2024-01-02T10:00:00Z", "sender": {"address": "foobar"}, "amount": 1}]`)
+	gock.New("https://api.tzkt.io").Get("/v1/operations/delegations").
+		MatchParam("timestamp.ge", from.AddDate(0, 0, 1).Format(time.RFC3339)).
+		MatchParam("id.gt", "11").
+		Reply(200).BodyString(`[]`)
+
+	delegationsRepository := &fakeDelegationsRepository{}
+	backfiller := NewBackfiller(delegations.NewClient(tezos.NewClient(), delegationsRepository, nil), backfillRepository, Options{Workers: 2})
+	backfiller.now = func() time.Time { return from.AddDate(0, 1, 0) }
+
+	report, err := backfiller.Run(context.Background(), r)
+	require.NoError(t, err)
+	require.Equal(t, Report{Job: "time:2024-01-01T00:00:00Z-2024-01-03T00:00:00Z/24h0m0s", Chunks: 2, Resumed: 1, Created: 1}, report)
+	require.Len(t, delegationsRepository.created, 1)
+	require.Equal(t, 11, delegationsRepository.created[0].TezosID)
+
+	for _, chunk := range backfillRepository.chunks {
+		require.Equal(t, models.BackfillChunkDone, chunk.Status)
+	}
+	require.Equal(t, 11, backfillRepository.chunks[1].LastOperationID)
+	require.Equal(t, int64(1), backfillRepository.chunks[1].Rows)
+	require.True(t, gock.IsDone())
+}
+
+func TestBackfiller_SkippedOperations(t *testing.T) {
+	defer gock.Off()
+	gock.DisableNetworking()
+	gock.Intercept()
+
+	r := Range{FromLevel: 1, ToLevel: 100}
+	page := func(idGreaterThan string, body string) {
+		request := gock.New("https://api.tzkt.io").Get("/v1/operations/delegations").
+			MatchParam("level.ge", "1").
+			MatchParam("level.lt", "100")
+		if idGreaterThan != "" {
+			request.MatchParam("id.gt", idGreaterThan)
+		}
+		request.Reply(200).BodyString(body)
+	}
+	page("", `[
+		{"id": 10, "level": 5, "timestamp": "2024-01-02T10:00:00Z", "sender": {"address": "foo"}, "amount": 1},
+		{"id": 11, "level": 5, "timestamp": "2024-01-02T10:00:00Z", "sender": {}, "amount": 2}
+	]`)
+	// Every delegation of the page is skipped, the chunk goes on after the last operation of the page.
+	page("11", `[{"id": 12, "level": 6, "timestamp": "2024-01-02T11:00:00Z", "sender": {}, "amount": 3}]`)
+	page("12", `[{"id": 13, "level": 7, "timestamp": "2024-01-02T12:00:00Z", "sender": {"address": "bar"}, "amount": 4}]`)
+	page("13", `[]`)
+
+	backfillRepository := &fakeBackfillRepository{}
+	delegationsRepository := &fakeDelegationsRepository{}
+	backfiller := NewBackfiller(delegations.NewClient(tezos.NewClient(), delegationsRepository, nil), backfillRepository, Options{Workers: 1})
+
+	report, err := backfiller.Run(context.Background(), r)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), report.Created)
+	require.True(t, gock.IsDone())
+
+	tezosIDs := []int{}
+	for _, d := range delegationsRepository.created {
+		tezosIDs = append(tezosIDs, d.TezosID)
+	}
+	require.Equal(t, []int{10, 13}, tezosIDs)
+
+	require.Len(t, backfillRepository.chunks, 1)
+	require.Equal(t, models.BackfillChunkDone, backfillRepository.chunks[0].Status)
+	require.Equal(t, 13, backfillRepository.chunks[0].LastOperationID)
+	require.Equal(t, int64(2), backfillRepository.chunks[0].Rows)
+}
@@ -0,0 +1,90 @@
+package backfill
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Progress count the chunks and delegations of a backfill run, it is safe for concurrent use.
+type Progress struct {
+	mu      sync.Mutex
+	total   int
+	resumed int
+	done    int
+	created int64
+	start   time.Time
+}
+
+// newProgress return the progress of a run of total chunks, resumed of them being already done by a previous run.
+func newProgress(total int, resumed int, start time.Time) *Progress {
+	return &Progress{total: total, resumed: resumed, start: start}
+}
+
+// ChunkDone count a chunk completed by this run.
+func (p *Progress) ChunkDone() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done++
+}
+
+// Add count delegations created by this run.
+func (p *Progress) Add(created int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.created += created
+}
+
+// Snapshot return the progress at now.
+func (p *Progress) Snapshot(now time.Time) Snapshot {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return Snapshot{
+		Total:   p.total,
+		Done:    p.resumed + p.done,
+		Created: p.created,
+		Elapsed: now.Sub(p.start),
+		ETA:     eta(p.total-p.resumed-p.done, p.done, now.Sub(p.start)),
+	}
+}
+
+// eta estimate the time left to complete remaining chunks from the time taken by the done ones, -1 when no chunk is done yet.
+func eta(remaining int, done int, elapsed time.Duration) time.Duration {
+	if remaining <= 0 {
+		return 0
+	}
+	if done == 0 {
+		return -1
+	}
+	return time.Duration(float64(elapsed) / float64(done) * float64(remaining)).Round(time.Second)
+}
+
+// Snapshot is the progress of a backfill run at a point in time.
+type Snapshot struct {
+	Total   int
+	Done    int
+	Created int64
+	Elapsed time.Duration
+	// ETA is the estimated time left, -1 when it cannot be estimated yet.
+	ETA time.Duration
+}
+
+// String return a progress line like `chunks 12/100 (12.0%), 34567 delegations created, 1234/s, ETA 5m0s`.
+func (s Snapshot) String() string {
+	percent := 100.0
+	if s.Total > 0 {
+		percent = float64(s.Done) / float64(s.Total) * 100
+	}
+
+	rate := 0.0
+	if s.Elapsed > 0 {
+		rate = float64(s.Created) / s.Elapsed.Seconds()
+	}
+
+	eta := "unknown"
+	if s.ETA >= 0 {
+		eta = s.ETA.String()
+	}
+
+	return fmt.Sprintf("chunks %d/%d (%.1f%%), %d delegations created, %.0f/s, ETA %s", s.Done, s.Total, percent, s.Created, rate, eta)
+}
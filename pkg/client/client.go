@@ -0,0 +1,288 @@
+// Package client is the Go client of the kiln delegations API.
+//
+// It covers the `xtz` routes served by `kiln serve`: listing delegations with filters and pagination, iterating through
+// every page, getting a single delegation by operation id or hash and the latest delegation of many delegators at once. The API has no statistics nor streaming endpoint, so the client does not offer them.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kiln-mid/pkg/models"
+)
+
+const (
+	// DefaultTimeout is the timeout of the HTTP client used when none is given.
+	DefaultTimeout = 30 * time.Second
+	// DefaultMaxRetries is the default number of retries of a request which failed with a transient error.
+	DefaultMaxRetries = 3
+	// DefaultRetryDelay is the default delay before the first retry, it doubles after each retry.
+	DefaultRetryDelay = 200 * time.Millisecond
+	// MaxLookupAddresses is the number of addresses accepted by LookupDelegators.
+	MaxLookupAddresses = 5000
+	// maxRetryDelay bound the delay between two retries, including the one asked by a `Retry-After` header.
+	maxRetryDelay = 30 * time.Second
+)
+
+// Doer performs an HTTP request, it is implemented by *http.Client.
+type Doer interface {
+	Do(*http.Request) (*http.Response, error)
+}
+
+// Client call the kiln delegations API, it is safe for concurrent use.
+type Client struct {
+	baseURL    *url.URL
+	http       Doer
+	maxRetries int
+	retryDelay time.Duration
+	userAgent  string
+}
+
+// Option configure a Client.
+type Option func(c *Client)
+
+// WithHTTPClient make the client send its requests with doer, an *http.Client with DefaultTimeout is used otherwise.
+func WithHTTPClient(doer Doer) Option {
+	return func(c *Client) {
+		c.http = doer
+	}
+}
+
+// WithRetry set the number of retries of a request which failed with a transient error and the delay before the first retry,
+// the delay doubles after each retry. maxRetries equal to 0 disables the retries.
+func WithRetry(maxRetries int, delay time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = maxRetries
+		c.retryDelay = delay
+	}
+}
+
+// WithUserAgent set the `User-Agent` header of the requests, so the API logs tell which service calls it.
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) {
+		c.userAgent = userAgent
+	}
+}
+
+// New return a client of the API served at baseURL, like `http://localhost:8080`.
+func New(baseURL string, options ...Option) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid base URL %q: the scheme must be http or https", baseURL)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+
+	c := &Client{
+		baseURL:    u,
+		http:       &http.Client{Timeout: DefaultTimeout},
+		maxRetries: DefaultMaxRetries,
+		retryDelay: DefaultRetryDelay,
+		userAgent:  "kiln-go-client",
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c, nil
+}
+
+// ListOptions filter and paginate the delegations listed, fields equal to 0 are not sent so the API defaults apply.
+// Year only lists the delegations of that year, Page starts at 1 and Limit is the number of delegations per page.
+type ListOptions struct {
+	Year  int
+	Page  int
+	Limit int
+}
+
+// values return the query parameters of the options.
+func (o ListOptions) values() url.Values {
+	values := url.Values{}
+	if o.Year != 0 {
+		values.Set("year", strconv.Itoa(o.Year))
+	}
+	if o.Page != 0 {
+		values.Set("page", strconv.Itoa(o.Page))
+	}
+	if o.Limit != 0 {
+		values.Set("limit", strconv.Itoa(o.Limit))
+	}
+	return values
+}
+
+// DelegationsPage is a page of delegations, most recent first.
+// Total is the number of delegations matching the options, estimated by the API when TotalEstimated is set.
+type DelegationsPage struct {
+	Data           []models.Delegations `json:"data"`
+	Page           int                  `json:"Page"`
+	Limit          int                  `json:"limit"`
+	Total          int64                `json:"total"`
+	TotalEstimated bool                 `json:"total_estimated"`
+	HasMore        bool                 `json:"has_more"`
+	Links          PageLinks            `json:"links"`
+}
+
+// PageLinks are the links, relative to the base URL, of the pages around a page. They are empty on the first and the last page.
+type PageLinks struct {
+	Prev string `json:"prev,omitempty"`
+	Next string `json:"next,omitempty"`
+}
+
+// ListDelegations return a page of delegations matching options.
+func (c *Client) ListDelegations(ctx context.Context, options ListOptions) (*DelegationsPage, error) {
+	var page DelegationsPage
+	if err := c.get(ctx, "/xtz/delegations", options.values(), &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// GetDelegation return the delegation whose tzkt operation id is id, an error matching ErrNotFound is returned if it is not stored.
+// With refresh, a delegation which is not stored is fetched from tzkt and stored by the API.
+func (c *Client) GetDelegation(ctx context.Context, id int, refresh bool) (*models.Delegations, error) {
+	var d models.Delegations
+	if err := c.get(ctx, "/xtz/delegations/"+strconv.Itoa(id), refreshValues(refresh), &d); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// GetOperation return the delegation of the operation whose hash is hash, an error matching ErrNotFound is returned if it is not stored.
+// With refresh, a delegation which is not stored is fetched from tzkt and stored by the API.
+func (c *Client) GetOperation(ctx context.Context, hash string, refresh bool) (*models.Delegations, error) {
+	var d models.Delegations
+	if err := c.get(ctx, "/xtz/operations/"+url.PathEscape(hash), refreshValues(refresh), &d); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// refreshValues return the query parameters of a single delegation lookup.
+func refreshValues(refresh bool) url.Values {
+	values := url.Values{}
+	if refresh {
+		values.Set("refresh", "true")
+	}
+	return values
+}
+
+// LookupResult is the latest delegation of a delegator, Delegation is nil when none is stored.
+type LookupResult struct {
+	Address    string              `json:"address"`
+	Delegation *models.Delegations `json:"delegation"`
+}
+
+// LookupDelegators return the latest delegation of every address, in the order of addresses, with a single request.
+// The API accepts up to MaxLookupAddresses addresses.
+func (c *Client) LookupDelegators(ctx context.Context, addresses []string) ([]LookupResult, error) {
+	body, err := json.Marshal(struct {
+		Addresses []string `json:"addresses"`
+	}{addresses})
+	if err != nil {
+		return nil, fmt.Errorf("encode request: %w", err)
+	}
+
+	var response struct {
+		Data []LookupResult `json:"data"`
+	}
+	if err := c.send(ctx, http.MethodPost, "/xtz/delegators/lookup", nil, body, &response); err != nil {
+		return nil, err
+	}
+	return response.Data, nil
+}
+
+// get send a GET request to path and decode the JSON response into out, transient failures are retried.
+func (c *Client) get(ctx context.Context, path string, query url.Values, out any) error {
+	return c.send(ctx, http.MethodGet, path, query, nil, out)
+}
+
+// send a request to path with the JSON body, if any, and decode the JSON response into out, transient failures are retried.
+// Only requests which change nothing, like a lookup, are sent so every method can be retried.
+func (c *Client) send(ctx context.Context, method string, path string, query url.Values, body []byte, out any) error {
+	u := *c.baseURL
+	u.Path += path
+	u.RawQuery = query.Encode()
+
+	for attempt := 0; ; attempt++ {
+		err := c.do(ctx, method, u.String(), body, out)
+		if err == nil {
+			return nil
+		}
+
+		delay, retry := c.retryAfter(err, attempt)
+		if !retry {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// retryAfter report whether a request which failed with err on the given attempt, starting at 0, is retried and after which delay.
+func (c *Client) retryAfter(err error, attempt int) (time.Duration, bool) {
+	if attempt >= c.maxRetries || !isTransient(err) {
+		return 0, false
+	}
+
+	delay := c.retryDelay << attempt
+	// A random jitter of up to half the delay spreads the retries of concurrent callers.
+	delay += time.Duration(rand.Int64N(int64(delay)/2 + 1))
+	if apiErr, ok := err.(*APIError); ok && apiErr.RetryAfter > 0 {
+		delay = apiErr.RetryAfter
+	}
+	return min(delay, maxRetryDelay), true
+}
+
+// do send a single request and decode the JSON response into out.
+func (c *Client) do(ctx context.Context, method string, u string, body []byte, out any) error {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return fmt.Errorf("new request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json, application/problem+json")
+	req.Header.Set("User-Agent", c.userAgent)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return &TransportError{Err: err}
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return &TransportError{Err: fmt.Errorf("read body: %w", err)}
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return newAPIError(resp, respBody)
+	}
+
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	return nil
+}
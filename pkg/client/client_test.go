@@ -0,0 +1,302 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kiln-mid/cmd/xtz"
+	"github.com/kiln-mid/pkg/client"
+	"github.com/kiln-mid/pkg/db"
+	"github.com/kiln-mid/pkg/delegations"
+	"github.com/kiln-mid/pkg/models"
+	"github.com/kiln-mid/pkg/tezos"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeDelegationsRepository struct {
+	db.DelegationsRepository
+	delegations []models.Delegations
+}
+
+func (f *fakeDelegationsRepository) FindAndOrderByTimestamp(ctx context.Context, limit int, offset int) (*[]models.Delegations, error) {
+	d := f.delegations[min(offset, len(f.delegations)):min(offset+limit, len(f.delegations))]
+	return &d, nil
+}
+
+func (f *fakeDelegationsRepository) FindByTezosID(ctx context.Context, tezosID int) (*models.Delegations, error) {
+	for _, d := range f.delegations {
+		if d.TezosID == tezosID {
+			return &d, nil
+		}
+	}
+	return nil, db.ErrNotFound
+}
+
+func (f *fakeDelegationsRepository) FindLatestByDelegators(ctx context.Context, delegators []string) (map[string]models.Delegations, error) {
+	latest := map[string]models.Delegations{}
+	for _, delegator := range delegators {
+		for _, d := range f.delegations {
+			if current, ok := latest[delegator]; d.Delegator == delegator && (!ok || d.Timestamp.After(current.Timestamp)) {
+				latest[delegator] = d
+			}
+		}
+	}
+	return latest, nil
+}
+
+func (f *fakeDelegationsRepository) FindLastInserted(ctx context.Context, year int) (*models.Delegations, error) {
+	var last *models.Delegations
+	for i, d := range f.delegations {
+		if (year == 0 || d.Timestamp.Year() == year) && (last == nil || d.ID > last.ID) {
+			last = &f.delegations[i]
+		}
+	}
+	return last, nil
+}
+
+func (f *fakeDelegationsRepository) FindDataVersion(ctx context.Context) (int64, error) {
+	return 0, nil
+}
+
+func (f *fakeDelegationsRepository) FindAvailableYear(ctx context.Context) (*[]int, error) {
+	years := []int{}
+	for _, d := range f.delegations {
+		if len(years) == 0 || years[len(years)-1] != d.Timestamp.Year() {
+			years = append(years, d.Timestamp.Year())
+		}
+	}
+	return &years, nil
+}
+
+func (f *fakeDelegationsRepository) CountFromYear(ctx context.Context, year int, maxExact int) (int64, bool, error) {
+	count := 0
+	for _, delegation := range f.delegations {
+		if year == 0 || delegation.Timestamp.Year() == year {
+			count++
+		}
+	}
+	return int64(count), count <= maxExact, nil
+}
+
+func (f *fakeDelegationsRepository) FindFromYear(ctx context.Context, year int, limit int, offset int) (*[]models.Delegations, error) {
+	d := []models.Delegations{}
+	for _, delegation := range f.delegations {
+		if delegation.Timestamp.Year() == year {
+			d = append(d, delegation)
+		}
+	}
+	d = d[min(offset, len(d)):min(offset+limit, len(d))]
+	return &d, nil
+}
+
+// delegator is the address of the delegator of the stored delegations.
+var delegator = "tz1" + strings.Repeat("a", 33)
+
+// stored return n delegations per year for 2022 and 2021, most recent first.
+func stored(n int) []models.Delegations {
+	d := []models.Delegations{}
+	for _, year := range []int{2022, 2021} {
+		for i := 0; i < n; i++ {
+			d = append(d, models.Delegations{
+				TezosID:   year*1000 + n - i,
+				Timestamp: time.Date(year, 6, 1, 0, 0, n-i, 0, time.UTC),
+				Amount:    1000,
+				Delegator: delegator,
+				Level:     year*1000 + n - i,
+			})
+		}
+	}
+	return d
+}
+
+// newServer return a server of the `xtz` routes registered by the real router, from the stored delegations.
+// wrap, when not nil, wraps the router to inject failures.
+func newServer(t *testing.T, delegationsStored []models.Delegations, wrap func(http.Handler) http.Handler) *httptest.Server {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+
+	repository := &fakeDelegationsRepository{delegations: delegationsStored}
+	handler := &xtz.Handler{DelegationsClient: delegations.NewClient(tezos.NewClient(), repository, nil)}
+	handler.RegisterRouter(router)
+
+	var h http.Handler = router
+	if wrap != nil {
+		h = wrap(router)
+	}
+	server := httptest.NewServer(h)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestClient_New(t *testing.T) {
+	_, err := client.New("localhost:8080")
+	require.Error(t, err)
+
+	_, err = client.New("http://localhost:8080/")
+	require.NoError(t, err)
+}
+
+func TestClient_ListDelegations(t *testing.T) {
+	server := newServer(t, stored(5), nil)
+	c, err := client.New(server.URL)
+	require.NoError(t, err)
+
+	page, err := c.ListDelegations(context.Background(), client.ListOptions{})
+	require.NoError(t, err)
+	require.Equal(t, 1, page.Page)
+	require.Len(t, page.Data, 10)
+	require.EqualValues(t, 10, page.Total)
+	require.False(t, page.HasMore)
+
+	page, err = c.ListDelegations(context.Background(), client.ListOptions{Year: 2021, Page: 2, Limit: 2})
+	require.NoError(t, err)
+	require.Equal(t, 2, page.Page)
+	require.Len(t, page.Data, 2)
+	require.Equal(t, 2021003, page.Data[0].TezosID)
+	require.Equal(t, 2021002, page.Data[1].TezosID)
+	require.EqualValues(t, 5, page.Total)
+	require.True(t, page.HasMore)
+	require.Equal(t, client.PageLinks{Prev: "/xtz/delegations?limit=2&page=1&year=2021", Next: "/xtz/delegations?limit=2&page=3&year=2021"}, page.Links)
+}
+
+func TestClient_IterateDelegations(t *testing.T) {
+	server := newServer(t, stored(5), nil)
+	c, err := client.New(server.URL)
+	require.NoError(t, err)
+
+	ids := []int{}
+	it := c.IterateDelegations(client.ListOptions{Year: 2022, Limit: 2})
+	for it.Next(context.Background()) {
+		ids = append(ids, it.Delegation().TezosID)
+	}
+	require.NoError(t, it.Err())
+	require.Equal(t, []int{2022005, 2022004, 2022003, 2022002, 2022001}, ids)
+
+	// A last page full of delegations ends the iteration without requesting an empty page.
+	var calls atomic.Int32
+	server = newServer(t, stored(5), func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			next.ServeHTTP(w, r)
+		})
+	})
+	c, err = client.New(server.URL)
+	require.NoError(t, err)
+
+	count := 0
+	it = c.IterateDelegations(client.ListOptions{Year: 2021, Limit: 5})
+	for it.Next(context.Background()) {
+		count++
+	}
+	require.NoError(t, it.Err())
+	require.Equal(t, 5, count)
+	require.EqualValues(t, 1, calls.Load())
+}
+
+func TestClient_GetDelegation(t *testing.T) {
+	server := newServer(t, stored(1), nil)
+	c, err := client.New(server.URL)
+	require.NoError(t, err)
+
+	d, err := c.GetDelegation(context.Background(), 2021001, false)
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2021, 6, 1, 0, 0, 1, 0, time.UTC), d.Timestamp)
+
+	_, err = c.GetDelegation(context.Background(), 7, false)
+	require.ErrorIs(t, err, client.ErrNotFound)
+}
+
+func TestClient_LookupDelegators(t *testing.T) {
+	server := newServer(t, stored(2), nil)
+	c, err := client.New(server.URL)
+	require.NoError(t, err)
+
+	unknown := "tz1" + strings.Repeat("b", 33)
+	results, err := c.LookupDelegators(context.Background(), []string{unknown, delegator})
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	require.Equal(t, unknown, results[0].Address)
+	require.Nil(t, results[0].Delegation)
+	require.Equal(t, delegator, results[1].Address)
+	require.Equal(t, 2022002, results[1].Delegation.TezosID)
+
+	_, err = c.LookupDelegators(context.Background(), []string{"tz1"})
+	require.ErrorIs(t, err, client.ErrInvalidArgument)
+}
+
+func TestClient_Errors(t *testing.T) {
+	server := newServer(t, stored(1), nil)
+	c, err := client.New(server.URL)
+	require.NoError(t, err)
+
+	_, err = c.ListDelegations(context.Background(), client.ListOptions{Limit: 10000})
+	require.ErrorIs(t, err, client.ErrInvalidArgument)
+	var apiErr *client.APIError
+	require.ErrorAs(t, err, &apiErr)
+	require.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+	require.Contains(t, apiErr.Message, "limit")
+	require.Equal(t, []client.InvalidParam{{Name: "limit", Reason: "number must be at most 5000"}}, apiErr.InvalidParams)
+
+	it := c.IterateDelegations(client.ListOptions{Year: 999})
+	require.False(t, it.Next(context.Background()))
+	require.ErrorIs(t, it.Err(), client.ErrInvalidArgument)
+}
+
+func TestClient_Retry(t *testing.T) {
+	var calls atomic.Int32
+	server := newServer(t, stored(1), func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) <= 2 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	c, err := client.New(server.URL, client.WithRetry(3, time.Millisecond))
+	require.NoError(t, err)
+	page, err := c.ListDelegations(context.Background(), client.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, page.Data, 2)
+	require.EqualValues(t, 3, calls.Load())
+
+	calls.Store(0)
+	c, err = client.New(server.URL, client.WithRetry(1, time.Millisecond))
+	require.NoError(t, err)
+	_, err = c.ListDelegations(context.Background(), client.ListOptions{})
+	require.ErrorIs(t, err, client.ErrUnavailable)
+	require.EqualValues(t, 2, calls.Load())
+
+	// A request rejected as invalid is not retried.
+	calls.Store(10)
+	_, err = c.ListDelegations(context.Background(), client.ListOptions{Page: -1})
+	require.ErrorIs(t, err, client.ErrInvalidArgument)
+	require.EqualValues(t, 11, calls.Load())
+}
+
+func TestClient_Context(t *testing.T) {
+	server := newServer(t, stored(1), func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Retry-After", "10")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		})
+	})
+
+	c, err := client.New(server.URL)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = c.ListDelegations(ctx, client.ListOptions{})
+	require.True(t, errors.Is(err, context.DeadlineExceeded), err)
+	require.Less(t, time.Since(start), time.Second)
+}
@@ -0,0 +1,110 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Sentinel errors matched with errors.Is by the errors returned by the client.
+var (
+	// ErrInvalidArgument is a request rejected with a 400, the message tells which parameter is invalid.
+	ErrInvalidArgument = errors.New("invalid argument")
+	// ErrNotFound is a request rejected with a 404.
+	ErrNotFound = errors.New("not found")
+	// ErrGone is a request for delegations older than the retention boundary, rejected with a 410.
+	ErrGone = errors.New("no longer retained")
+	// ErrUnavailable is a request which failed because the API, or a dependency, is unavailable. It is retried.
+	ErrUnavailable = errors.New("unavailable")
+	// ErrInternal is a request which failed with another 5xx.
+	ErrInternal = errors.New("internal error")
+)
+
+// APIError is a response of the API with an error status, its body is an RFC 7807 problem.
+// Message is the detail of the problem, InvalidParams names the parameters rejected by a 400, RetentionBoundary is set for
+// a 410 and RetryAfter when the response has a `Retry-After` header in seconds.
+type APIError struct {
+	StatusCode        int
+	Message           string
+	InvalidParams     []InvalidParam
+	RetentionBoundary time.Time
+	RetryAfter        time.Duration
+}
+
+// InvalidParam is a parameter rejected by the API and the reason why.
+type InvalidParam struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("kiln api: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("kiln api: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// Is match the sentinel error of the status code.
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrInvalidArgument:
+		return e.StatusCode == http.StatusBadRequest
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrGone:
+		return e.StatusCode == http.StatusGone
+	case ErrUnavailable:
+		return e.StatusCode == http.StatusTooManyRequests || e.StatusCode == http.StatusBadGateway ||
+			e.StatusCode == http.StatusServiceUnavailable || e.StatusCode == http.StatusGatewayTimeout
+	case ErrInternal:
+		return e.StatusCode >= http.StatusInternalServerError && !e.Is(ErrUnavailable)
+	}
+	return false
+}
+
+// TransportError is a request which got no response, it matches ErrUnavailable and is retried.
+type TransportError struct {
+	Err error
+}
+
+func (e *TransportError) Error() string {
+	return "kiln api: " + e.Err.Error()
+}
+
+func (e *TransportError) Unwrap() error {
+	return e.Err
+}
+
+// Is match ErrUnavailable.
+func (e *TransportError) Is(target error) bool {
+	return target == ErrUnavailable
+}
+
+// isTransient report whether a request which failed with err may succeed if retried.
+func isTransient(err error) bool {
+	return errors.Is(err, ErrUnavailable)
+}
+
+// newAPIError return the APIError of a response with an error status and its body.
+func newAPIError(resp *http.Response, body []byte) *APIError {
+	apiErr := &APIError{StatusCode: resp.StatusCode}
+
+	var problem struct {
+		Detail            string         `json:"detail"`
+		InvalidParams     []InvalidParam `json:"invalid-params"`
+		RetentionBoundary time.Time      `json:"retention_boundary"`
+	}
+	if err := json.Unmarshal(body, &problem); err == nil {
+		apiErr.Message = problem.Detail
+		apiErr.InvalidParams = problem.InvalidParams
+		apiErr.RetentionBoundary = problem.RetentionBoundary
+	}
+
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		apiErr.RetryAfter = time.Duration(seconds) * time.Second
+	}
+	return apiErr
+}
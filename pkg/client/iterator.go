@@ -0,0 +1,69 @@
+package client
+
+import (
+	"context"
+
+	"github.com/kiln-mid/pkg/models"
+)
+
+// DelegationsIterator iterate through the delegations of every page, fetching a page when the previous one is consumed.
+//
+//	it := c.IterateDelegations(client.ListOptions{Year: 2023})
+//	for it.Next(ctx) {
+//		d := it.Delegation()
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type DelegationsIterator struct {
+	client  *Client
+	options ListOptions
+	page    []models.Delegations
+	index   int
+	done    bool
+	err     error
+}
+
+// IterateDelegations return an iterator through the delegations matching options, starting at options.Page.
+func (c *Client) IterateDelegations(options ListOptions) *DelegationsIterator {
+	if options.Page == 0 {
+		options.Page = 1
+	}
+	return &DelegationsIterator{client: c, options: options, index: -1}
+}
+
+// Next advance to the next delegation and report whether there is one, it returns false at the end or on error, see Err.
+func (it *DelegationsIterator) Next(ctx context.Context) bool {
+	if it.err != nil {
+		return false
+	}
+
+	it.index++
+	if it.index < len(it.page) {
+		return true
+	}
+	if it.done {
+		return false
+	}
+
+	page, err := it.client.ListDelegations(ctx, it.options)
+	if err != nil {
+		it.err = err
+		return false
+	}
+
+	it.done = !page.HasMore
+	it.options.Page++
+	it.page, it.index = page.Data, 0
+	return len(it.page) > 0
+}
+
+// Delegation return the current delegation, it must only be called after Next returned true.
+func (it *DelegationsIterator) Delegation() models.Delegations {
+	return it.page[it.index]
+}
+
+// Err return the error which stopped the iteration, or nil.
+func (it *DelegationsIterator) Err() error {
+	return it.err
+}
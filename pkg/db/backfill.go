@@ -0,0 +1,59 @@
+package db
+
+import (
+	"context"
+
+	"github.com/kiln-mid/pkg/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type BackfillRepository interface {
+	CreateChunks(ctx context.Context, chunks []models.BackfillChunk) error
+	FindChunks(ctx context.Context, job string) ([]models.BackfillChunk, error)
+	SaveProgress(ctx context.Context, chunk *models.BackfillChunk) error
+}
+
+// NewBackfillAdapter returns an implementation of the BackfillRepository using GORM for database interactions.
+func NewBackfillAdapter(db *gorm.DB) BackfillRepository {
+	return &BackfillAdapter{DB: db}
+}
+
+// BackfillAdapter provides a GORM-based implementation of BackfillRepository.
+type BackfillAdapter struct {
+	DB *gorm.DB
+}
+
+// CreateChunks record the chunks of a job, chunks already recorded for the same job and number are left untouched.
+func (r *BackfillAdapter) CreateChunks(ctx context.Context, chunks []models.BackfillChunk) error {
+	if len(chunks) == 0 {
+		return nil
+	}
+
+	res := r.DB.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&chunks)
+	if res.Error != nil {
+		return queryError(res.Error)
+	}
+	return nil
+}
+
+// FindChunks return the chunks of a job ordered by number.
+func (r *BackfillAdapter) FindChunks(ctx context.Context, job string) ([]models.BackfillChunk, error) {
+	var c []models.BackfillChunk
+	res := r.DB.WithContext(ctx).Where("job = ?", job).Order("number").Find(&c)
+	if res.Error != nil {
+		return nil, queryError(res.Error)
+	}
+	return c, nil
+}
+
+// SaveProgress save the checkpoint, the number of rows and the status of a chunk.
+func (r *BackfillAdapter) SaveProgress(ctx context.Context, chunk *models.BackfillChunk) error {
+	res := r.DB.WithContext(ctx).Model(chunk).
+		Select("last_operation_id", "rows", "status", "updated_at").
+		Updates(chunk)
+	if res.Error != nil {
+		return queryError(res.Error)
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/kiln-mid/pkg/models"
+	"github.com/kiln-mid/pkg/utillog"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DefaultBatchSize is the default number of delegations inserted per statement.
+// It keeps statements well under the default `max_allowed_packet`.
+const DefaultBatchSize = 1000
+
+// loadDataTimestampFormat is the format of timestamps written in the `LOAD DATA` input.
+const loadDataTimestampFormat = "2006-01-02 15:04:05.000"
+
+// loadDataFields are the fields of models.Delegations written in the `LOAD DATA` input, in the order of the CSV columns.
+var loadDataFields = []string{"TezosID", "Timestamp", "Amount", "Delegator", "Level", "Hash"}
+
+// loadDataReaders is used to give an unique name to each `LOAD DATA` input.
+var loadDataReaders atomic.Uint64
+
+// BulkOptions represent how delegations are written by batches.
+// BatchSize is the number of delegations per batch, DefaultBatchSize is used when equal to 0.
+// LoadData write batches with `LOAD DATA LOCAL INFILE`, it requires `local_infile` to be enabled on the server.
+// OnBatch is called after each committed batch, batches are logged when it is nil.
+type BulkOptions struct {
+	BatchSize int
+	LoadData  bool
+	OnBatch   func(BatchStats)
+}
+
+// BatchStats represent the throughput of a committed batch.
+type BatchStats struct {
+	Rows     int
+	Inserted int64
+	Duration time.Duration
+	LoadData bool
+}
+
+// RowsPerSecond return the number of rows written per second by the batch.
+func (s BatchStats) RowsPerSecond() float64 {
+	if s.Duration <= 0 {
+		return 0
+	}
+	return float64(s.Rows) / s.Duration.Seconds()
+}
+
+// batches split delegations in slices of at most BatchSize delegations.
+func (o BulkOptions) batches(d []models.Delegations) [][]models.Delegations {
+	size := o.BatchSize
+	if size <= 0 {
+		size = DefaultBatchSize
+	}
+
+	batches := [][]models.Delegations{}
+	for start := 0; start < len(d); start += size {
+		batches = append(batches, d[start:min(start+size, len(d))])
+	}
+	return batches
+}
+
+// report call OnBatch with the statistics of a committed batch.
+func (o BulkOptions) report(ctx context.Context, stats BatchStats) {
+	if o.OnBatch != nil {
+		o.OnBatch(stats)
+		return
+	}
+	slog.InfoContext(ctx, "delegations batch committed",
+		"rows", stats.Rows,
+		utillog.KeyRowsInserted, stats.Inserted,
+		"duration", stats.Duration,
+		"rows_per_second", stats.RowsPerSecond(),
+		"load_data", stats.LoadData,
+	)
+}
+
+// insertBatch inserts a batch with a multi-row INSERT ignoring conflicts on the UNIQUE key.
+func insertBatch(tx *gorm.DB, batch []models.Delegations) (int64, error) {
+	columns, err := delegationsColumns(tx, "TezosID")
+	if err != nil {
+		return 0, err
+	}
+
+	res := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: columns[0], Table: delegationsTable}},
+		DoNothing: true,
+	}).Create(&batch)
+	if res.Error != nil {
+		return 0, queryError(res.Error)
+	}
+	return res.RowsAffected, nil
+}
+
+// loadBatch inserts a batch with `LOAD DATA LOCAL INFILE` from an in-memory CSV, duplicated rows are ignored.
+func loadBatch(tx *gorm.DB, batch []models.Delegations) (int64, error) {
+	var buffer bytes.Buffer
+	w := csv.NewWriter(&buffer)
+	for _, d := range batch {
+		record := []string{
+			strconv.Itoa(d.TezosID),
+			d.Timestamp.UTC().Format(loadDataTimestampFormat),
+			strconv.Itoa(d.Amount),
+			d.Delegator,
+			strconv.Itoa(d.Level),
+			d.Hash,
+		}
+		if err := w.Write(record); err != nil {
+			return 0, fmt.Errorf("csv write: %w", err)
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return 0, fmt.Errorf("csv flush: %w", err)
+	}
+
+	name := fmt.Sprintf("delegations-%d", loadDataReaders.Add(1))
+	statement, err := loadDataStatement(tx, name)
+	if err != nil {
+		return 0, err
+	}
+
+	mysql.RegisterReaderHandler(name, func() io.Reader { return &buffer })
+	defer mysql.DeregisterReaderHandler(name)
+
+	res := tx.Exec(statement)
+	if res.Error != nil {
+		return 0, queryError(res.Error)
+	}
+	return res.RowsAffected, nil
+}
+
+// loadDataStatement return the `LOAD DATA` statement reading the input registered as reader, its columns are
+// the ones GORM maps loadDataFields to.
+func loadDataStatement(tx *gorm.DB, reader string) (string, error) {
+	columns, err := delegationsColumns(tx, loadDataFields...)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf(`LOAD DATA LOCAL INFILE 'Reader::%s' IGNORE INTO TABLE %s
+		FIELDS TERMINATED BY ',' OPTIONALLY ENCLOSED BY '"' LINES TERMINATED BY '\n'
+		(%s)`, reader, delegationsTable, strings.Join(columns, ", ")), nil
+}
+
+// delegationsColumns return the columns GORM maps the fields of models.Delegations to.
+func delegationsColumns(tx *gorm.DB, fields ...string) ([]string, error) {
+	statement := &gorm.Statement{DB: tx}
+	if err := statement.Parse(&models.Delegations{}); err != nil {
+		return nil, fmt.Errorf("parse delegations schema: %w", err)
+	}
+	s := statement.Schema
+
+	columns := make([]string, 0, len(fields))
+	for _, name := range fields {
+		field := s.LookUpField(name)
+		if field == nil || field.DBName == "" {
+			return nil, fmt.Errorf("delegations field %s has no column", name)
+		}
+		columns = append(columns, field.DBName)
+	}
+	return columns, nil
+}
@@ -0,0 +1,74 @@
+package db
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/kiln-mid/pkg/models"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+func TestBulkOptions_Batches(t *testing.T) {
+	delegations := make([]models.Delegations, 5)
+	for i := range delegations {
+		delegations[i].TezosID = i + 1
+	}
+
+	for _, tt := range []struct {
+		name      string
+		batchSize int
+		sizes     []int
+	}{
+		{name: "default batch size", batchSize: 0, sizes: []int{5}},
+		{name: "exact batches", batchSize: 5, sizes: []int{5}},
+		{name: "partial last batch", batchSize: 2, sizes: []int{2, 2, 1}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			batches := BulkOptions{BatchSize: tt.batchSize}.batches(delegations)
+
+			sizes := []int{}
+			next := 1
+			for _, batch := range batches {
+				sizes = append(sizes, len(batch))
+				for _, d := range batch {
+					require.Equal(t, next, d.TezosID)
+					next++
+				}
+			}
+			require.Equal(t, tt.sizes, sizes)
+		})
+	}
+
+	require.Empty(t, BulkOptions{}.batches(nil))
+}
+
+// dryRunDB return a database which builds statements without a server.
+func dryRunDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(mysql.New(mysql.Config{DSN: "user:password@tcp(127.0.0.1:3306)/db", SkipInitializeWithVersion: true}), &gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	require.NoError(t, err)
+	return db
+}
+
+func TestLoadDataStatement(t *testing.T) {
+	db := dryRunDB(t)
+
+	statement, err := loadDataStatement(db, "delegations-1")
+	require.NoError(t, err)
+	require.Contains(t, statement, "'Reader::delegations-1' IGNORE INTO TABLE delegations")
+	require.Contains(t, statement, "(tezos_id, timestamp, amount, delegator, level, hash)")
+
+	// Every column loaded is a column of the table created by GORM.
+	s, err := schema.Parse(&models.Delegations{}, &sync.Map{}, db.NamingStrategy)
+	require.NoError(t, err)
+	columns, err := delegationsColumns(db, loadDataFields...)
+	require.NoError(t, err)
+	for _, column := range columns {
+		require.Contains(t, s.DBNames, column)
+	}
+
+	_, err = delegationsColumns(db, "Unknown")
+	require.Error(t, err)
+}
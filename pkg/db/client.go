@@ -1,29 +1,92 @@
 package db
 
 import (
-	"github.com/kiln-mid/pkg/models"
+	"context"
+	"errors"
+	"fmt"
+
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 )
 
 // Client represents a structure containing a database connection using GORM.
+// DB is the primary connection, Replicas route reads to the replicas and fall back on DB.
+// Bulk configure how delegations are written by adapters created with NewClientDelegationsAdapter.
 type Client struct {
-	DB *gorm.DB
+	DB       *gorm.DB
+	Replicas *ReplicaPool
+	Bulk     BulkOptions
 }
 
 // CreateClient initializes a new Client with a database connection based on the DSN received in param.
-// If the connection is successfull it will automatically autoMigrate models.
-func CreateClient(DSN string) (Client, error) {
-	db, err := gorm.Open(mysql.Open(DSN), &gorm.Config{})
+// replicaDSNs are optional read replicas of the primary, reads fall back on the primary when none are provided.
+// The schema is not migrated, see Migrate. Queries are logged with slog, see slogLogger.
+func CreateClient(DSN string, replicaDSNs ...string) (Client, error) {
+	db, err := gorm.Open(mysql.Open(DSN), &gorm.Config{Logger: newLogger()})
 	if err != nil {
 		return Client{}, err
 	}
 
-	db.AutoMigrate(&models.Delegations{})
+	replicas := make([]*gorm.DB, 0, len(replicaDSNs))
+	for i, replicaDSN := range replicaDSNs {
+		replica, err := gorm.Open(mysql.Open(replicaDSN), &gorm.Config{Logger: newLogger()})
+		if err != nil {
+			return Client{}, fmt.Errorf("replica %d: %w", i, err)
+		}
+		replicas = append(replicas, replica)
+	}
 
 	client := Client{
-		DB: db,
+		DB:       db,
+		Replicas: NewReplicaPool(db, replicas, DefaultMaxReplicationLag),
 	}
 
 	return client, nil
 }
+
+// Ping check that the primary connection is alive.
+func (c Client) Ping(ctx context.Context) error {
+	sqlDB, err := c.DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+// Use register plugin on the primary and replicas connections.
+func (c Client) Use(plugin gorm.Plugin) error {
+	if err := c.DB.Use(plugin); err != nil {
+		return err
+	}
+	if c.Replicas != nil {
+		for i, r := range c.Replicas.replicas {
+			if err := r.db.Use(plugin); err != nil {
+				return fmt.Errorf("replica %d: %w", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Close close the primary and replicas connections.
+func (c Client) Close() error {
+	connections := []*gorm.DB{c.DB}
+	if c.Replicas != nil {
+		for _, r := range c.Replicas.replicas {
+			connections = append(connections, r.db)
+		}
+	}
+
+	var errs []error
+	for _, connection := range connections {
+		sqlDB, err := connection.DB()
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := sqlDB.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,37 @@
+package db
+
+import (
+	"time"
+
+	"github.com/kiln-mid/pkg/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// dataVersionID is the id of the single row of the data_versions table.
+const dataVersionID = 1
+
+// bumpDataVersion increment the data version on the given connection, it is called by the writes which update or delete
+// stored delegations: an insert changes the last inserted delegation, which already versions the pages.
+func bumpDataVersion(db *gorm.DB) error {
+	res := db.Clauses(clause.OnConflict{
+		DoUpdates: clause.Assignments(map[string]any{"version": gorm.Expr("version + 1"), "updated_at": gorm.Expr("VALUES(updated_at)")}),
+	}).Create(&models.DataVersion{ID: dataVersionID, Version: 1, UpdatedAt: time.Now().UTC()})
+	if res.Error != nil {
+		return queryError(res.Error)
+	}
+	return nil
+}
+
+// findDataVersion return the data version read on the given connection, 0 when the delegations were never changed.
+func findDataVersion(db *gorm.DB) (int64, error) {
+	var versions []int64
+	res := db.Model(&models.DataVersion{}).Where("id = ?", dataVersionID).Pluck("version", &versions)
+	if res.Error != nil {
+		return 0, queryError(res.Error)
+	}
+	if len(versions) == 0 {
+		return 0, nil
+	}
+	return versions[0], nil
+}
@@ -2,20 +2,59 @@ package db
 
 import (
 	"context"
+	"database/sql"
 	"errors"
-	"fmt"
+	"strconv"
+	"time"
 
 	"github.com/kiln-mid/pkg/models"
 	"gorm.io/gorm"
-	"gorm.io/gorm/clause"
 )
 
 type DelegationsRepository interface {
 	CreateMany(ctx context.Context, Delegations *[]models.Delegations) (int64, error)
+	CreateManyAndCheckpoint(ctx context.Context, Delegations *[]models.Delegations, state *models.SyncState) (int64, error)
 	FindMostRecent(ctx context.Context) (*models.Delegations, error)
+	FindByTezosID(ctx context.Context, tezosID int) (*models.Delegations, error)
+	FindByHash(ctx context.Context, hash string) (*models.Delegations, error)
+	FillHash(ctx context.Context, tezosID int, hash string) (int64, error)
+	FindLatestByDelegators(ctx context.Context, delegators []string) (map[string]models.Delegations, error)
+	FindLastInserted(ctx context.Context, year int) (*models.Delegations, error)
+	FindDataVersion(ctx context.Context) (int64, error)
 	FindAndOrderByTimestamp(ctx context.Context, limit int, offset int) (*[]models.Delegations, error)
 	FindFromYear(ctx context.Context, year int, limit int, offset int) (*[]models.Delegations, error)
 	FindAvailableYear(ctx context.Context) (*[]int, error)
+	CountFromYear(ctx context.Context, year int, maxExact int) (int64, bool, error)
+	CountPerDay(ctx context.Context, from time.Time, to time.Time) (map[string]int64, error)
+	FindAfterID(ctx context.Context, from time.Time, to time.Time, afterID uint, limit int) (*[]models.Delegations, error)
+	FindInRange(ctx context.Context, r DelegationsRange, afterTezosID int, limit int) ([]models.Delegations, error)
+	ReplaceByTezosIDs(ctx context.Context, tezosIDs []int, d *[]models.Delegations) (int64, error)
+}
+
+// DelegationsRange select the delegations whose timestamp is in [From, Before) and whose level is in [FromLevel, BeforeLevel).
+// Each bound is ignored when equal to its zero value.
+type DelegationsRange struct {
+	From        time.Time
+	Before      time.Time
+	FromLevel   int
+	BeforeLevel int
+}
+
+// where apply the bounds of the range to db.
+func (dr DelegationsRange) where(db *gorm.DB) *gorm.DB {
+	if !dr.From.IsZero() {
+		db = db.Where("timestamp >= ?", dr.From)
+	}
+	if !dr.Before.IsZero() {
+		db = db.Where("timestamp < ?", dr.Before)
+	}
+	if dr.FromLevel != 0 {
+		db = db.Where("level >= ?", dr.FromLevel)
+	}
+	if dr.BeforeLevel != 0 {
+		db = db.Where("level < ?", dr.BeforeLevel)
+	}
+	return db
 }
 
 // NewDelegationsAdapter returns an implementation of the DelegationsRepository using GORM for database interactions.
@@ -23,63 +62,387 @@ func NewDelegationsAdapter(db *gorm.DB) DelegationsRepository {
 	return &DelegationsAdapter{DB: db}
 }
 
+// NewClientDelegationsAdapter returns an implementation of the DelegationsRepository using the replicas and the bulk options of the client.
+// Writes and FindMostRecent, which drives ingestion, always hit the primary.
+func NewClientDelegationsAdapter(client Client) DelegationsRepository {
+	return &DelegationsAdapter{DB: client.DB, Replicas: client.Replicas, Bulk: client.Bulk}
+}
+
 // DelegationsAdapter provides a GORM-based implementation of DelegationsRepository.
 type DelegationsAdapter struct {
-	DB *gorm.DB
+	DB       *gorm.DB
+	Replicas *ReplicaPool
+	Bulk     BulkOptions
+}
+
+// reader return the connection used by read queries served to the API.
+func (r *DelegationsAdapter) reader(ctx context.Context) *gorm.DB {
+	if r.Replicas == nil {
+		return r.DB.WithContext(ctx)
+	}
+	return r.Replicas.Reader(ctx)
 }
 
 // CreateMany inserts multiple Delegations records into the database, no error is returned if their is a conflict based on UNIQUE key
+// Records are inserted by batches of Bulk.BatchSize with a transaction per batch, through `LOAD DATA LOCAL INFILE` when Bulk.LoadData is set.
 // return the number of inserted rows.
 func (r *DelegationsAdapter) CreateMany(ctx context.Context, d *[]models.Delegations) (int64, error) {
-	res := r.DB.WithContext(ctx).Clauses(clause.OnConflict{
-		Columns:   []clause.Column{{Name: "id_tezos", Table: "delegations"}},
-		DoNothing: true,
-	}).Create(&d)
+	var rowsAffected int64
+	for _, batch := range r.Bulk.batches(*d) {
+		inserted, err := r.createBatch(ctx, batch, func(tx *gorm.DB) (int64, error) {
+			if r.Bulk.LoadData {
+				return loadBatch(tx, batch)
+			}
+			return insertBatch(tx, batch)
+		})
+		rowsAffected += inserted
+		if err != nil {
+			return rowsAffected, err
+		}
+	}
 
-	if res.Error != nil {
-		return 0, fmt.Errorf("gorm error: %s", res.Error)
+	return rowsAffected, nil
+}
+
+// CreateManyAndCheckpoint inserts multiple Delegations records and save the sync state in the same transaction as the last batch.
+// return the number of inserted rows.
+func (r *DelegationsAdapter) CreateManyAndCheckpoint(ctx context.Context, d *[]models.Delegations, state *models.SyncState) (int64, error) {
+	batches := r.Bulk.batches(*d)
+	if len(batches) == 0 {
+		return 0, saveSyncState(r.DB.WithContext(ctx), state)
+	}
+
+	var rowsAffected int64
+	for i, batch := range batches {
+		last := i == len(batches)-1
+		inserted, err := r.createBatch(ctx, batch, func(tx *gorm.DB) (int64, error) {
+			inserted, err := insertBatch(tx, batch)
+			if err != nil || !last {
+				return inserted, err
+			}
+			return inserted, saveSyncState(tx, state)
+		})
+		rowsAffected += inserted
+		if err != nil {
+			return rowsAffected, err
+		}
+	}
+
+	return rowsAffected, nil
+}
+
+// createBatch run fct in a transaction and report the batch statistics.
+func (r *DelegationsAdapter) createBatch(ctx context.Context, batch []models.Delegations, fct func(tx *gorm.DB) (int64, error)) (int64, error) {
+	start := time.Now()
+
+	var inserted int64
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		inserted, err = fct(tx)
+		return err
+	})
+	if err != nil {
+		return 0, err
 	}
 
-	return res.RowsAffected, nil
+	r.Bulk.report(ctx, BatchStats{
+		Rows:     len(batch),
+		Inserted: inserted,
+		Duration: time.Since(start),
+		LoadData: r.Bulk.LoadData,
+	})
+	return inserted, nil
 }
 
 // FindAvailableYear return a slice of available year which delegations can be searched.
 func (r *DelegationsAdapter) FindAvailableYear(ctx context.Context) (*[]int, error) {
 	var years []int
 
-	res := r.DB.Model(models.Delegations{}).
+	res := r.reader(ctx).Model(models.Delegations{}).
 		Select("DISTINCT YEAR(timestamp) AS year").
 		Order("year").
 		Pluck("year", &years)
 
 	if res.Error != nil {
-		return nil, fmt.Errorf("gorm error: %s", res.Error)
+		return nil, queryError(res.Error)
 	}
 
 	return &years, nil
 }
 
+// yearRange return the range of the delegations of year, every delegation when year is 0.
+// The year is searched as a timestamp range so MySQL only reads the monthly partitions of that year.
+func yearRange(year int) DelegationsRange {
+	if year == 0 {
+		return DelegationsRange{}
+	}
+	from := time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC)
+	return DelegationsRange{From: from, Before: from.AddDate(1, 0, 0)}
+}
+
 // FindFromYear fetch and return with a limit and an offset all delegations who can be found for a given year.
 func (r *DelegationsAdapter) FindFromYear(ctx context.Context, year int, limit int, offset int) (*[]models.Delegations, error) {
 	var d []models.Delegations
 
-	res := r.DB.Limit(limit).
-		Offset(offset).Where("YEAR(timestamp) = ?", year).Order("timestamp desc").Find(&d)
+	res := yearRange(year).where(r.reader(ctx)).Limit(limit).
+		Offset(offset).Order("timestamp desc").Find(&d)
 	if res.Error != nil {
-		return nil, fmt.Errorf("gorm error: %s", res.Error)
+		return nil, queryError(res.Error)
 	}
 
 	return &d, nil
 }
 
+// CountFromYear return the number of delegations of year, of every year when year is 0, and whether the number is exact.
+// Up to maxExact delegations are counted, above that the number is the estimate of the query planner so counting a large
+// table stays cheap.
+func (r *DelegationsAdapter) CountFromYear(ctx context.Context, year int, maxExact int) (int64, bool, error) {
+	reader := r.reader(ctx)
+
+	var count int64
+	capped := yearRange(year).where(reader.Model(&models.Delegations{})).Select("1").Limit(maxExact + 1)
+	res := reader.Table("(?) AS capped", capped).Count(&count)
+	if res.Error != nil {
+		return 0, false, queryError(res.Error)
+	}
+	if count <= int64(maxExact) {
+		return count, true, nil
+	}
+
+	estimate, err := estimateRows(reader, year)
+	if err != nil {
+		return 0, false, err
+	}
+	return max(estimate, count), false, nil
+}
+
+// estimateRows return the number of delegations of year the query planner expects to read, from the `rows` column of `EXPLAIN`.
+func estimateRows(db *gorm.DB, year int) (int64, error) {
+	query := "EXPLAIN SELECT 1 FROM " + delegationsTable
+	var args []any
+	if dr := yearRange(year); !dr.From.IsZero() {
+		query += " WHERE timestamp >= ? AND timestamp < ?"
+		args = append(args, dr.From, dr.Before)
+	}
+
+	rows, err := db.Raw(query, args...).Rows()
+	if err != nil {
+		return 0, queryError(err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, queryError(err)
+	}
+
+	var estimate int64
+	for rows.Next() {
+		values := make([]sql.RawBytes, len(columns))
+		dest := make([]any, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return 0, queryError(err)
+		}
+		for i, column := range columns {
+			if n, err := strconv.ParseInt(string(values[i]), 10, 64); column == "rows" && err == nil {
+				estimate = max(estimate, n)
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, queryError(err)
+	}
+	return estimate, nil
+}
+
 // FindAndOrderByTimestamp fetch and return with a limit and an offset all delegations ordered by timestamp.
 func (r *DelegationsAdapter) FindAndOrderByTimestamp(ctx context.Context, limit int, offset int) (*[]models.Delegations, error) {
 	var d []models.Delegations
 
-	res := r.DB.Limit(limit).
+	res := r.reader(ctx).Limit(limit).
 		Offset(offset).Order("timestamp desc").Find(&d)
 	if res.Error != nil {
-		return nil, fmt.Errorf("gorm error: %s", res.Error)
+		return nil, queryError(res.Error)
+	}
+
+	return &d, nil
+}
+
+// FindAfterID fetch and return up to limit delegations between from included and to excluded whose id is greater than afterID, ordered by id.
+// Giving the id of the last delegation returned as afterID page through a range without the cost of an offset.
+func (r *DelegationsAdapter) FindAfterID(ctx context.Context, from time.Time, to time.Time, afterID uint, limit int) (*[]models.Delegations, error) {
+	var d []models.Delegations
+
+	res := r.reader(ctx).Limit(limit).
+		Where("timestamp >= ? AND timestamp < ? AND id > ?", from, to, afterID).Order("id").Find(&d)
+	if res.Error != nil {
+		return nil, queryError(res.Error)
+	}
+
+	return &d, nil
+}
+
+// FindInRange fetch and return up to limit delegations of the range whose tezos id is greater than afterTezosID, ordered by tezos id.
+// It reads the primary so the result can be compared with tzkt without replication lag.
+func (r *DelegationsAdapter) FindInRange(ctx context.Context, dr DelegationsRange, afterTezosID int, limit int) ([]models.Delegations, error) {
+	var d []models.Delegations
+
+	res := dr.where(r.DB.WithContext(ctx)).Where("tezos_id > ?", afterTezosID).
+		Order("tezos_id").Limit(limit).Find(&d)
+	if res.Error != nil {
+		return nil, queryError(res.Error)
+	}
+
+	return d, nil
+}
+
+// ReplaceByTezosIDs delete the delegations with the given tezos ids and insert d in a single transaction, so the deleted
+// delegations are kept when the insert fails. Conflicts on the UNIQUE key are ignored as in CreateMany. The data version is bumped in the transaction.
+// return the number of inserted rows.
+func (r *DelegationsAdapter) ReplaceByTezosIDs(ctx context.Context, tezosIDs []int, d *[]models.Delegations) (int64, error) {
+	var inserted int64
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if len(tezosIDs) > 0 {
+			res := tx.Where("tezos_id IN ?", tezosIDs).Delete(&models.Delegations{})
+			if res.Error != nil {
+				return queryError(res.Error)
+			}
+		}
+
+		for _, batch := range r.Bulk.batches(*d) {
+			rows, err := insertBatch(tx, batch)
+			if err != nil {
+				return err
+			}
+			inserted += rows
+		}
+		return bumpDataVersion(tx)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return inserted, nil
+}
+
+// CountPerDay return the number of delegations stored per day between from included and to excluded.
+// Days are keyed with the time.DateOnly format, days without delegations are absent from the map.
+func (r *DelegationsAdapter) CountPerDay(ctx context.Context, from time.Time, to time.Time) (map[string]int64, error) {
+	var rows []struct {
+		Day   string
+		Count int64
+	}
+	res := r.DB.WithContext(ctx).Model(models.Delegations{}).
+		Select("DATE_FORMAT(timestamp, '%Y-%m-%d') AS day, COUNT(*) AS count").
+		Where("timestamp >= ? AND timestamp < ?", from, to).
+		Group("day").
+		Scan(&rows)
+	if res.Error != nil {
+		return nil, queryError(res.Error)
+	}
+
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Day] = row.Count
+	}
+	return counts, nil
+}
+
+// FindByTezosID fetch and return the delegation whose tzkt operation id is tezosID, ErrNotFound is returned if none is stored.
+func (r *DelegationsAdapter) FindByTezosID(ctx context.Context, tezosID int) (*models.Delegations, error) {
+	return r.findOne(ctx, "tezos_id = ?", tezosID)
+}
+
+// FindByHash fetch and return the delegation of the operation whose hash is hash, ErrNotFound is returned if none is stored.
+func (r *DelegationsAdapter) FindByHash(ctx context.Context, hash string) (*models.Delegations, error) {
+	return r.findOne(ctx, "hash = ?", hash)
+}
+
+// FindLatestByDelegators fetch and return the most recent delegation of each of delegators which has one, by delegator.
+// A single query ranks the delegations of every delegator, served by the (delegator, timestamp) index.
+func (r *DelegationsAdapter) FindLatestByDelegators(ctx context.Context, delegators []string) (map[string]models.Delegations, error) {
+	latest := make(map[string]models.Delegations, len(delegators))
+	if len(delegators) == 0 {
+		return latest, nil
+	}
+
+	reader := r.reader(ctx)
+	ranked := reader.Model(&models.Delegations{}).
+		Select("*, ROW_NUMBER() OVER (PARTITION BY delegator ORDER BY timestamp DESC, tezos_id DESC) AS delegator_rank").
+		Where("delegator IN ?", delegators)
+
+	var d []models.Delegations
+	res := reader.Table("(?) AS ranked", ranked).Where("delegator_rank = 1").Find(&d)
+	if res.Error != nil {
+		return nil, queryError(res.Error)
+	}
+
+	for _, delegation := range d {
+		latest[delegation.Delegator] = delegation
+	}
+	return latest, nil
+}
+
+// FindLastInserted fetch and return the last inserted delegation of year, of every year when year is 0, nil is returned if none is stored.
+// The row id grows with every insert, including the delegations backfilled in a past year, so the last inserted row versions the delegations
+// of year. It is read from the primary key index and the partitions of year only.
+func (r *DelegationsAdapter) FindLastInserted(ctx context.Context, year int) (*models.Delegations, error) {
+	var d []models.Delegations
+
+	res := yearRange(year).where(r.reader(ctx)).Order("id desc").Limit(1).Find(&d)
+	if res.Error != nil {
+		return nil, queryError(res.Error)
+	}
+	if len(d) == 0 {
+		return nil, nil
+	}
+
+	return &d[0], nil
+}
+
+// FillHash set the hash of the delegation whose tzkt operation id is tezosID when it has none, the delegations ingested
+// before the hash was stored have an empty one. The data version is bumped with the update. return the number of updated rows.
+func (r *DelegationsAdapter) FillHash(ctx context.Context, tezosID int, hash string) (int64, error) {
+	var updated int64
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&models.Delegations{}).
+			Where("tezos_id = ? AND hash = ?", tezosID, "").
+			Update("hash", hash)
+		if res.Error != nil {
+			return queryError(res.Error)
+		}
+		updated = res.RowsAffected
+		if updated == 0 {
+			return nil
+		}
+		return bumpDataVersion(tx)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return updated, nil
+}
+
+// FindDataVersion return the number of changes made to the stored delegations other than inserts, it versions the pages
+// along with the last inserted delegation.
+func (r *DelegationsAdapter) FindDataVersion(ctx context.Context) (int64, error) {
+	return findDataVersion(r.reader(ctx))
+}
+
+// findOne fetch and return the delegation matching the condition, ErrNotFound is returned if none is stored.
+func (r *DelegationsAdapter) findOne(ctx context.Context, query string, args ...any) (*models.Delegations, error) {
+	var d models.Delegations
+
+	res := r.reader(ctx).Where(query, args...).Order("tezos_id").Limit(1).Find(&d)
+	if res.Error != nil {
+		return nil, queryError(res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return nil, ErrNotFound
 	}
 
 	return &d, nil
@@ -89,14 +452,14 @@ func (r *DelegationsAdapter) FindAndOrderByTimestamp(ctx context.Context, limit
 func (r *DelegationsAdapter) FindMostRecent(ctx context.Context) (*models.Delegations, error) {
 	var d models.Delegations
 
-	res := r.DB.Order("timestamp desc").First(&d)
+	res := r.DB.WithContext(ctx).Order("timestamp desc").First(&d)
 
 	if errors.Is(res.Error, gorm.ErrRecordNotFound) {
 		return &d, nil
 	}
 
 	if res.Error != nil {
-		return &d, fmt.Errorf("gorm error: %s", res.Error)
+		return &d, queryError(res.Error)
 	}
 
 	return &d, nil
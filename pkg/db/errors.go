@@ -0,0 +1,65 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Sentinel errors matched with errors.Is by the errors returned by the repositories.
+var (
+	// ErrNotFound is returned by the lookups of a single row when no row matches.
+	ErrNotFound = errors.New("not found")
+	// ErrUnavailable is matched by the errors of the queries which could not reach the database.
+	ErrUnavailable = errors.New("database unavailable")
+)
+
+// MySQL error numbers of a server which cannot take the query.
+const (
+	mysqlTooManyConnections = 1040
+	mysqlServerShutdown     = 1053
+)
+
+// QueryError is the error of a failed query. Its message is the one of the driver, it must not be sent to clients.
+type QueryError struct {
+	Err error
+}
+
+func (e *QueryError) Error() string {
+	return "gorm error: " + e.Err.Error()
+}
+
+func (e *QueryError) Unwrap() error {
+	return e.Err
+}
+
+// Is match ErrUnavailable when the database could not be reached, so callers can tell an outage from a failed query.
+func (e *QueryError) Is(target error) bool {
+	return target == ErrUnavailable && unavailable(e.Err)
+}
+
+// queryError return the QueryError of err.
+func queryError(err error) error {
+	return &QueryError{Err: err}
+}
+
+// unavailable report whether err is caused by a database which could not be reached or did not answer in time.
+func unavailable(err error) bool {
+	var netErr net.Error
+	var mysqlErr *mysql.MySQLError
+	switch {
+	case errors.Is(err, driver.ErrBadConn), errors.Is(err, mysql.ErrInvalidConn), errors.Is(err, sql.ErrConnDone):
+		return true
+	case errors.Is(err, context.DeadlineExceeded):
+		return true
+	case errors.As(err, &netErr):
+		return true
+	case errors.As(err, &mysqlErr):
+		return mysqlErr.Number == mysqlTooManyConnections || mysqlErr.Number == mysqlServerShutdown
+	}
+	return false
+}
@@ -0,0 +1,36 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryError_Unavailable(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		err         error
+		unavailable bool
+	}{
+		{name: "bad connection", err: driver.ErrBadConn, unavailable: true},
+		{name: "invalid connection", err: fmt.Errorf("read: %w", mysql.ErrInvalidConn), unavailable: true},
+		{name: "deadline", err: context.DeadlineExceeded, unavailable: true},
+		{name: "connection refused", err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, unavailable: true},
+		{name: "too many connections", err: &mysql.MySQLError{Number: 1040}, unavailable: true},
+		{name: "syntax error", err: &mysql.MySQLError{Number: 1064, Message: "You have an error in your SQL syntax"}},
+		{name: "duplicate entry", err: &mysql.MySQLError{Number: 1062}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := queryError(tt.err)
+			require.Equal(t, tt.unavailable, errors.Is(err, ErrUnavailable))
+			require.ErrorIs(t, err, tt.err)
+			require.False(t, errors.Is(err, ErrNotFound))
+		})
+	}
+}
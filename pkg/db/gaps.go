@@ -0,0 +1,62 @@
+package db
+
+import (
+	"context"
+
+	"github.com/kiln-mid/pkg/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type GapsRepository interface {
+	Save(ctx context.Context, gap *models.Gap) error
+	Update(ctx context.Context, gap *models.Gap) error
+	FindByStatus(ctx context.Context, status models.GapStatus) ([]models.Gap, error)
+}
+
+// NewGapsAdapter returns an implementation of the GapsRepository using GORM for database interactions.
+func NewGapsAdapter(db *gorm.DB) GapsRepository {
+	return &GapsAdapter{DB: db}
+}
+
+// GapsAdapter provides a GORM-based implementation of GapsRepository.
+type GapsAdapter struct {
+	DB *gorm.DB
+}
+
+// Save record a gap, a gap already recorded for the same range has its counts refreshed and is opened again.
+func (r *GapsAdapter) Save(ctx context.Context, gap *models.Gap) error {
+	res := r.DB.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "range_from"}, {Name: "range_to"}},
+		DoUpdates: clause.AssignmentColumns([]string{"local_count", "remote_count", "status", "detected_at"}),
+	}).Create(gap)
+	if res.Error != nil {
+		return queryError(res.Error)
+	}
+	return nil
+}
+
+// Update save the repair status of a recorded gap.
+func (r *GapsAdapter) Update(ctx context.Context, gap *models.Gap) error {
+	res := r.DB.WithContext(ctx).Model(gap).
+		Select("status", "attempts", "last_error", "repaired_at").
+		Updates(gap)
+	if res.Error != nil {
+		return queryError(res.Error)
+	}
+	return nil
+}
+
+// FindByStatus return the gaps with the given status ordered by range, every gap is returned when status is empty.
+func (r *GapsAdapter) FindByStatus(ctx context.Context, status models.GapStatus) ([]models.Gap, error) {
+	var g []models.Gap
+	db := r.DB.WithContext(ctx).Order("range_from")
+	if status != "" {
+		db = db.Where("status = ?", status)
+	}
+	res := db.Find(&g)
+	if res.Error != nil {
+		return nil, queryError(res.Error)
+	}
+	return g, nil
+}
@@ -0,0 +1,96 @@
+package db
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/kiln-mid/pkg/models"
+	"gorm.io/gorm"
+)
+
+// DefaultLeaseTTL is the default duration a lease is held without being renewed.
+const DefaultLeaseTTL = 30 * time.Second
+
+type LeasesRepository interface {
+	IsLeader(ctx context.Context, name string) (bool, error)
+	Resign(ctx context.Context, name string) error
+	FindAll(ctx context.Context) ([]models.Lease, error)
+}
+
+// NewLeasesAdapter returns an implementation of the LeasesRepository using GORM for database interactions.
+// holder identify this instance, a lease not renewed within ttl can be taken over by another holder.
+func NewLeasesAdapter(db *gorm.DB, holder string, ttl time.Duration) LeasesRepository {
+	if ttl == 0 {
+		ttl = DefaultLeaseTTL
+	}
+	return &LeasesAdapter{DB: db, Holder: holder, TTL: ttl}
+}
+
+// LeasesAdapter provides a lease table based leader election, it satisfies utilworker.Elector.
+// Expiration dates are computed with the database clock so holders do not need synchronized clocks.
+type LeasesAdapter struct {
+	DB     *gorm.DB
+	Holder string
+	TTL    time.Duration
+}
+
+// DefaultLeaseHolder return an identifier of this instance made of the hostname and the process id.
+func DefaultLeaseHolder() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return hostname + "-" + strconv.Itoa(os.Getpid())
+}
+
+// IsLeader acquire the lease if it is free or expired, renew it if it is already held and report whether this instance holds it.
+func (r *LeasesAdapter) IsLeader(ctx context.Context, name string) (bool, error) {
+	var holder string
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		ttl := r.TTL.Microseconds()
+
+		res := tx.Exec(`INSERT IGNORE INTO leases (name, holder, acquired_at, expires_at)
+			VALUES (?, ?, NOW(3), TIMESTAMPADD(MICROSECOND, ?, NOW(3)))`, name, r.Holder, ttl)
+		if res.Error != nil {
+			return queryError(res.Error)
+		}
+
+		res = tx.Exec(`UPDATE leases
+			SET acquired_at = IF(holder = ?, acquired_at, NOW(3)), holder = ?, expires_at = TIMESTAMPADD(MICROSECOND, ?, NOW(3))
+			WHERE name = ? AND (holder = ? OR expires_at < NOW(3))`, r.Holder, r.Holder, ttl, name, r.Holder)
+		if res.Error != nil {
+			return queryError(res.Error)
+		}
+
+		res = tx.Raw("SELECT holder FROM leases WHERE name = ?", name).Scan(&holder)
+		if res.Error != nil {
+			return queryError(res.Error)
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return holder == r.Holder, nil
+}
+
+// Resign release the lease if this instance holds it, so another instance can take over without waiting for the expiration.
+func (r *LeasesAdapter) Resign(ctx context.Context, name string) error {
+	res := r.DB.WithContext(ctx).Exec("UPDATE leases SET expires_at = NOW(3) - INTERVAL 1 SECOND WHERE name = ? AND holder = ?", name, r.Holder)
+	if res.Error != nil {
+		return queryError(res.Error)
+	}
+	return nil
+}
+
+// FindAll return every lease ordered by name.
+func (r *LeasesAdapter) FindAll(ctx context.Context) ([]models.Lease, error) {
+	var l []models.Lease
+	res := r.DB.WithContext(ctx).Order("name").Find(&l)
+	if res.Error != nil {
+		return nil, queryError(res.Error)
+	}
+	return l, nil
+}
@@ -0,0 +1,75 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// DefaultSlowQueryThreshold is the duration above which a query is logged as slow.
+const DefaultSlowQueryThreshold = 200 * time.Millisecond
+
+// slogLogger is the GORM logger writing to slog with the context of the query, so the logs of a query carry the request id
+// or the worker run of the caller. Every query is logged at debug level, slow queries at warn level and failed queries at error level.
+type slogLogger struct {
+	slowThreshold time.Duration
+}
+
+// newLogger return the GORM logger of the connections created by CreateClient.
+func newLogger() logger.Interface {
+	return slogLogger{slowThreshold: DefaultSlowQueryThreshold}
+}
+
+// LogMode is ignored, the level is the one of the slog default logger.
+func (l slogLogger) LogMode(logger.LogLevel) logger.Interface {
+	return l
+}
+
+// Info log a message at info level.
+func (l slogLogger) Info(ctx context.Context, msg string, args ...any) {
+	slog.InfoContext(ctx, fmt.Sprintf(msg, args...))
+}
+
+// Warn log a message at warn level.
+func (l slogLogger) Warn(ctx context.Context, msg string, args ...any) {
+	slog.WarnContext(ctx, fmt.Sprintf(msg, args...))
+}
+
+// Error log a message at error level.
+func (l slogLogger) Error(ctx context.Context, msg string, args ...any) {
+	slog.ErrorContext(ctx, fmt.Sprintf(msg, args...))
+}
+
+// Trace log a query once executed, a record not found is not considered as a failure.
+func (l slogLogger) Trace(ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	elapsed := time.Since(begin)
+	failed := err != nil && !errors.Is(err, gorm.ErrRecordNotFound)
+	slow := elapsed > l.slowThreshold
+
+	level := slog.LevelDebug
+	switch {
+	case failed:
+		level = slog.LevelError
+	case slow:
+		level = slog.LevelWarn
+	}
+	if !slog.Default().Enabled(ctx, level) {
+		return
+	}
+
+	sql, rows := fc()
+	attrs := []any{"duration", elapsed, "rows", rows, "sql", sql}
+	switch {
+	case failed:
+		slog.Log(ctx, level, "query failed", append(attrs, "error", err)...)
+	case slow:
+		slog.Log(ctx, level, "slow query", attrs...)
+	default:
+		slog.Log(ctx, level, "query", attrs...)
+	}
+}
@@ -0,0 +1,236 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/kiln-mid/pkg/models"
+	"gorm.io/gorm"
+)
+
+// migration is a schema change applied once, in order of version.
+type migration struct {
+	Version     int
+	Description string
+	Up          func(tx *gorm.DB) error
+}
+
+// migrations is the ordered list of schema changes, a new change is appended with the next version and existing ones are never edited.
+var migrations = []migration{
+	{
+		Version:     1,
+		Description: "create delegations, sync_state, gaps and leases tables",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&v1Delegations{}, &v1SyncState{}, &v1Gap{}, &v1Lease{})
+		},
+	},
+	{
+		Version:     2,
+		Description: "create backfill_chunks table",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&v2BackfillChunk{})
+		},
+	},
+	{
+		Version:     3,
+		Description: "add hash column to delegations",
+		Up: func(tx *gorm.DB) error {
+			// Version 1 used to migrate the current model, a database created by an older release already has the column.
+			migrator := tx.Migrator()
+			if !migrator.HasColumn(&models.Delegations{}, "Hash") {
+				if err := migrator.AddColumn(&models.Delegations{}, "Hash"); err != nil {
+					return err
+				}
+			}
+			if !migrator.HasIndex(&models.Delegations{}, "idx_delegations_hash") {
+				return migrator.CreateIndex(&models.Delegations{}, "idx_delegations_hash")
+			}
+			return nil
+		},
+	},
+	{
+		Version:     4,
+		Description: "index delegations by delegator",
+		Up: func(tx *gorm.DB) error {
+			// The delegator was a TEXT column, which MySQL cannot index without a prefix length.
+			migrator := tx.Migrator()
+			if err := migrator.AlterColumn(&models.Delegations{}, "Delegator"); err != nil {
+				return err
+			}
+			if !migrator.HasIndex(&models.Delegations{}, "idx_delegations_delegator_timestamp") {
+				return migrator.CreateIndex(&models.Delegations{}, "idx_delegations_delegator_timestamp")
+			}
+			return nil
+		},
+	},
+	{
+		Version:     5,
+		Description: "create data_versions table",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&v5DataVersion{})
+		},
+	},
+}
+
+// v1Delegations is the delegations table created by migration 1, the later changes of models.Delegations are applied by
+// their own migrations so a new database goes through the same steps as an upgraded one.
+type v1Delegations struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement"`
+	TezosID   int       `gorm:"uniqueIndex:idx_delegations_tezos_timestamp"`
+	Timestamp time.Time `gorm:"primaryKey;autoIncrement:false;uniqueIndex:idx_delegations_tezos_timestamp"`
+	Amount    int
+	Delegator string
+	Level     int
+}
+
+func (v1Delegations) TableName() string {
+	return delegationsTable
+}
+
+// v1SyncState is the sync_state table created by migration 1.
+type v1SyncState struct {
+	ID          uint
+	Network     string `gorm:"size:64;uniqueIndex:idx_sync_state_network_source"`
+	Source      string `gorm:"size:64;uniqueIndex:idx_sync_state_network_source"`
+	Level       int
+	OperationID int
+	UpdatedAt   time.Time
+}
+
+func (v1SyncState) TableName() string {
+	return "sync_state"
+}
+
+// v1Gap is the gaps table created by migration 1.
+type v1Gap struct {
+	ID          uint
+	From        time.Time `gorm:"column:range_from;uniqueIndex:idx_gaps_range"`
+	To          time.Time `gorm:"column:range_to;uniqueIndex:idx_gaps_range"`
+	LocalCount  int64
+	RemoteCount int64
+	Status      string `gorm:"size:16;index"`
+	Attempts    int
+	LastError   string
+	DetectedAt  time.Time
+	RepairedAt  *time.Time
+}
+
+func (v1Gap) TableName() string {
+	return "gaps"
+}
+
+// v1Lease is the leases table created by migration 1.
+type v1Lease struct {
+	Name       string `gorm:"primaryKey;size:128"`
+	Holder     string `gorm:"size:255"`
+	AcquiredAt time.Time
+	ExpiresAt  time.Time
+}
+
+func (v1Lease) TableName() string {
+	return "leases"
+}
+
+// v2BackfillChunk is the backfill_chunks table created by migration 2.
+type v2BackfillChunk struct {
+	ID              uint
+	Job             string     `gorm:"size:128;uniqueIndex:idx_backfill_chunks_job_number"`
+	Number          int        `gorm:"uniqueIndex:idx_backfill_chunks_job_number"`
+	From            *time.Time `gorm:"column:range_from"`
+	To              *time.Time `gorm:"column:range_to"`
+	FromLevel       int        `gorm:"column:level_from"`
+	ToLevel         int        `gorm:"column:level_to"`
+	LastOperationID int
+	Rows            int64
+	Status          string `gorm:"size:16"`
+	UpdatedAt       time.Time
+}
+
+func (v2BackfillChunk) TableName() string {
+	return "backfill_chunks"
+}
+
+// v5DataVersion is the data_versions table created by migration 5.
+type v5DataVersion struct {
+	ID        uint `gorm:"primaryKey;autoIncrement:false"`
+	Version   int64
+	UpdatedAt time.Time
+}
+
+func (v5DataVersion) TableName() string {
+	return "data_versions"
+}
+
+// Migrate apply the pending schema migrations in order and record each of them in the schema_migrations table.
+// return the versions applied.
+func (c Client) Migrate(ctx context.Context) ([]int, error) {
+	db := c.DB.WithContext(ctx)
+	if err := db.AutoMigrate(&models.SchemaMigration{}); err != nil {
+		return nil, queryError(err)
+	}
+
+	applied, err := c.appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := []int{}
+	for _, m := range migrations {
+		if applied[m.Version] {
+			continue
+		}
+
+		// MySQL commits DDL statements implicitly, the record is only written once the migration succeeded.
+		if err := m.Up(db); err != nil {
+			return versions, fmt.Errorf("migration %d: %w", m.Version, err)
+		}
+
+		res := db.Create(&models.SchemaMigration{Version: m.Version, Description: m.Description, AppliedAt: time.Now().UTC()})
+		if res.Error != nil {
+			return versions, queryError(res.Error)
+		}
+		versions = append(versions, m.Version)
+	}
+
+	return versions, nil
+}
+
+// PendingMigrations return the versions of the migrations not applied yet.
+func (c Client) PendingMigrations(ctx context.Context) ([]int, error) {
+	if !c.DB.WithContext(ctx).Migrator().HasTable(&models.SchemaMigration{}) {
+		pending := make([]int, 0, len(migrations))
+		for _, m := range migrations {
+			pending = append(pending, m.Version)
+		}
+		return pending, nil
+	}
+
+	applied, err := c.appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pending := []int{}
+	for _, m := range migrations {
+		if !applied[m.Version] {
+			pending = append(pending, m.Version)
+		}
+	}
+	return pending, nil
+}
+
+// appliedMigrations return the set of versions recorded in the schema_migrations table.
+func (c Client) appliedMigrations(ctx context.Context) (map[int]bool, error) {
+	var versions []int
+	res := c.DB.WithContext(ctx).Model(&models.SchemaMigration{}).Pluck("version", &versions)
+	if res.Error != nil {
+		return nil, queryError(res.Error)
+	}
+
+	applied := make(map[int]bool, len(versions))
+	for _, v := range versions {
+		applied[v] = true
+	}
+	return applied, nil
+}
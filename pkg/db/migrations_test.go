@@ -0,0 +1,39 @@
+package db
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/kiln-mid/pkg/models"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm/schema"
+)
+
+func TestMigrations_Baseline(t *testing.T) {
+	db := dryRunDB(t)
+	columns := func(model interface{}) (string, []string) {
+		s, err := schema.Parse(model, &sync.Map{}, db.NamingStrategy)
+		require.NoError(t, err)
+		return s.Table, s.DBNames
+	}
+
+	// The tables created by a migration are the current ones without the columns added by the later migrations, a column
+	// added to a model needs its own migration.
+	for _, tt := range []struct {
+		baseline interface{}
+		model    interface{}
+		added    []string
+	}{
+		{baseline: &v1Delegations{}, model: &models.Delegations{}, added: []string{"hash"}},
+		{baseline: &v1SyncState{}, model: &models.SyncState{}},
+		{baseline: &v1Gap{}, model: &models.Gap{}},
+		{baseline: &v1Lease{}, model: &models.Lease{}},
+		{baseline: &v2BackfillChunk{}, model: &models.BackfillChunk{}},
+		{baseline: &v5DataVersion{}, model: &models.DataVersion{}},
+	} {
+		table, baseline := columns(tt.baseline)
+		modelTable, current := columns(tt.model)
+		require.Equal(t, modelTable, table)
+		require.ElementsMatch(t, current, append(baseline, tt.added...), table)
+	}
+}
@@ -0,0 +1,249 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kiln-mid/pkg/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	// delegationsTable is the name of the partitioned table.
+	delegationsTable = "delegations"
+	// delegationsArchiveTable is the table receiving archived partitions.
+	delegationsArchiveTable = "delegations_archive"
+	// maxPartition is the name of the catch-all partition holding rows above the last monthly bound.
+	maxPartition = "pmax"
+	// partitionBoundFormat is the format used by MySQL to describe a RANGE COLUMNS bound on a datetime.
+	partitionBoundFormat = "2006-01-02 15:04:05"
+)
+
+// legacyTezosIDIndexes return the names of the unique key on `tezos_id` created by the `unique` tag of TezosID before the
+// table was partitioned: GORM names the constraint with its naming strategy, and MySQL names an inline UNIQUE column,
+// as created by older GORM versions, after the column.
+func legacyTezosIDIndexes(namer schema.Namer) []string {
+	return []string{namer.UniqueName(delegationsTable, "tezos_id"), "tezos_id"}
+}
+
+type PartitionsRepository interface {
+	EnsurePartitioned(ctx context.Context) error
+	FindPartitions(ctx context.Context) ([]models.Partition, error)
+	CreateMonthlyPartitions(ctx context.Context, until time.Time) ([]string, error)
+	DropPartitions(ctx context.Context, names []string) error
+	ArchivePartitions(ctx context.Context, names []string) error
+}
+
+// NewPartitionsAdapter returns an implementation of the PartitionsRepository using GORM for database interactions.
+func NewPartitionsAdapter(db *gorm.DB) PartitionsRepository {
+	return &PartitionsAdapter{DB: db}
+}
+
+// PartitionsAdapter provides a MySQL implementation of PartitionsRepository, partitions are monthly RANGE COLUMNS partitions on `timestamp`.
+type PartitionsAdapter struct {
+	DB *gorm.DB
+}
+
+// PartitionName return the name of the monthly partition holding t.
+func PartitionName(t time.Time) string {
+	return "p" + t.UTC().Format("200601")
+}
+
+// monthStart return the first instant of the month holding t.
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// partitionDefinition return the SQL definition of the monthly partition starting at month.
+func partitionDefinition(month time.Time) string {
+	return fmt.Sprintf("PARTITION %s VALUES LESS THAN ('%s')", PartitionName(month), month.AddDate(0, 1, 0).Format(partitionBoundFormat))
+}
+
+// indexMigrator tell whether an index exists, it is implemented by gorm.Migrator.
+type indexMigrator interface {
+	HasIndex(value interface{}, name string) bool
+}
+
+// dropLegacyTezosIDIndexes drop the unique keys on `tezos_id` alone, MySQL requires every unique key of a partitioned
+// table to include the partitioning column.
+func dropLegacyTezosIDIndexes(db *gorm.DB, migrator indexMigrator) error {
+	for _, name := range legacyTezosIDIndexes(db.NamingStrategy) {
+		if migrator.HasIndex(&models.Delegations{}, name) {
+			if err := db.Exec(fmt.Sprintf("ALTER TABLE %s DROP INDEX `%s`", delegationsTable, name)).Error; err != nil {
+				return queryError(err)
+			}
+		}
+	}
+	return nil
+}
+
+// EnsurePartitioned convert the delegations table into a monthly partitioned table if it is not already the case.
+// Keys created before partitioning are rebuilt to include `timestamp`, one partition is created per month from the oldest row to the current month.
+func (r *PartitionsAdapter) EnsurePartitioned(ctx context.Context) error {
+	partitions, err := r.FindPartitions(ctx)
+	if err != nil {
+		return err
+	}
+	if len(partitions) > 0 {
+		return nil
+	}
+
+	db := r.DB.WithContext(ctx)
+	migrator := db.Migrator()
+	if err := dropLegacyTezosIDIndexes(db, migrator); err != nil {
+		return err
+	}
+	if !migrator.HasIndex(&models.Delegations{}, "idx_delegations_tezos_timestamp") {
+		if err := migrator.CreateIndex(&models.Delegations{}, "idx_delegations_tezos_timestamp"); err != nil {
+			return queryError(err)
+		}
+	}
+
+	var primaryKey []string
+	res := db.Raw(`SELECT COLUMN_NAME FROM information_schema.KEY_COLUMN_USAGE
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND CONSTRAINT_NAME = 'PRIMARY'`, delegationsTable).
+		Scan(&primaryKey)
+	if res.Error != nil {
+		return queryError(res.Error)
+	}
+	if len(primaryKey) == 1 {
+		if err := db.Exec(fmt.Sprintf("ALTER TABLE %s DROP PRIMARY KEY, ADD PRIMARY KEY (id, timestamp)", delegationsTable)).Error; err != nil {
+			return queryError(err)
+		}
+	}
+
+	var oldest sql.NullTime
+	if err := db.Model(&models.Delegations{}).Select("MIN(timestamp)").Row().Scan(&oldest); err != nil {
+		return queryError(err)
+	}
+	current := monthStart(time.Now())
+	month := current
+	if oldest.Valid {
+		month = monthStart(oldest.Time)
+	}
+
+	definitions := []string{}
+	for ; !month.After(current); month = month.AddDate(0, 1, 0) {
+		definitions = append(definitions, partitionDefinition(month))
+	}
+	definitions = append(definitions, fmt.Sprintf("PARTITION %s VALUES LESS THAN (MAXVALUE)", maxPartition))
+
+	statement := fmt.Sprintf("ALTER TABLE %s PARTITION BY RANGE COLUMNS(timestamp) (%s)", delegationsTable, strings.Join(definitions, ", "))
+	if err := db.Exec(statement).Error; err != nil {
+		return queryError(err)
+	}
+	return nil
+}
+
+// FindPartitions return the partitions of the delegations table ordered by bound, an empty slice is returned if the table is not partitioned.
+func (r *PartitionsAdapter) FindPartitions(ctx context.Context) ([]models.Partition, error) {
+	var rows []struct {
+		Name        string
+		Description string
+		Rows        int64
+	}
+	res := r.DB.WithContext(ctx).Raw(`SELECT PARTITION_NAME AS name, PARTITION_DESCRIPTION AS description, TABLE_ROWS AS `+"`rows`"+`
+		FROM information_schema.PARTITIONS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND PARTITION_NAME IS NOT NULL
+		ORDER BY PARTITION_ORDINAL_POSITION`, delegationsTable).Scan(&rows)
+	if res.Error != nil {
+		return nil, queryError(res.Error)
+	}
+
+	partitions := make([]models.Partition, 0, len(rows))
+	for _, row := range rows {
+		p := models.Partition{Name: row.Name, Rows: row.Rows}
+		if row.Description != "MAXVALUE" {
+			lessThan, err := time.Parse(partitionBoundFormat, strings.Trim(row.Description, "'"))
+			if err != nil {
+				return nil, fmt.Errorf("partition %s bound: %w", row.Name, err)
+			}
+			p.LessThan = lessThan
+		}
+		partitions = append(partitions, p)
+	}
+	return partitions, nil
+}
+
+// CreateMonthlyPartitions split the MAXVALUE partition so a monthly partition exists for every month up to until included.
+// return the names of the created partitions.
+func (r *PartitionsAdapter) CreateMonthlyPartitions(ctx context.Context, until time.Time) ([]string, error) {
+	partitions, err := r.FindPartitions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(partitions) == 0 {
+		return nil, fmt.Errorf("table %s is not partitioned", delegationsTable)
+	}
+
+	var next time.Time
+	for _, p := range partitions {
+		if p.LessThan.After(next) {
+			next = p.LessThan
+		}
+	}
+	if next.IsZero() {
+		next = monthStart(time.Now())
+	}
+
+	created := []string{}
+	definitions := []string{}
+	for month := next; !month.After(monthStart(until)); month = month.AddDate(0, 1, 0) {
+		created = append(created, PartitionName(month))
+		definitions = append(definitions, partitionDefinition(month))
+	}
+	if len(definitions) == 0 {
+		return created, nil
+	}
+	definitions = append(definitions, fmt.Sprintf("PARTITION %s VALUES LESS THAN (MAXVALUE)", maxPartition))
+
+	statement := fmt.Sprintf("ALTER TABLE %s REORGANIZE PARTITION %s INTO (%s)", delegationsTable, maxPartition, strings.Join(definitions, ", "))
+	if err := r.DB.WithContext(ctx).Exec(statement).Error; err != nil {
+		return nil, queryError(err)
+	}
+	return created, nil
+}
+
+// DropPartitions drop the given partitions and every row they hold, then bump the data version.
+// MySQL commits the DROP PARTITION implicitly, the bump cannot share its transaction.
+func (r *PartitionsAdapter) DropPartitions(ctx context.Context, names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+	db := r.DB.WithContext(ctx)
+	statement := fmt.Sprintf("ALTER TABLE %s DROP PARTITION %s", delegationsTable, strings.Join(names, ", "))
+	if err := db.Exec(statement).Error; err != nil {
+		return queryError(err)
+	}
+	return bumpDataVersion(db)
+}
+
+// ArchivePartitions copy the rows of the given partitions into the archive table then drop the partitions.
+// The archive table is created on first use with the same columns as delegations but without partitioning.
+func (r *PartitionsAdapter) ArchivePartitions(ctx context.Context, names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+	db := r.DB.WithContext(ctx)
+	if !db.Migrator().HasTable(delegationsArchiveTable) {
+		if err := db.Exec(fmt.Sprintf("CREATE TABLE %s LIKE %s", delegationsArchiveTable, delegationsTable)).Error; err != nil {
+			return queryError(err)
+		}
+		if err := db.Exec(fmt.Sprintf("ALTER TABLE %s REMOVE PARTITIONING", delegationsArchiveTable)).Error; err != nil {
+			return queryError(err)
+		}
+	}
+
+	for _, name := range names {
+		statement := fmt.Sprintf("INSERT IGNORE INTO %s SELECT * FROM %s PARTITION (%s)", delegationsArchiveTable, delegationsTable, name)
+		if err := db.Exec(statement).Error; err != nil {
+			return queryError(err)
+		}
+	}
+	return r.DropPartitions(ctx, names)
+}
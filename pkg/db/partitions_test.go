@@ -0,0 +1,94 @@
+package db
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// legacyDelegations is the delegations model before the table was partitioned.
+type legacyDelegations struct {
+	ID        uint
+	TezosID   int `gorm:"unique"`
+	Timestamp time.Time
+}
+
+func (legacyDelegations) TableName() string {
+	return delegationsTable
+}
+
+// fakeIndexMigrator report the indexes of a table.
+type fakeIndexMigrator map[string]bool
+
+func (f fakeIndexMigrator) HasIndex(value interface{}, name string) bool {
+	return f[name]
+}
+
+func TestDropLegacyTezosIDIndexes(t *testing.T) {
+	db := dryRunDB(t)
+
+	// The unique key is the one GORM creates for the legacy model.
+	s, err := schema.Parse(&legacyDelegations{}, &sync.Map{}, db.NamingStrategy)
+	require.NoError(t, err)
+	uniques := s.ParseUniqueConstraints()
+	require.Len(t, uniques, 1)
+	var unique string
+	for name := range uniques {
+		unique = name
+	}
+	require.Equal(t, "uni_delegations_tezos_id", unique)
+	require.Contains(t, legacyTezosIDIndexes(db.NamingStrategy), unique)
+
+	for _, tt := range []struct {
+		name       string
+		indexes    fakeIndexMigrator
+		statements []string
+	}{
+		{
+			name:       "gorm constraint",
+			indexes:    fakeIndexMigrator{unique: true, "idx_delegations_tezos_timestamp": true},
+			statements: []string{"ALTER TABLE delegations DROP INDEX `uni_delegations_tezos_id`"},
+		},
+		{
+			name:       "inline unique column",
+			indexes:    fakeIndexMigrator{"tezos_id": true},
+			statements: []string{"ALTER TABLE delegations DROP INDEX `tezos_id`"},
+		},
+		{
+			name:    "already dropped",
+			indexes: fakeIndexMigrator{"idx_delegations_tezos_timestamp": true},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			statements := []string{}
+			db := dryRunDB(t)
+			require.NoError(t, db.Callback().Raw().Register("test:capture", func(tx *gorm.DB) {
+				statements = append(statements, tx.Statement.SQL.String())
+			}))
+
+			require.NoError(t, dropLegacyTezosIDIndexes(db, tt.indexes))
+			require.Equal(t, append([]string{}, tt.statements...), statements)
+		})
+	}
+}
+
+func TestPartitionsAdapter_DropPartitions(t *testing.T) {
+	db := dryRunDB(t)
+	statements := []string{}
+	require.NoError(t, db.Callback().Raw().Register("test:capture", func(tx *gorm.DB) {
+		statements = append(statements, tx.Statement.SQL.String())
+	}))
+	db, creates, _ := captureCreates(t, db)
+
+	// The rows dropped change the pages already served, the data version is bumped.
+	require.NoError(t, NewPartitionsAdapter(db).DropPartitions(context.Background(), []string{"p202301", "p202302"}))
+	require.Equal(t, []string{"ALTER TABLE delegations DROP PARTITION p202301, p202302"}, statements)
+	require.Len(t, *creates, 1)
+	require.Contains(t, (*creates)[0], "INSERT INTO `data_versions`")
+	require.Contains(t, (*creates)[0], "ON DUPLICATE KEY UPDATE `updated_at`=VALUES(updated_at),`version`=version + 1")
+}
@@ -0,0 +1,164 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DefaultMaxReplicationLag is the default lag above which a replica stop receiving reads.
+const DefaultMaxReplicationLag = 5 * time.Second
+
+// replicaCheckInterval is the minimum duration between two lag checks of the same replica.
+const replicaCheckInterval = 5 * time.Second
+
+// replicaCheckTimeout bound a lag check, which runs with its own context rather than the one of the read triggering it.
+const replicaCheckTimeout = 2 * time.Second
+
+// replicaLagColumns are the columns of `SHOW REPLICA STATUS` holding the lag in seconds, depending on the MySQL version.
+var replicaLagColumns = []string{"Seconds_Behind_Source", "Seconds_Behind_Master"}
+
+// lagSource return the replication lag of a replica connection.
+type lagSource func(ctx context.Context, db *gorm.DB) (time.Duration, error)
+
+// ReplicaPool route reads on replicas whose replication lag is under MaxLag, in a round robin fashion.
+// Reads fall back on the primary when no replica is available.
+// The lags are checked in the background, a read never waits for a check: it uses the outcome of the last one, a replica
+// not checked yet is unavailable.
+type ReplicaPool struct {
+	MaxLag   time.Duration
+	primary  *gorm.DB
+	replicas []*replica
+	next     atomic.Uint64
+	lag      lagSource
+}
+
+// replica hold a replica connection and the outcome of its last lag check.
+type replica struct {
+	db       *gorm.DB
+	checking atomic.Bool
+
+	// mu guards the outcome of the last check.
+	mu        sync.Mutex
+	checkedAt time.Time
+	available bool
+}
+
+// NewReplicaPool return a ReplicaPool reading from replicas and falling back on primary.
+func NewReplicaPool(primary *gorm.DB, replicas []*gorm.DB, maxLag time.Duration) *ReplicaPool {
+	pool := &ReplicaPool{
+		MaxLag:  maxLag,
+		primary: primary,
+		lag:     replicationLag,
+	}
+	for _, db := range replicas {
+		pool.replicas = append(pool.replicas, &replica{db: db})
+	}
+	return pool
+}
+
+// Reader return a connection to use for reads, the first available replica starting from the next one in line or the primary.
+func (p *ReplicaPool) Reader(ctx context.Context) *gorm.DB {
+	if len(p.replicas) == 0 {
+		return p.primary.WithContext(ctx)
+	}
+
+	start := p.next.Add(1)
+	for i := range p.replicas {
+		r := p.replicas[(start+uint64(i))%uint64(len(p.replicas))]
+		if p.isAvailable(r) {
+			return r.db.WithContext(ctx)
+		}
+	}
+	return p.primary.WithContext(ctx)
+}
+
+// Writer return the primary connection.
+func (p *ReplicaPool) Writer(ctx context.Context) *gorm.DB {
+	return p.primary.WithContext(ctx)
+}
+
+// isAvailable report whether the replica lag was under MaxLag at its last check. A check older than replicaCheckInterval
+// is renewed in the background, a single check runs at a time per replica.
+func (p *ReplicaPool) isAvailable(r *replica) bool {
+	r.mu.Lock()
+	available, stale := r.available, time.Since(r.checkedAt) >= replicaCheckInterval
+	r.mu.Unlock()
+
+	if stale && r.checking.CompareAndSwap(false, true) {
+		go func() {
+			defer r.checking.Store(false)
+			p.check(r)
+		}()
+	}
+	return available
+}
+
+// check measure the lag of the replica and record whether it is available.
+func (p *ReplicaPool) check(r *replica) {
+	ctx, cancel := context.WithTimeout(context.Background(), replicaCheckTimeout)
+	defer cancel()
+
+	lag, err := p.lag(ctx, r.db)
+	if err != nil {
+		slog.WarnContext(ctx, "replica unavailable", "error", err)
+	} else if lag > p.MaxLag {
+		slog.WarnContext(ctx, "replica lagging", "lag", lag, "max_lag", p.MaxLag)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checkedAt = time.Now()
+	r.available = err == nil && lag <= p.MaxLag
+}
+
+// replicationLag return the replication lag reported by `SHOW REPLICA STATUS`.
+// A server which is not replicating is considered up to date, a stopped replication is returned as an error.
+func replicationLag(ctx context.Context, db *gorm.DB) (time.Duration, error) {
+	rows, err := db.WithContext(ctx).Raw("SHOW REPLICA STATUS").Rows()
+	if err != nil {
+		return 0, fmt.Errorf("show replica status: %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return 0, rows.Err()
+	}
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, fmt.Errorf("columns: %w", err)
+	}
+	values := make([]sql.RawBytes, len(columns))
+	dest := make([]any, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return 0, fmt.Errorf("scan: %w", err)
+	}
+
+	for i, column := range columns {
+		for _, lagColumn := range replicaLagColumns {
+			if column != lagColumn {
+				continue
+			}
+			if values[i] == nil {
+				return 0, fmt.Errorf("replication is not running")
+			}
+			seconds, err := strconv.Atoi(string(values[i]))
+			if err != nil {
+				return 0, fmt.Errorf("%s: %w", column, err)
+			}
+			return time.Duration(seconds) * time.Second, nil
+		}
+	}
+	return 0, fmt.Errorf("no lag column in replica status")
+}
@@ -0,0 +1,174 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// lagResult is the outcome of a lag check returned by fakeLags.
+type lagResult struct {
+	lag time.Duration
+	err error
+}
+
+// fakeLags is a lagSource returning the lag configured for each replica.
+type fakeLags struct {
+	mu      sync.Mutex
+	results map[*gorm.DB]lagResult
+	calls   int
+	block   chan struct{}
+}
+
+func (f *fakeLags) lag(ctx context.Context, db *gorm.DB) (time.Duration, error) {
+	f.mu.Lock()
+	f.calls++
+	result := f.results[db]
+	f.mu.Unlock()
+
+	if f.block != nil {
+		<-f.block
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return result.lag, result.err
+}
+
+// newTestReplicaPool return a ReplicaPool over replicas whose lags come from lags.
+func newTestReplicaPool(t *testing.T, replicas []*gorm.DB, lags *fakeLags) *ReplicaPool {
+	pool := NewReplicaPool(dryRunDB(t), replicas, time.Second)
+	pool.lag = lags.lag
+	return pool
+}
+
+// checkReplicas run the lag check of every replica of the pool.
+func checkReplicas(p *ReplicaPool) {
+	for _, r := range p.replicas {
+		p.check(r)
+	}
+}
+
+// readers return the names of the connections the pool hand over to n reads.
+func readers(p *ReplicaPool, names map[string]*gorm.DB, n int) []string {
+	reads := make([]string, n)
+	for i := range reads {
+		reads[i] = connName(p.Reader(context.Background()), names)
+	}
+	return reads
+}
+
+// connName return the name of the connection db was opened from.
+func connName(db *gorm.DB, names map[string]*gorm.DB) string {
+	for name, named := range names {
+		if named.Statement.ConnPool == db.Statement.ConnPool {
+			return name
+		}
+	}
+	return "unknown"
+}
+
+func TestReplicaPool_Reader(t *testing.T) {
+	first, second := dryRunDB(t), dryRunDB(t)
+	errStatus := errors.New("replication status unavailable")
+
+	for _, tt := range []struct {
+		name     string
+		replicas []*gorm.DB
+		results  map[*gorm.DB]lagResult
+		reads    []string
+	}{
+		{
+			name:  "no replicas",
+			reads: []string{"primary", "primary"},
+		},
+		{
+			name:     "replicas under the max lag",
+			replicas: []*gorm.DB{first, second},
+			results:  map[*gorm.DB]lagResult{first: {lag: 0}, second: {lag: time.Second}},
+			reads:    []string{"second", "first", "second"},
+		},
+		{
+			name:     "replica over the max lag",
+			replicas: []*gorm.DB{first, second},
+			results:  map[*gorm.DB]lagResult{first: {lag: 2 * time.Second}, second: {lag: 0}},
+			reads:    []string{"second", "second", "second"},
+		},
+		{
+			name:     "replica status failure",
+			replicas: []*gorm.DB{first, second},
+			results:  map[*gorm.DB]lagResult{first: {lag: 0}, second: {err: errStatus}},
+			reads:    []string{"first", "first", "first"},
+		},
+		{
+			name:     "all replicas excluded",
+			replicas: []*gorm.DB{first, second},
+			results:  map[*gorm.DB]lagResult{first: {lag: time.Minute}, second: {err: errStatus}},
+			reads:    []string{"primary", "primary"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			pool := newTestReplicaPool(t, tt.replicas, &fakeLags{results: tt.results})
+			checkReplicas(pool)
+
+			names := map[string]*gorm.DB{"primary": pool.primary, "first": first, "second": second}
+			require.Equal(t, tt.reads, readers(pool, names, len(tt.reads)))
+		})
+	}
+}
+
+// readsReplica report whether the next read of the pool goes to replica.
+func readsReplica(p *ReplicaPool, replica *gorm.DB) func() bool {
+	return func() bool {
+		return p.Reader(context.Background()).Statement.ConnPool == replica.Statement.ConnPool
+	}
+}
+
+func TestReplicaPool_ReaderBeforeCheck(t *testing.T) {
+	replica := dryRunDB(t)
+	pool := newTestReplicaPool(t, []*gorm.DB{replica}, &fakeLags{results: map[*gorm.DB]lagResult{replica: {lag: 0}}})
+
+	// The first read triggers the check without waiting for it.
+	require.False(t, readsReplica(pool, replica)())
+	require.Eventually(t, readsReplica(pool, replica), time.Second, time.Millisecond)
+}
+
+func TestReplicaPool_ReaderCancelled(t *testing.T) {
+	replica := dryRunDB(t)
+	pool := newTestReplicaPool(t, []*gorm.DB{replica}, &fakeLags{results: map[*gorm.DB]lagResult{replica: {lag: 0}}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// The check does not run on the context of the read, a cancelled request does not exclude the replica.
+	pool.Reader(ctx)
+	require.Eventually(t, readsReplica(pool, replica), time.Second, time.Millisecond)
+}
+
+func TestReplicaPool_ReaderSlowCheck(t *testing.T) {
+	replica := dryRunDB(t)
+	lags := &fakeLags{results: map[*gorm.DB]lagResult{replica: {lag: 0}}, block: make(chan struct{})}
+	pool := newTestReplicaPool(t, []*gorm.DB{replica}, lags)
+
+	// Reads do not wait for a check in flight, nor start another one.
+	for range 3 {
+		require.False(t, readsReplica(pool, replica)())
+	}
+	require.Eventually(t, func() bool {
+		lags.mu.Lock()
+		defer lags.mu.Unlock()
+		return lags.calls == 1
+	}, time.Second, time.Millisecond)
+
+	close(lags.block)
+	require.Eventually(t, readsReplica(pool, replica), time.Second, time.Millisecond)
+
+	lags.mu.Lock()
+	defer lags.mu.Unlock()
+	require.Equal(t, 1, lags.calls)
+}
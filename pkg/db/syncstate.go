@@ -0,0 +1,66 @@
+package db
+
+import (
+	"context"
+	"errors"
+
+	"github.com/kiln-mid/pkg/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type SyncStateRepository interface {
+	Find(ctx context.Context, network string, source string) (*models.SyncState, error)
+	FindAll(ctx context.Context) ([]models.SyncState, error)
+	Save(ctx context.Context, state *models.SyncState) error
+}
+
+// NewSyncStateAdapter returns an implementation of the SyncStateRepository using GORM for database interactions.
+func NewSyncStateAdapter(db *gorm.DB) SyncStateRepository {
+	return &SyncStateAdapter{DB: db}
+}
+
+// SyncStateAdapter provides a GORM-based implementation of SyncStateRepository.
+type SyncStateAdapter struct {
+	DB *gorm.DB
+}
+
+// Find return the sync state of a network and a source, nil is returned if the ingestion never ran for them.
+func (r *SyncStateAdapter) Find(ctx context.Context, network string, source string) (*models.SyncState, error) {
+	var s models.SyncState
+	res := r.DB.WithContext(ctx).Where("network = ? AND source = ?", network, source).First(&s)
+	if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if res.Error != nil {
+		return nil, queryError(res.Error)
+	}
+	return &s, nil
+}
+
+// FindAll return the sync states of every network and source.
+func (r *SyncStateAdapter) FindAll(ctx context.Context) ([]models.SyncState, error) {
+	var s []models.SyncState
+	res := r.DB.WithContext(ctx).Order("network, source").Find(&s)
+	if res.Error != nil {
+		return nil, queryError(res.Error)
+	}
+	return s, nil
+}
+
+// Save create or overwrite the sync state of a network and a source.
+func (r *SyncStateAdapter) Save(ctx context.Context, state *models.SyncState) error {
+	return saveSyncState(r.DB.WithContext(ctx), state)
+}
+
+// saveSyncState upsert a sync state on the given connection, it is shared with the transaction inserting delegations.
+func saveSyncState(db *gorm.DB, state *models.SyncState) error {
+	res := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "network"}, {Name: "source"}},
+		DoUpdates: clause.AssignmentColumns([]string{"level", "operation_id", "updated_at"}),
+	}).Create(state)
+	if res.Error != nil {
+		return queryError(res.Error)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kiln-mid/pkg/models"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// captureCreates record the statements and the variables of the inserts run on db, the returned database runs them
+// outside of the default transaction, which a dry run cannot open.
+func captureCreates(t *testing.T, db *gorm.DB) (*gorm.DB, *[]string, *[][]interface{}) {
+	statements, vars := []string{}, [][]interface{}{}
+	require.NoError(t, db.Callback().Create().After("gorm:create").Register("test:capture", func(tx *gorm.DB) {
+		statements = append(statements, tx.Statement.SQL.String())
+		vars = append(vars, tx.Statement.Vars)
+	}))
+	return db.Session(&gorm.Session{SkipDefaultTransaction: true}), &statements, &vars
+}
+
+func TestSyncStateAdapter_Save(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		state models.SyncState
+	}{
+		{
+			name:  "checkpoint",
+			state: models.SyncState{Network: "mainnet", Source: "tzkt", Level: 100, OperationID: 42},
+		},
+		{
+			// A zero operation id is written, the sync state is rewound rather than left untouched.
+			name:  "rewind to the first delegation",
+			state: models.SyncState{Network: "mainnet", Source: "tzkt"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			db := dryRunDB(t)
+			db, statements, vars := captureCreates(t, db)
+
+			require.NoError(t, NewSyncStateAdapter(db).Save(context.Background(), &tt.state))
+
+			require.Len(t, *statements, 1)
+			require.Contains(t, (*statements)[0], "INSERT INTO `sync_state` (`network`,`source`,`level`,`operation_id`,`updated_at`)")
+			require.Contains(t, (*statements)[0], "ON DUPLICATE KEY UPDATE `level`=VALUES(`level`),`operation_id`=VALUES(`operation_id`),`updated_at`=VALUES(`updated_at`)")
+			require.Equal(t, []interface{}{tt.state.Network, tt.state.Source, tt.state.Level, tt.state.OperationID}, (*vars)[0][:4])
+		})
+	}
+}
+
+func TestDelegationsAdapter_CreateManyAndCheckpointEmpty(t *testing.T) {
+	db := dryRunDB(t)
+	db, statements, vars := captureCreates(t, db)
+
+	// Without delegations the sync state is still saved, outside of any transaction.
+	inserted, err := (&DelegationsAdapter{DB: db}).CreateManyAndCheckpoint(context.Background(), &[]models.Delegations{}, &models.SyncState{Network: "mainnet", Source: "tzkt", Level: 7, OperationID: 43})
+	require.NoError(t, err)
+	require.Zero(t, inserted)
+
+	require.Len(t, *statements, 1)
+	require.Contains(t, (*statements)[0], "INSERT INTO `sync_state`")
+	require.Equal(t, []interface{}{"mainnet", "tzkt", 7, 43}, (*vars)[0][:4])
+}
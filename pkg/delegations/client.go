@@ -3,6 +3,7 @@ package delegations
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"slices"
 	"time"
 
@@ -12,92 +13,233 @@ import (
 	"github.com/kiln-mid/pkg/tezos"
 )
 
+// DefaultCountLimit is the number of delegations counted exactly for the total of a page when SetCountLimit is not called.
+const DefaultCountLimit = 10000
+
+// RetentionPolicy expose the oldest instant for which delegations are still stored.
+type RetentionPolicy interface {
+	Boundary() time.Time
+}
+
+// OutOfRetentionError is returned when delegations are asked before the retention boundary.
+type OutOfRetentionError struct {
+	Boundary time.Time
+}
+
+func (e *OutOfRetentionError) Error() string {
+	return fmt.Sprintf("delegations before %s are no longer retained", e.Boundary.Format(time.DateOnly))
+}
+
+// Observer is notified of the ingestion, it is the extension point of the metrics.
+type Observer interface {
+	// Polled is called with the number of delegations fetched by a poll of new delegations.
+	Polled(fetched int)
+	// Inserted is called with the number of delegations inserted by a poll of new delegations.
+	Inserted(inserted int64)
+	// LagMeasured is called with every lag measured.
+	LagMeasured(lag Lag)
+}
+
 // Client represent the struct of a delegations client.
 type Client struct {
 	tezosClient           *tezos.Client
 	delegationsRepository db.DelegationsRepository
+	syncStateRepository   db.SyncStateRepository
+	retention             RetentionPolicy
+	observer              Observer
+	maxExactCount         int
 }
 
-// NewClient return a new delegations Client to interact with tezos and delegationsRepository.
-func NewClient(tezosClient *tezos.Client, dr db.DelegationsRepository) *Client {
+// NewClient return a new delegations Client to interact with tezos, delegationsRepository and syncStateRepository.
+func NewClient(tezosClient *tezos.Client, dr db.DelegationsRepository, sr db.SyncStateRepository) *Client {
 	return &Client{
 		tezosClient:           tezosClient,
 		delegationsRepository: dr,
+		syncStateRepository:   sr,
 	}
 }
 
+// SetRetention make the client reject queries targeting delegations older than the retention boundary.
+func (c *Client) SetRetention(r RetentionPolicy) {
+	c.retention = r
+}
+
+// SetCountLimit set the number of delegations counted exactly for the total of a page, above that the total is estimated.
+func (c *Client) SetCountLimit(n int) {
+	c.maxExactCount = n
+}
+
+// countLimit return the number of delegations counted exactly, DefaultCountLimit when not set.
+func (c Client) countLimit() int {
+	if c.maxExactCount <= 0 {
+		return DefaultCountLimit
+	}
+	return c.maxExactCount
+}
+
+// SetObserver make the client notify o of the delegations polled and inserted and of the lag measured.
+func (c *Client) SetObserver(o Observer) {
+	c.observer = o
+}
+
+// CheckRetention return an OutOfRetentionError if the whole year is older than the retention boundary, year 0 is always retained.
+func (c Client) CheckRetention(year int) error {
+	if year == 0 || c.retention == nil {
+		return nil
+	}
+	boundary := c.retention.Boundary()
+	if !boundary.IsZero() && !time.Date(year+1, 1, 1, 0, 0, 0, 0, time.UTC).After(boundary) {
+		return &OutOfRetentionError{Boundary: boundary}
+	}
+	return nil
+}
+
+// Page is a page of stored delegations and the metadata of the pagination.
+// Total is the number of delegations matching the query, an estimate when TotalExact is false. HasMore tells whether a next page exists.
+type Page struct {
+	Delegations []models.Delegations
+	Total       int64
+	TotalExact  bool
+	HasMore     bool
+}
+
 // GetDelegations return stored delegations based on params received.
-// year represent the year to search delegations for, if year is equal to 0 it will retrieve Most Recent delegations, year cannot be equal to something non-present in db.
+// year represent the year to search delegations for, if year is equal to 0 it will retrieve Most Recent delegations, an
+// InvalidArgumentError is returned if no delegation of year is stored.
+// an OutOfRetentionError is returned if the whole year is older than the retention boundary, errors of the database match ErrUnavailable when it could not be reached.
 // page represent the current page for the pagination.
 // limit represent the number max of item asked by the client.
-func (c Client) GetDelegations(ctx context.Context, year int, page int, limit int) (*[]models.Delegations, error) {
+func (c Client) GetDelegations(ctx context.Context, year int, page int, limit int) (*Page, error) {
 	offset := limit * (page - 1)
 
+	// One more delegation than asked is read to tell whether a next page exists.
+	var delegations *[]models.Delegations
 	if year == 0 {
-		delegations, err := c.delegationsRepository.FindAndOrderByTimestamp(ctx, limit, offset)
+		var err error
+		delegations, err = c.delegationsRepository.FindAndOrderByTimestamp(ctx, limit+1, offset)
 		if err != nil {
-			return &[]models.Delegations{}, fmt.Errorf("delegationsRepository findAndOrderByTimestamp: %w", err)
+			return nil, repositoryError("delegationsRepository findAndOrderByTimestamp", err)
+		}
+	} else {
+		if err := c.CheckRetention(year); err != nil {
+			return nil, err
+		}
+
+		years, err := c.delegationsRepository.FindAvailableYear(ctx)
+		if err != nil {
+			return nil, repositoryError("delegationsRepository FindAvailableYear", err)
+		}
+
+		if !slices.Contains(*years, year) {
+			return nil, &InvalidArgumentError{
+				Field:  "year",
+				Reason: fmt.Sprintf("no delegation stored for %d, the available years are %s", year, miscellaneous.SplitToString(*years, ",")),
+			}
 		}
 
-		return delegations, nil
+		delegations, err = c.delegationsRepository.FindFromYear(ctx, year, limit+1, offset)
+		if err != nil {
+			return nil, repositoryError("delegationsRepository FindFromYear", err)
+		}
 	}
 
-	years, err := c.delegationsRepository.FindAvailableYear(ctx)
-	if err != nil {
-		return &[]models.Delegations{}, fmt.Errorf("delegationsRepository FindAvailableYear: %w", err)
+	result := &Page{Delegations: *delegations, HasMore: len(*delegations) > limit}
+	if result.HasMore {
+		result.Delegations = result.Delegations[:limit]
 	}
 
-	if !slices.Contains(*years, year) {
-		return &[]models.Delegations{}, fmt.Errorf("Here are the following available years: " + miscellaneous.SplitToString(*years, ","))
+	// The last page, when not empty, gives the total without counting.
+	if !result.HasMore && len(result.Delegations) > 0 {
+		result.Total, result.TotalExact = int64(offset+len(result.Delegations)), true
+		return result, nil
 	}
 
-	delegations, err := c.delegationsRepository.FindFromYear(ctx, year, limit, offset)
+	total, exact, err := c.delegationsRepository.CountFromYear(ctx, year, c.countLimit())
 	if err != nil {
-		return &[]models.Delegations{}, fmt.Errorf("delegationsRepository FindFromYear: %w", err)
+		return nil, repositoryError("delegationsRepository CountFromYear", err)
 	}
-
-	return delegations, nil
+	if result.HasMore {
+		// An estimate must not contradict the delegations read.
+		total = max(total, int64(offset+limit+1))
+	}
+	result.Total, result.TotalExact = total, exact
+	return result, nil
 }
 
 // PollWithOptions poll all delegations matching the provided tezosOptions.
 func (c Client) PollWithOptions(ctx context.Context, options tezos.TezosDelegationsOption) ([]models.Delegations, error) {
-	delegationsResponse, err := c.tezosClient.FetchDelegations(options)
+	delegations, _, err := c.PollPage(ctx, options)
+	return delegations, err
+}
+
+// LastOperation identify the last operation fetched from tzkt by a poll, skipped by parseDelegations or not.
+// Its zero value means tzkt returned no operation.
+type LastOperation struct {
+	ID    int
+	Level int
+}
+
+// PollPage poll a page of delegations matching the provided tezosOptions and return the last operation fetched.
+// The operations skipped by parseDelegations are counted, so a caller paging with IDGreaterThan does not stop on a page
+// without any delegation kept, nor fetch the skipped operations again.
+func (c Client) PollPage(ctx context.Context, options tezos.TezosDelegationsOption) ([]models.Delegations, LastOperation, error) {
+	delegationsResponse, err := c.tezosClient.FetchDelegations(ctx, options)
 	if err != nil {
-		return []models.Delegations{}, err
+		return []models.Delegations{}, LastOperation{}, err
 	}
 
 	delegations, err := c.parseDelegations(delegationsResponse)
 	if err != nil {
-		return []models.Delegations{}, fmt.Errorf("parseDelegations: %w", err)
+		return []models.Delegations{}, LastOperation{}, fmt.Errorf("parseDelegations: %w", err)
 	}
 
-	return delegations, nil
+	var last LastOperation
+	if len(delegationsResponse) > 0 {
+		dr := delegationsResponse[len(delegationsResponse)-1]
+		last = LastOperation{ID: dr.ID, Level: dr.Level}
+	}
+	return delegations, last, nil
 }
 
-// PollNew poll new delegations based on two possibilities.
-// 1. if a delegations is found in database, take the timestamp of the most recent one.
-// 2. if no delegation is found in database, start to fetch the earliest delegation from time.Now().AddDate(0, 0, -1)
-func (c Client) PollNew(ctx context.Context) ([]models.Delegations, error) {
-	recentDelegations, err := c.delegationsRepository.FindMostRecent(ctx)
+// PollNew poll new delegations based on the sync state of the tezos network.
+// 1. if a sync state is found, fetch delegations whose operation id is greater than the checkpoint.
+// 2. if no sync state is found, resume from the most recent delegation found in database.
+// 3. if no delegation is found in database, start to fetch the earliest delegation from time.Now().AddDate(0, 0, -1)
+// The last operation fetched is returned to be checkpointed by CreateAndCheckpoint, the skipped operations are then not fetched again.
+func (c Client) PollNew(ctx context.Context) ([]models.Delegations, LastOperation, error) {
+	state, err := c.syncStateRepository.Find(ctx, c.tezosClient.Network, SyncSource)
 	if err != nil {
-		return []models.Delegations{}, fmt.Errorf("delegationsRepository FindMostRecent: %s", err)
+		return []models.Delegations{}, LastOperation{}, fmt.Errorf("syncStateRepository Find: %w", err)
 	}
 
-	var options = tezos.TezosDelegationsOption{
-		From: time.Now().AddDate(0, 0, -1),
-	}
+	var options = tezos.TezosDelegationsOption{}
 
-	if recentDelegations != nil {
-		options.From = recentDelegations.Timestamp
-		options.IDNotIn = append(options.IDNotIn, recentDelegations.TezosID)
+	if state != nil {
+		options.IDGreaterThan = state.OperationID
+	} else {
+		recentDelegations, err := c.delegationsRepository.FindMostRecent(ctx)
+		if err != nil {
+			return []models.Delegations{}, LastOperation{}, fmt.Errorf("delegationsRepository FindMostRecent: %s", err)
+		}
+
+		options.From = time.Now().AddDate(0, 0, -1)
+		if recentDelegations != nil && recentDelegations.TezosID != 0 {
+			options.From = recentDelegations.Timestamp
+			options.IDNotIn = append(options.IDNotIn, recentDelegations.TezosID)
+		}
 	}
 
-	delegations, err := c.PollWithOptions(ctx, options)
+	delegations, last, err := c.PollPage(ctx, options)
 	if err != nil {
-		return []models.Delegations{}, fmt.Errorf("PollWithOptions: %w", err)
+		return []models.Delegations{}, LastOperation{}, fmt.Errorf("PollPage: %w", err)
 	}
 
-	return delegations, nil
+	slog.DebugContext(ctx, "new delegations polled", "network", c.tezosClient.Network, "delegations", len(delegations), "after_operation_id", options.IDGreaterThan)
+	if c.observer != nil {
+		c.observer.Polled(len(delegations))
+	}
+
+	return delegations, last, nil
 }
 
 // Create call the delegationsRepository to create given delegations
@@ -136,6 +278,7 @@ func (c Client) parseDelegations(delegationsResponse []tezos.DelegationResponse)
 			Level:     dr.Level,
 			Amount:    dr.Amount,
 			Delegator: dr.Sender.Address,
+			Hash:      dr.Hash,
 		}
 
 		delegations = append(delegations, d)
@@ -143,3 +286,23 @@ func (c Client) parseDelegations(delegationsResponse []tezos.DelegationResponse)
 
 	return delegations, nil
 }
+
+// LastInserted return the last inserted delegation of year, of every year when year is 0, nil is returned if none is stored.
+// Its row id changes with every delegation inserted in year, it versions the pages of year.
+func (c Client) LastInserted(ctx context.Context, year int) (*models.Delegations, error) {
+	d, err := c.delegationsRepository.FindLastInserted(ctx, year)
+	if err != nil {
+		return nil, repositoryError("delegationsRepository FindLastInserted", err)
+	}
+	return d, nil
+}
+
+// DataVersion return the number of changes made to the stored delegations other than inserts, it versions the pages along
+// with LastInserted.
+func (c Client) DataVersion(ctx context.Context) (int64, error) {
+	v, err := c.delegationsRepository.FindDataVersion(ctx)
+	if err != nil {
+		return 0, repositoryError("delegationsRepository FindDataVersion", err)
+	}
+	return v, nil
+}
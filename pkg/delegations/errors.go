@@ -0,0 +1,44 @@
+package delegations
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/kiln-mid/pkg/db"
+)
+
+// Sentinel errors matched with errors.Is by the errors returned by the client.
+var (
+	// ErrInvalidArgument is matched by an InvalidArgumentError.
+	ErrInvalidArgument = errors.New("invalid argument")
+	// ErrNotFound is returned when the delegation asked is not stored.
+	ErrNotFound = errors.New("not found")
+	// ErrUnavailable is matched when the database or tzkt could not be reached, the request may succeed later.
+	ErrUnavailable = errors.New("upstream unavailable")
+)
+
+// InvalidArgumentError is returned when an argument is rejected, Field is the name of the argument in the API.
+type InvalidArgumentError struct {
+	Field  string
+	Reason string
+}
+
+func (e *InvalidArgumentError) Error() string {
+	return fmt.Sprintf("invalid %s: %s", e.Field, e.Reason)
+}
+
+// Is match ErrInvalidArgument.
+func (e *InvalidArgumentError) Is(target error) bool {
+	return target == ErrInvalidArgument
+}
+
+// repositoryError return err prefixed with op, matching ErrNotFound or ErrUnavailable when err matches the db ones.
+func repositoryError(op string, err error) error {
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		return fmt.Errorf("%s: %w: %w", op, ErrNotFound, err)
+	case errors.Is(err, db.ErrUnavailable):
+		return fmt.Errorf("%s: %w: %w", op, ErrUnavailable, err)
+	}
+	return fmt.Errorf("%s: %w", op, err)
+}
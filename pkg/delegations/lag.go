@@ -0,0 +1,52 @@
+package delegations
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Lag is the delay of the newest stored delegation behind the head of the chain indexed by tzkt.
+// The newest fields are zero when no delegation is stored, the lag is then measured from the head itself.
+type Lag struct {
+	HeadLevel       int       `json:"head_level"`
+	HeadTimestamp   time.Time `json:"head_timestamp"`
+	NewestLevel     int       `json:"newest_level"`
+	NewestTimestamp time.Time `json:"newest_timestamp"`
+	Seconds         float64   `json:"seconds"`
+	Levels          int       `json:"levels"`
+}
+
+// Lag measure how far the newest stored delegation is behind the tzkt head, in seconds and in levels.
+// Delegations are not produced by every block, so a small lag is expected even when the ingestion is up to date.
+func (c Client) Lag(ctx context.Context) (Lag, error) {
+	head, err := c.tezosClient.FetchHead(ctx)
+	if err != nil {
+		return Lag{}, fmt.Errorf("tezosClient FetchHead: %w", err)
+	}
+
+	newest, err := c.delegationsRepository.FindMostRecent(ctx)
+	if err != nil {
+		return Lag{}, fmt.Errorf("delegationsRepository FindMostRecent: %w", err)
+	}
+
+	lag := Lag{
+		HeadLevel:     head.Level,
+		HeadTimestamp: head.Timestamp,
+	}
+	if newest != nil && newest.TezosID != 0 {
+		lag.NewestLevel = newest.Level
+		lag.NewestTimestamp = newest.Timestamp
+		lag.Seconds = max(0, head.Timestamp.Sub(newest.Timestamp).Seconds())
+		lag.Levels = max(0, head.Level-newest.Level)
+	} else {
+		lag.Seconds = time.Since(head.Timestamp).Seconds()
+		lag.Levels = head.Level
+	}
+
+	if c.observer != nil {
+		c.observer.LagMeasured(lag)
+	}
+
+	return lag, nil
+}
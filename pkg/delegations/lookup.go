@@ -0,0 +1,116 @@
+package delegations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/kiln-mid/pkg/db"
+	"github.com/kiln-mid/pkg/models"
+	"github.com/kiln-mid/pkg/tezos"
+)
+
+// GetDelegation return the stored delegation whose tzkt operation id is tezosID.
+// With refresh, a delegation which is not stored is fetched from tzkt and stored. ErrNotFound is returned when it is
+// neither stored nor, with refresh, known by tzkt.
+func (c Client) GetDelegation(ctx context.Context, tezosID int, refresh bool) (*models.Delegations, error) {
+	find := func(ctx context.Context) (*models.Delegations, error) {
+		return c.delegationsRepository.FindByTezosID(ctx, tezosID)
+	}
+	return c.lookup(ctx, find, tezos.TezosDelegationsOption{ID: tezosID}, refresh)
+}
+
+// GetOperation return the stored delegation of the operation whose hash is hash.
+// With refresh, a delegation which is not stored is fetched from tzkt and stored. ErrNotFound is returned when it is
+// neither stored nor, with refresh, known by tzkt.
+func (c Client) GetOperation(ctx context.Context, hash string, refresh bool) (*models.Delegations, error) {
+	find := func(ctx context.Context) (*models.Delegations, error) {
+		return c.delegationsRepository.FindByHash(ctx, hash)
+	}
+	return c.lookup(ctx, find, tezos.TezosDelegationsOption{Hash: hash}, refresh)
+}
+
+// lookup return the delegation returned by find, or when it is not stored and refresh is set, the one fetched from tzkt with options.
+// With refresh, a stored delegation without hash, ingested before the hash was stored, gets the hash known by tzkt.
+func (c Client) lookup(ctx context.Context, find func(ctx context.Context) (*models.Delegations, error), options tezos.TezosDelegationsOption, refresh bool) (*models.Delegations, error) {
+	stored, err := find(ctx)
+	if err == nil && (!refresh || stored.Hash != "") {
+		return stored, nil
+	}
+	if err != nil && (!refresh || !errors.Is(err, db.ErrNotFound)) {
+		return nil, repositoryError("delegationsRepository find", err)
+	}
+
+	response, err := c.tezosClient.FetchDelegation(ctx, options)
+	if err != nil {
+		if stored != nil {
+			return stored, nil
+		}
+		return nil, fmt.Errorf("tezosClient FetchDelegation: %w: %w", ErrUnavailable, err)
+	}
+	if response == nil {
+		if stored != nil {
+			return stored, nil
+		}
+		return nil, fmt.Errorf("tezosClient FetchDelegation: %w", ErrNotFound)
+	}
+
+	parsed, err := c.parseDelegations([]tezos.DelegationResponse{*response})
+	if err != nil {
+		return nil, fmt.Errorf("parseDelegations: %w", err)
+	}
+	if len(parsed) == 0 {
+		return nil, fmt.Errorf("tezosClient FetchDelegation: %w", ErrNotFound)
+	}
+
+	if c.retention != nil {
+		if boundary := c.retention.Boundary(); !boundary.IsZero() && parsed[0].Timestamp.Before(boundary) {
+			return nil, &OutOfRetentionError{Boundary: boundary}
+		}
+	}
+
+	if _, err := c.delegationsRepository.CreateMany(ctx, &parsed); err != nil {
+		return nil, repositoryError("delegationsRepository CreateMany", err)
+	}
+	// The insert ignores a delegation already stored, which keeps its empty hash.
+	if parsed[0].Hash != "" {
+		if _, err := c.delegationsRepository.FillHash(ctx, parsed[0].TezosID, parsed[0].Hash); err != nil {
+			return nil, repositoryError("delegationsRepository FillHash", err)
+		}
+	}
+
+	// A replica may not have the inserted row yet, the fetched delegation is then returned without its row id.
+	if d, err := find(ctx); err == nil && d.Hash != "" {
+		return d, nil
+	}
+	if stored != nil {
+		stored.Hash = parsed[0].Hash
+		return stored, nil
+	}
+	return &parsed[0], nil
+}
+
+// MaxLookupDelegators is the number of delegators accepted by LatestByDelegators.
+const MaxLookupDelegators = 5000
+
+// LatestByDelegators return the most recent stored delegation of each of delegators which has one, by delegator.
+// An InvalidArgumentError is returned when more than MaxLookupDelegators distinct delegators are given.
+func (c Client) LatestByDelegators(ctx context.Context, delegators []string) (map[string]models.Delegations, error) {
+	distinct := make([]string, 0, len(delegators))
+	seen := make(map[string]bool, len(delegators))
+	for _, delegator := range delegators {
+		if !seen[delegator] {
+			seen[delegator] = true
+			distinct = append(distinct, delegator)
+		}
+	}
+	if len(distinct) > MaxLookupDelegators {
+		return nil, &InvalidArgumentError{Field: "addresses", Reason: fmt.Sprintf("at most %d addresses are accepted, got %d", MaxLookupDelegators, len(distinct))}
+	}
+
+	latest, err := c.delegationsRepository.FindLatestByDelegators(ctx, distinct)
+	if err != nil {
+		return nil, repositoryError("delegationsRepository FindLatestByDelegators", err)
+	}
+	return latest, nil
+}
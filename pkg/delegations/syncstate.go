@@ -0,0 +1,82 @@
+package delegations
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/kiln-mid/pkg/models"
+	"github.com/kiln-mid/pkg/utillog"
+)
+
+// SyncSource is the source recorded in the sync state of delegations fetched from tzkt.
+const SyncSource = "tzkt"
+
+// CreateAndCheckpoint create given delegations and move the sync state of the tezos network to the last operation polled
+// in the same transaction, the operations skipped by the poll included.
+// number of delegations created are returned, the sync state is left untouched when nothing was polled.
+func (c Client) CreateAndCheckpoint(ctx context.Context, delegations []models.Delegations, last LastOperation) (int64, error) {
+	if len(delegations) == 0 && last.ID == 0 {
+		if c.observer != nil {
+			c.observer.Inserted(0)
+		}
+		return 0, nil
+	}
+
+	state := models.SyncState{
+		Network:     c.tezosClient.Network,
+		Source:      SyncSource,
+		OperationID: last.ID,
+		Level:       last.Level,
+	}
+	for _, d := range delegations {
+		if d.TezosID > state.OperationID {
+			state.OperationID = d.TezosID
+			state.Level = d.Level
+		}
+	}
+
+	rowsAffected, err := c.delegationsRepository.CreateManyAndCheckpoint(ctx, &delegations, &state)
+	if err != nil {
+		return rowsAffected, fmt.Errorf("createManyAndCheckpoint: %w", err)
+	}
+
+	slog.InfoContext(ctx, "delegations ingested",
+		"network", state.Network,
+		"delegations", len(delegations),
+		utillog.KeyRowsInserted, rowsAffected,
+		"operation_id", state.OperationID,
+		"level", state.Level,
+	)
+	if c.observer != nil {
+		c.observer.Inserted(rowsAffected)
+	}
+
+	return rowsAffected, nil
+}
+
+// GetSyncStates return the sync state of every network and source.
+func (c Client) GetSyncStates(ctx context.Context) ([]models.SyncState, error) {
+	states, err := c.syncStateRepository.FindAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("syncStateRepository FindAll: %w", err)
+	}
+
+	return states, nil
+}
+
+// SetSyncState overwrite the sync state of a network and a source, which rewind or fast-forward the ingestion.
+func (c Client) SetSyncState(ctx context.Context, state models.SyncState) error {
+	if state.Network == "" || state.Source == "" {
+		return fmt.Errorf("network and source are required")
+	}
+	if state.OperationID < 0 || state.Level < 0 {
+		return fmt.Errorf("level and operation id cannot be negative")
+	}
+
+	if err := c.syncStateRepository.Save(ctx, &state); err != nil {
+		return fmt.Errorf("syncStateRepository Save: %w", err)
+	}
+
+	return nil
+}
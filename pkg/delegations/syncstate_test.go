@@ -0,0 +1,282 @@
+package delegations_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/h2non/gock"
+	"github.com/kiln-mid/pkg/db"
+	"github.com/kiln-mid/pkg/delegations"
+	"github.com/kiln-mid/pkg/models"
+	"github.com/kiln-mid/pkg/tezos"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeDelegationsRepository struct {
+	db.DelegationsRepository
+	created    []models.Delegations
+	checkpoint *models.SyncState
+	states     *fakeSyncStateRepository
+	err        error
+}
+
+func (f *fakeDelegationsRepository) CreateManyAndCheckpoint(ctx context.Context, d *[]models.Delegations, state *models.SyncState) (int64, error) {
+	if f.err != nil {
+		return 0, f.err
+	}
+	f.created = append(f.created, *d...)
+	f.checkpoint = state
+	if f.states != nil {
+		if err := f.states.Save(ctx, state); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(*d)), nil
+}
+
+type fakeSyncStateRepository struct {
+	db.SyncStateRepository
+	states []models.SyncState
+	err    error
+}
+
+func (f *fakeSyncStateRepository) Find(ctx context.Context, network string, source string) (*models.SyncState, error) {
+	for _, s := range f.states {
+		if s.Network == network && s.Source == source {
+			return &s, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeSyncStateRepository) Save(ctx context.Context, state *models.SyncState) error {
+	if f.err != nil {
+		return f.err
+	}
+	for i, s := range f.states {
+		if s.Network == state.Network && s.Source == state.Source {
+			f.states[i] = *state
+			return nil
+		}
+	}
+	f.states = append(f.states, *state)
+	return nil
+}
+
+func TestClient_CreateAndCheckpoint(t *testing.T) {
+	timestamp := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, tt := range []struct {
+		name        string
+		delegations []models.Delegations
+		last        delegations.LastOperation
+		err         error
+		inserted    int64
+		checkpoint  *models.SyncState
+		wantErr     bool
+	}{
+		{
+			name:     "no delegations",
+			inserted: 0,
+		},
+		{
+			name: "checkpoint on the greatest operation id",
+			delegations: []models.Delegations{
+				{TezosID: 12, Level: 20, Timestamp: timestamp},
+				{TezosID: 15, Level: 21, Timestamp: timestamp},
+				{TezosID: 10, Level: 19, Timestamp: timestamp},
+			},
+			last:       delegations.LastOperation{ID: 15, Level: 21},
+			inserted:   3,
+			checkpoint: &models.SyncState{Network: tezos.DefaultNetwork, Source: delegations.SyncSource, Level: 21, OperationID: 15},
+		},
+		{
+			name: "checkpoint on trailing skipped operations",
+			delegations: []models.Delegations{
+				{TezosID: 12, Level: 20, Timestamp: timestamp},
+			},
+			last:       delegations.LastOperation{ID: 18, Level: 22},
+			inserted:   1,
+			checkpoint: &models.SyncState{Network: tezos.DefaultNetwork, Source: delegations.SyncSource, Level: 22, OperationID: 18},
+		},
+		{
+			name:       "every operation skipped",
+			last:       delegations.LastOperation{ID: 18, Level: 22},
+			inserted:   0,
+			checkpoint: &models.SyncState{Network: tezos.DefaultNetwork, Source: delegations.SyncSource, Level: 22, OperationID: 18},
+		},
+		{
+			name:        "insert failure",
+			delegations: []models.Delegations{{TezosID: 12, Level: 20, Timestamp: timestamp}},
+			last:        delegations.LastOperation{ID: 12, Level: 20},
+			err:         errors.New("deadlock"),
+			wantErr:     true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			repository := &fakeDelegationsRepository{err: tt.err}
+			client := delegations.NewClient(tezos.NewClient(), repository, &fakeSyncStateRepository{})
+
+			inserted, err := client.CreateAndCheckpoint(context.Background(), tt.delegations, tt.last)
+			if tt.wantErr {
+				require.ErrorIs(t, err, tt.err)
+				require.Nil(t, repository.checkpoint)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.inserted, inserted)
+			require.Equal(t, tt.checkpoint, repository.checkpoint)
+		})
+	}
+}
+
+func TestClient_SetSyncState(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		state   models.SyncState
+		err     error
+		wantErr string
+	}{
+		{
+			name:  "fast-forward",
+			state: models.SyncState{Network: tezos.DefaultNetwork, Source: delegations.SyncSource, Level: 100, OperationID: 42},
+		},
+		{
+			name:  "rewind to the first delegation",
+			state: models.SyncState{Network: tezos.DefaultNetwork, Source: delegations.SyncSource},
+		},
+		{
+			name:    "missing network",
+			state:   models.SyncState{Source: delegations.SyncSource, OperationID: 42},
+			wantErr: "network and source are required",
+		},
+		{
+			name:    "missing source",
+			state:   models.SyncState{Network: tezos.DefaultNetwork, OperationID: 42},
+			wantErr: "network and source are required",
+		},
+		{
+			name:    "negative operation id",
+			state:   models.SyncState{Network: tezos.DefaultNetwork, Source: delegations.SyncSource, OperationID: -1},
+			wantErr: "level and operation id cannot be negative",
+		},
+		{
+			name:    "negative level",
+			state:   models.SyncState{Network: tezos.DefaultNetwork, Source: delegations.SyncSource, Level: -1},
+			wantErr: "level and operation id cannot be negative",
+		},
+		{
+			name:    "save failure",
+			state:   models.SyncState{Network: tezos.DefaultNetwork, Source: delegations.SyncSource, OperationID: 42},
+			err:     errors.New("connection refused"),
+			wantErr: "syncStateRepository Save: connection refused",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			repository := &fakeSyncStateRepository{
+				states: []models.SyncState{{Network: tezos.DefaultNetwork, Source: delegations.SyncSource, Level: 50, OperationID: 21}},
+				err:    tt.err,
+			}
+			client := delegations.NewClient(tezos.NewClient(), &fakeDelegationsRepository{}, repository)
+
+			err := client.SetSyncState(context.Background(), tt.state)
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				require.Equal(t, 21, repository.states[0].OperationID)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, []models.SyncState{tt.state}, repository.states)
+		})
+	}
+}
+
+func TestClient_PollNewAfterSetSyncState(t *testing.T) {
+	defer gock.Off()
+	gock.DisableNetworking()
+	gock.Intercept()
+
+	for _, tt := range []struct {
+		name        string
+		operationID int
+		query       url.Values
+	}{
+		{
+			name:        "resume after the operation id",
+			operationID: 42,
+			query:       url.Values{"id.gt": {"42"}, "limit": {"500"}},
+		},
+		{
+			// IDGreaterThan is ignored when 0, the poll has no lower bound and restarts from the first delegation of tzkt.
+			name:        "rewind to the first delegation",
+			operationID: 0,
+			query:       url.Values{"limit": {"500"}},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var query url.Values
+			gock.New("https://api.tzkt.io").Get("/v1/operations/delegations").
+				AddMatcher(func(req *http.Request, _ *gock.Request) (bool, error) {
+					query = req.URL.Query()
+					return true, nil
+				}).
+				Reply(200).BodyString(`[{"id": 43, "level": 7, "timestamp": "2024-01-01T10:00:00Z", "sender": {"address": "foo"}, "amount": 10}]`)
+
+			client := delegations.NewClient(tezos.NewClient(), &fakeDelegationsRepository{}, &fakeSyncStateRepository{})
+			require.NoError(t, client.SetSyncState(context.Background(), models.SyncState{
+				Network:     tezos.DefaultNetwork,
+				Source:      delegations.SyncSource,
+				OperationID: tt.operationID,
+			}))
+
+			polled, last, err := client.PollNew(context.Background())
+			require.NoError(t, err)
+			require.Len(t, polled, 1)
+			require.Equal(t, delegations.LastOperation{ID: 43, Level: 7}, last)
+			require.Equal(t, tt.query, query)
+			require.True(t, gock.IsDone())
+		})
+	}
+}
+
+func TestClient_PollNewSkippedOperations(t *testing.T) {
+	defer gock.Off()
+	gock.DisableNetworking()
+	gock.Intercept()
+
+	// Every operation after the checkpoint is skipped, then a delegation follows.
+	gock.New("https://api.tzkt.io").Get("/v1/operations/delegations").
+		MatchParam("id.gt", "42").
+		Reply(200).BodyString(`[
+			{"id": 43, "level": 7, "timestamp": "2024-01-01T10:00:00Z", "sender": {}, "amount": 10},
+			{"id": 44, "level": 8, "timestamp": "2024-01-01T10:01:00Z", "sender": {}, "amount": 20}
+		]`)
+	gock.New("https://api.tzkt.io").Get("/v1/operations/delegations").
+		MatchParam("id.gt", "44").
+		Reply(200).BodyString(`[{"id": 45, "level": 9, "timestamp": "2024-01-01T10:02:00Z", "sender": {"address": "foo"}, "amount": 30}]`)
+
+	syncStateRepository := &fakeSyncStateRepository{states: []models.SyncState{
+		{Network: tezos.DefaultNetwork, Source: delegations.SyncSource, Level: 6, OperationID: 42},
+	}}
+	delegationsRepository := &fakeDelegationsRepository{states: syncStateRepository}
+	client := delegations.NewClient(tezos.NewClient(), delegationsRepository, syncStateRepository)
+
+	for _, expected := range []models.SyncState{
+		{Network: tezos.DefaultNetwork, Source: delegations.SyncSource, Level: 8, OperationID: 44},
+		{Network: tezos.DefaultNetwork, Source: delegations.SyncSource, Level: 9, OperationID: 45},
+	} {
+		polled, last, err := client.PollNew(context.Background())
+		require.NoError(t, err)
+		_, err = client.CreateAndCheckpoint(context.Background(), polled, last)
+		require.NoError(t, err)
+		require.Equal(t, []models.SyncState{expected}, syncStateRepository.states)
+	}
+
+	require.True(t, gock.IsDone())
+	require.Len(t, delegationsRepository.created, 1)
+	require.Equal(t, 45, delegationsRepository.created[0].TezosID)
+}
@@ -0,0 +1,181 @@
+package gaps
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/kiln-mid/pkg/db"
+	"github.com/kiln-mid/pkg/delegations"
+	"github.com/kiln-mid/pkg/models"
+	"github.com/kiln-mid/pkg/tezos"
+)
+
+// DefaultLookbackDays is the default number of elapsed days compared with tzkt by each audit.
+const DefaultLookbackDays = 7
+
+// repairPageSize is the number of delegations fetched per request when a gap is repaired.
+const repairPageSize = 1000
+
+// Auditor compare the number of delegations stored per day with tzkt, record mismatching days as gaps and repair them.
+type Auditor struct {
+	// LookbackDays is the number of elapsed days compared by each audit, the current day is never audited as it is still being ingested.
+	LookbackDays int
+
+	tezosClient           *tezos.Client
+	delegationsClient     *delegations.Client
+	delegationsRepository db.DelegationsRepository
+	gapsRepository        db.GapsRepository
+	now                   func() time.Time
+}
+
+// NewAuditor return a new Auditor counting delegations with tezosClient and delegationsRepository, repairs are done through delegationsClient.
+func NewAuditor(tezosClient *tezos.Client, delegationsClient *delegations.Client, dr db.DelegationsRepository, gr db.GapsRepository) *Auditor {
+	return &Auditor{
+		LookbackDays:          DefaultLookbackDays,
+		tezosClient:           tezosClient,
+		delegationsClient:     delegationsClient,
+		delegationsRepository: dr,
+		gapsRepository:        gr,
+		now:                   time.Now,
+	}
+}
+
+// Run audit the lookback window then repair every open gap.
+func (a *Auditor) Run(ctx context.Context) error {
+	if _, err := a.Audit(ctx); err != nil {
+		return fmt.Errorf("audit: %w", err)
+	}
+
+	if _, err := a.Repair(ctx); err != nil {
+		return fmt.Errorf("repair: %w", err)
+	}
+
+	return nil
+}
+
+// Audit compare per-day counts between the database and tzkt over the lookback window.
+// Mismatching days are recorded as open gaps and returned.
+func (a *Auditor) Audit(ctx context.Context) ([]models.Gap, error) {
+	now := a.now().UTC()
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	return a.AuditRange(ctx, to.AddDate(0, 0, -a.LookbackDays), to)
+}
+
+// AuditRange compare per-day counts between the database and tzkt for the days between from included and to excluded.
+// from and to are truncated to the day, mismatching days are recorded as open gaps and returned.
+func (a *Auditor) AuditRange(ctx context.Context, from time.Time, to time.Time) ([]models.Gap, error) {
+	now := a.now().UTC()
+	from = from.UTC().Truncate(24 * time.Hour)
+	to = to.UTC().Truncate(24 * time.Hour)
+
+	localCounts, err := a.delegationsRepository.CountPerDay(ctx, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("delegationsRepository CountPerDay: %w", err)
+	}
+
+	gaps := []models.Gap{}
+	for day := from; day.Before(to); day = day.AddDate(0, 0, 1) {
+		next := day.AddDate(0, 0, 1)
+
+		remoteCount, err := a.tezosClient.CountDelegations(ctx, tezos.TezosDelegationsOption{From: day, Before: next})
+		if err != nil {
+			return gaps, fmt.Errorf("tezosClient CountDelegations: %w", err)
+		}
+
+		localCount := localCounts[day.Format(time.DateOnly)]
+		if localCount == remoteCount {
+			continue
+		}
+
+		gap := models.Gap{
+			From:        day,
+			To:          next,
+			LocalCount:  localCount,
+			RemoteCount: remoteCount,
+			Status:      models.GapOpen,
+			DetectedAt:  now,
+		}
+		if err := a.gapsRepository.Save(ctx, &gap); err != nil {
+			return gaps, fmt.Errorf("gapsRepository Save: %w", err)
+		}
+		gaps = append(gaps, gap)
+	}
+
+	return gaps, nil
+}
+
+// Repair fetch again the delegations of every open gap and store the missing ones.
+// A repaired gap is detected again by the next audit if counts still differ.
+// return the number of delegations created.
+func (a *Auditor) Repair(ctx context.Context) (int64, error) {
+	gaps, err := a.gapsRepository.FindByStatus(ctx, models.GapOpen)
+	if err != nil {
+		return 0, fmt.Errorf("gapsRepository FindByStatus: %w", err)
+	}
+
+	var created int64
+	for _, gap := range gaps {
+		nbCreated, err := a.repairGap(ctx, gap)
+		created += nbCreated
+
+		gap.Attempts++
+		gap.Status = models.GapRepaired
+		gap.LastError = ""
+		if err != nil {
+			gap.Status = models.GapFailed
+			gap.LastError = err.Error()
+		} else {
+			repairedAt := a.now().UTC()
+			gap.RepairedAt = &repairedAt
+		}
+
+		if err := a.gapsRepository.Update(ctx, &gap); err != nil {
+			return created, fmt.Errorf("gapsRepository Update: %w", err)
+		}
+	}
+
+	return created, nil
+}
+
+// repairGap page through the delegations of the gap range by operation id and store them.
+// Pages are chained on the operations returned by tzkt, a page whose delegations are all skipped does not end the repair.
+func (a *Auditor) repairGap(ctx context.Context, gap models.Gap) (int64, error) {
+	options := tezos.TezosDelegationsOption{
+		From:   gap.From,
+		Before: gap.To,
+		Limit:  repairPageSize,
+	}
+
+	var created int64
+	for {
+		delegations, last, err := a.delegationsClient.PollPage(ctx, options)
+		if err != nil {
+			return created, fmt.Errorf("PollPage: %w", err)
+		}
+		if last.ID == 0 {
+			return created, nil
+		}
+
+		if len(delegations) > 0 {
+			nbCreated, err := a.delegationsClient.Create(ctx, delegations)
+			if err != nil {
+				return created, fmt.Errorf("create: %w", err)
+			}
+			created += nbCreated
+		}
+
+		options.IDGreaterThan = last.ID
+	}
+}
+
+// GetGaps return the recorded gaps with the given status, every gap is returned when status is empty.
+func (a *Auditor) GetGaps(ctx context.Context, status models.GapStatus) ([]models.Gap, error) {
+	gaps, err := a.gapsRepository.FindByStatus(ctx, status)
+	if err != nil {
+		return nil, fmt.Errorf("gapsRepository FindByStatus: %w", err)
+	}
+
+	return gaps, nil
+}
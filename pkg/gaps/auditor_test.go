@@ -0,0 +1,146 @@
+package gaps
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/h2non/gock"
+	"github.com/kiln-mid/pkg/db"
+	"github.com/kiln-mid/pkg/delegations"
+	"github.com/kiln-mid/pkg/models"
+	"github.com/kiln-mid/pkg/tezos"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeDelegationsRepository struct {
+	db.DelegationsRepository
+	counts  map[string]int64
+	created []models.Delegations
+}
+
+func (f *fakeDelegationsRepository) CreateMany(ctx context.Context, d *[]models.Delegations) (int64, error) {
+	f.created = append(f.created, *d...)
+	return int64(len(*d)), nil
+}
+
+func (f *fakeDelegationsRepository) CountPerDay(ctx context.Context, from time.Time, to time.Time) (map[string]int64, error) {
+	return f.counts, nil
+}
+
+type fakeGapsRepository struct {
+	db.GapsRepository
+	saved   []models.Gap
+	updated []models.Gap
+}
+
+func (f *fakeGapsRepository) FindByStatus(ctx context.Context, status models.GapStatus) ([]models.Gap, error) {
+	gaps := []models.Gap{}
+	for _, gap := range f.saved {
+		if gap.Status == status {
+			gaps = append(gaps, gap)
+		}
+	}
+	return gaps, nil
+}
+
+func (f *fakeGapsRepository) Update(ctx context.Context, gap *models.Gap) error {
+	f.updated = append(f.updated, *gap)
+	return nil
+}
+
+func (f *fakeGapsRepository) Save(ctx context.Context, gap *models.Gap) error {
+	f.saved = append(f.saved, *gap)
+	return nil
+}
+
+func TestAuditor_Audit(t *testing.T) {
+	defer gock.Off()
+	gock.DisableNetworking()
+	gock.Intercept()
+
+	now := time.Date(2024, 1, 3, 10, 0, 0, 0, time.UTC)
+	day1 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	day2 := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	gock.New("https://api.tzkt.io").Get("/v1/operations/delegations/count").
+		MatchParam("timestamp.ge", day1.Format(time.RFC3339)).
+		Reply(200).BodyString("4")
+	gock.New("https://api.tzkt.io").Get("/v1/operations/delegations/count").
+		MatchParam("timestamp.ge", day2.Format(time.RFC3339)).
+		Reply(200).BodyString("2")
+
+	gapsRepository := &fakeGapsRepository{}
+	auditor := NewAuditor(tezos.NewClient(), nil, &fakeDelegationsRepository{
+		counts: map[string]int64{"2024-01-01": 4, "2024-01-02": 1},
+	}, gapsRepository)
+	auditor.LookbackDays = 2
+	auditor.now = func() time.Time { return now }
+
+	gaps, err := auditor.Audit(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []models.Gap{
+		{
+			From:        day2,
+			To:          day2.AddDate(0, 0, 1),
+			LocalCount:  1,
+			RemoteCount: 2,
+			Status:      models.GapOpen,
+			DetectedAt:  now,
+		},
+	}, gaps)
+	require.Equal(t, gaps, gapsRepository.saved)
+	require.True(t, gock.IsDone())
+}
+
+func TestAuditor_RepairSkippedPage(t *testing.T) {
+	defer gock.Off()
+	gock.DisableNetworking()
+	gock.Intercept()
+
+	now := time.Date(2024, 1, 3, 10, 0, 0, 0, time.UTC)
+	day := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	page := func(idGreaterThan string, body string) {
+		request := gock.New("https://api.tzkt.io").Get("/v1/operations/delegations").
+			MatchParam("timestamp.ge", day.Format(time.RFC3339)).
+			MatchParam("timestamp.lt", day.AddDate(0, 0, 1).Format(time.RFC3339))
+		if idGreaterThan != "" {
+			request.MatchParam("id.gt", idGreaterThan)
+		}
+		request.Reply(200).BodyString(body)
+	}
+	page("", `[
+		{"id": 10, "level": 5, "timestamp": "2024-01-02T10:00:00Z", "sender": {"address": "foo"}, "amount": 10},
+		{"id": 11, "level": 5, "timestamp": "2024-01-02T10:00:00Z", "sender": {}, "amount": 20}
+	]`)
+	// Every delegation of the page is skipped, the repair goes on after the last operation of the page.
+	page("11", `[
+		{"id": 12, "level": 6, "timestamp": "2024-01-02T11:00:00Z", "sender": {}, "amount": 30},
+		{"id": 13, "level": 6, "timestamp": "2024-01-02T11:00:00Z", "sender": {}, "amount": 40}
+	]`)
+	page("13", `[{"id": 14, "level": 7, "timestamp": "2024-01-02T12:00:00Z", "sender": {"address": "bar"}, "amount": 50}]`)
+	page("14", `[]`)
+
+	delegationsRepository := &fakeDelegationsRepository{}
+	gapsRepository := &fakeGapsRepository{saved: []models.Gap{
+		{From: day, To: day.AddDate(0, 0, 1), LocalCount: 0, RemoteCount: 4, Status: models.GapOpen, DetectedAt: now},
+	}}
+	auditor := NewAuditor(tezos.NewClient(), delegations.NewClient(tezos.NewClient(), delegationsRepository, nil), delegationsRepository, gapsRepository)
+	auditor.now = func() time.Time { return now }
+
+	created, err := auditor.Repair(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, int64(2), created)
+	require.True(t, gock.IsDone())
+
+	tezosIDs := []int{}
+	for _, d := range delegationsRepository.created {
+		tezosIDs = append(tezosIDs, d.TezosID)
+	}
+	require.Equal(t, []int{10, 14}, tezosIDs)
+
+	require.Len(t, gapsRepository.updated, 1)
+	require.Equal(t, models.GapRepaired, gapsRepository.updated[0].Status)
+	require.Equal(t, 1, gapsRepository.updated[0].Attempts)
+}
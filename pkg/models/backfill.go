@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// BackfillChunkStatus represent the progress of a backfill chunk.
+type BackfillChunkStatus string
+
+const (
+	// BackfillChunkPending is a chunk not entirely fetched yet.
+	BackfillChunkPending BackfillChunkStatus = "pending"
+	// BackfillChunkDone is a chunk whose delegations are all stored.
+	BackfillChunkDone BackfillChunkStatus = "done"
+)
+
+// BackfillChunk represent a part of a backfill job, either a time range [From, To) or a level range [FromLevel, ToLevel).
+// LastOperationID is the tzkt operation id of the last delegation stored, a pending chunk resumes after it.
+type BackfillChunk struct {
+	ID              uint                `json:"id"`
+	Job             string              `json:"job" gorm:"size:128;uniqueIndex:idx_backfill_chunks_job_number"`
+	Number          int                 `json:"number" gorm:"uniqueIndex:idx_backfill_chunks_job_number"`
+	From            *time.Time          `json:"from,omitempty" gorm:"column:range_from"`
+	To              *time.Time          `json:"to,omitempty" gorm:"column:range_to"`
+	FromLevel       int                 `json:"from_level,omitempty" gorm:"column:level_from"`
+	ToLevel         int                 `json:"to_level,omitempty" gorm:"column:level_to"`
+	LastOperationID int                 `json:"last_operation_id"`
+	Rows            int64               `json:"rows"`
+	Status          BackfillChunkStatus `json:"status" gorm:"size:16"`
+	UpdatedAt       time.Time           `json:"updated_at"`
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// DataVersion count the changes made to the stored delegations other than inserts, it versions the pages served with the
+// last inserted delegation. The table holds a single row.
+type DataVersion struct {
+	ID        uint      `json:"-" gorm:"primaryKey;autoIncrement:false"`
+	Version   int64     `json:"version"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -3,11 +3,14 @@ package models
 import "time"
 
 // Delegations represent the delegations structure can be found in db.
+// Hash is the hash of the operation, it is empty for the delegations ingested before it was stored.
+// The primary key and the unique key both include `timestamp` as MySQL requires the partitioning column to be part of every unique key.
 type Delegations struct {
-	ID        uint      `db:"id"`
-	TezosID   int       `json:"id" db:"id_tezos" gorm:"unique"`
-	Timestamp time.Time `json:"timestamp"`
+	ID        uint      `db:"id" gorm:"primaryKey;autoIncrement"`
+	TezosID   int       `json:"id" db:"tezos_id" gorm:"uniqueIndex:idx_delegations_tezos_timestamp"`
+	Timestamp time.Time `json:"timestamp" gorm:"primaryKey;autoIncrement:false;uniqueIndex:idx_delegations_tezos_timestamp;index:idx_delegations_delegator_timestamp,priority:2"`
 	Amount    int       `json:"amount"`
-	Delegator string    `json:"delegator"`
+	Delegator string    `json:"delegator" gorm:"size:64;index:idx_delegations_delegator_timestamp,priority:1"`
 	Level     int       `json:"level"`
+	Hash      string    `json:"hash" gorm:"size:64;index:idx_delegations_hash"`
 }
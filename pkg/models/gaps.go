@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// GapStatus represent the repair status of a gap.
+type GapStatus string
+
+const (
+	// GapOpen is a gap waiting to be repaired.
+	GapOpen GapStatus = "open"
+	// GapRepaired is a gap whose range has been fetched again.
+	GapRepaired GapStatus = "repaired"
+	// GapFailed is a gap whose last repair attempt failed.
+	GapFailed GapStatus = "failed"
+)
+
+// Gap represent a time range [From, To) where the number of delegations stored differ from tzkt.
+type Gap struct {
+	ID          uint       `json:"id"`
+	From        time.Time  `json:"from" gorm:"column:range_from;uniqueIndex:idx_gaps_range"`
+	To          time.Time  `json:"to" gorm:"column:range_to;uniqueIndex:idx_gaps_range"`
+	LocalCount  int64      `json:"local_count"`
+	RemoteCount int64      `json:"remote_count"`
+	Status      GapStatus  `json:"status" gorm:"size:16;index"`
+	Attempts    int        `json:"attempts"`
+	LastError   string     `json:"last_error,omitempty"`
+	DetectedAt  time.Time  `json:"detected_at"`
+	RepairedAt  *time.Time `json:"repaired_at,omitempty"`
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// Lease represent the leadership of a singleton worker, held by Holder until ExpiresAt unless renewed.
+type Lease struct {
+	Name       string    `json:"name" gorm:"primaryKey;size:128"`
+	Holder     string    `json:"holder" gorm:"size:255"`
+	AcquiredAt time.Time `json:"acquired_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+// SchemaMigration record a schema version applied by db.Client.Migrate.
+type SchemaMigration struct {
+	Version     int       `json:"version" gorm:"primaryKey;autoIncrement:false"`
+	Description string    `json:"description" gorm:"size:255"`
+	AppliedAt   time.Time `json:"applied_at"`
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// Partition represent a monthly partition of the delegations table.
+// LessThan is the exclusive upper bound of the partition, a zero LessThan means the partition is the MAXVALUE one.
+type Partition struct {
+	Name     string
+	LessThan time.Time
+	Rows     int64
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// SyncState represent the last delegation processed by the ingestion for a network and a source.
+type SyncState struct {
+	ID          uint      `json:"-"`
+	Network     string    `json:"network" gorm:"size:64;uniqueIndex:idx_sync_state_network_source"`
+	Source      string    `json:"source" gorm:"size:64;uniqueIndex:idx_sync_state_network_source"`
+	Level       int       `json:"level"`
+	OperationID int       `json:"operation_id"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// TableName return the name of the table holding sync states.
+func (SyncState) TableName() string {
+	return "sync_state"
+}
@@ -0,0 +1,109 @@
+package retention
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/kiln-mid/pkg/db"
+)
+
+// Mode represent what happen to partitions older than the retention boundary.
+type Mode string
+
+const (
+	// ModeDrop drop expired partitions and their rows.
+	ModeDrop Mode = "drop"
+	// ModeArchive copy expired partitions into the archive table before dropping them.
+	ModeArchive Mode = "archive"
+)
+
+// DefaultMonthsAhead is the default number of monthly partitions created ahead of the current month.
+const DefaultMonthsAhead = 3
+
+// Policy represent the partitioning and retention policy of the delegations table.
+// Months is the number of months kept in the table including the current one, 0 disables the retention.
+// MonthsAhead is the number of monthly partitions created ahead of the current month.
+type Policy struct {
+	Months      int
+	MonthsAhead int
+	Mode        Mode
+}
+
+// Report represent the outcome of a retention run.
+type Report struct {
+	Created  []string
+	Expired  []string
+	Boundary time.Time
+}
+
+// Client represent the struct of a retention client.
+type Client struct {
+	partitionsRepository db.PartitionsRepository
+	policy               Policy
+	now                  func() time.Time
+}
+
+// NewClient return a new retention Client managing partitions with the given policy.
+func NewClient(pr db.PartitionsRepository, policy Policy) *Client {
+	if policy.MonthsAhead == 0 {
+		policy.MonthsAhead = DefaultMonthsAhead
+	}
+	if policy.Mode == "" {
+		policy.Mode = ModeDrop
+	}
+	return &Client{
+		partitionsRepository: pr,
+		policy:               policy,
+		now:                  time.Now,
+	}
+}
+
+// Boundary return the oldest instant still retained, a zero time is returned if the retention is disabled.
+func (c *Client) Boundary() time.Time {
+	if c.policy.Months <= 0 {
+		return time.Time{}
+	}
+	now := c.now().UTC()
+	return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, -(c.policy.Months - 1), 0)
+}
+
+// Run make sure the table is partitioned, create partitions ahead of time and apply the retention policy.
+func (c *Client) Run(ctx context.Context) (Report, error) {
+	report := Report{Boundary: c.Boundary()}
+
+	if err := c.partitionsRepository.EnsurePartitioned(ctx); err != nil {
+		return report, fmt.Errorf("partitionsRepository EnsurePartitioned: %w", err)
+	}
+
+	created, err := c.partitionsRepository.CreateMonthlyPartitions(ctx, c.now().AddDate(0, c.policy.MonthsAhead, 0))
+	if err != nil {
+		return report, fmt.Errorf("partitionsRepository CreateMonthlyPartitions: %w", err)
+	}
+	report.Created = created
+
+	if report.Boundary.IsZero() {
+		return report, nil
+	}
+
+	partitions, err := c.partitionsRepository.FindPartitions(ctx)
+	if err != nil {
+		return report, fmt.Errorf("partitionsRepository FindPartitions: %w", err)
+	}
+	for _, p := range partitions {
+		if !p.LessThan.IsZero() && !p.LessThan.After(report.Boundary) {
+			report.Expired = append(report.Expired, p.Name)
+		}
+	}
+
+	switch c.policy.Mode {
+	case ModeArchive:
+		err = c.partitionsRepository.ArchivePartitions(ctx, report.Expired)
+	default:
+		err = c.partitionsRepository.DropPartitions(ctx, report.Expired)
+	}
+	if err != nil {
+		return report, fmt.Errorf("apply retention %s: %w", c.policy.Mode, err)
+	}
+	return report, nil
+}
@@ -0,0 +1,88 @@
+package retention
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kiln-mid/pkg/models"
+	"github.com/stretchr/testify/require"
+)
+
+type fakePartitionsRepository struct {
+	partitions []models.Partition
+	created    time.Time
+	dropped    []string
+	archived   []string
+}
+
+func (f *fakePartitionsRepository) EnsurePartitioned(ctx context.Context) error { return nil }
+
+func (f *fakePartitionsRepository) FindPartitions(ctx context.Context) ([]models.Partition, error) {
+	return f.partitions, nil
+}
+
+func (f *fakePartitionsRepository) CreateMonthlyPartitions(ctx context.Context, until time.Time) ([]string, error) {
+	f.created = until
+	return []string{}, nil
+}
+
+func (f *fakePartitionsRepository) DropPartitions(ctx context.Context, names []string) error {
+	f.dropped = names
+	return nil
+}
+
+func (f *fakePartitionsRepository) ArchivePartitions(ctx context.Context, names []string) error {
+	f.archived = names
+	return nil
+}
+
+func TestRetention_Run(t *testing.T) {
+	now := time.Date(2024, 6, 15, 10, 0, 0, 0, time.UTC)
+	partitions := []models.Partition{
+		{Name: "p202403", LessThan: time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{Name: "p202404", LessThan: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)},
+		{Name: "p202405", LessThan: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)},
+		{Name: "p202406", LessThan: time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)},
+		{Name: "pmax"},
+	}
+
+	for _, tt := range []struct {
+		name     string
+		policy   Policy
+		boundary time.Time
+		dropped  []string
+		archived []string
+	}{
+		{
+			name:     "retention disabled",
+			policy:   Policy{},
+			boundary: time.Time{},
+		},
+		{
+			name:     "drop expired partitions",
+			policy:   Policy{Months: 2},
+			boundary: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+			dropped:  []string{"p202403", "p202404"},
+		},
+		{
+			name:     "archive expired partitions",
+			policy:   Policy{Months: 3, Mode: ModeArchive},
+			boundary: time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC),
+			archived: []string{"p202403"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			repository := &fakePartitionsRepository{partitions: partitions}
+			client := NewClient(repository, tt.policy)
+			client.now = func() time.Time { return now }
+
+			report, err := client.Run(context.Background())
+			require.NoError(t, err)
+			require.Equal(t, tt.boundary, report.Boundary)
+			require.Equal(t, tt.dropped, repository.dropped)
+			require.Equal(t, tt.archived, repository.archived)
+			require.Equal(t, now.AddDate(0, DefaultMonthsAhead, 0), repository.created)
+		})
+	}
+}
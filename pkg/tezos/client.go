@@ -1,21 +1,28 @@
 package tezos
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"time"
 
 	"github.com/kiln-mid/pkg/utilhttp"
+	"github.com/kiln-mid/pkg/utillog"
 )
 
 // Client represent a tezosClient.
 type Client struct {
 	HTTP    utilhttp.Client
 	BaseUrl string
+	Network string
 }
 
+// DefaultNetwork is the network served by `https://api.tzkt.io/`.
+const DefaultNetwork = "mainnet"
+
 // NewClient create a new http client to handle request on `https://api.tzkt.io/` api.
 func NewClient() *Client {
 	timeout := 45 * time.Second
@@ -23,29 +30,38 @@ func NewClient() *Client {
 	client := &Client{
 		HTTP:    utilhttp.NewClient(timeout),
 		BaseUrl: `https://api.tzkt.io/`,
+		Network: DefaultNetwork,
 	}
 
 	return client
 }
 
 // fetcher is the tezosFetcher, it is a private function as only tezosClient should call this function.
-func (c *Client) fetcher(path string, params url.Values) ([]byte, error) {
+// The request is bound to ctx and carries the request id of ctx, if any, so tzkt calls can be correlated with the API request.
+func (c *Client) fetcher(ctx context.Context, path string, params url.Values) ([]byte, error) {
 	u, _ := url.ParseRequestURI(c.BaseUrl)
 	u.Path = path
 	u.RawQuery = params.Encode()
 	urlStr := fmt.Sprintf("%v", u)
 
-	req, err := http.NewRequest(http.MethodGet, urlStr, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, urlStr, nil)
 	if err != nil {
 		return nil, fmt.Errorf("new request: %s", err)
 	}
+	if id := utillog.RequestID(ctx); id != "" {
+		req.Header.Set(utillog.RequestIDHeader, id)
+	}
 
+	start := time.Now()
 	resp, err := c.HTTP.Do(req)
 	if err != nil {
+		slog.WarnContext(ctx, "tzkt request failed", utillog.KeyTzktURL, urlStr, "duration", time.Since(start), "error", err)
 		return nil, fmt.Errorf("http Do: %s", err)
 	}
 	defer resp.Body.Close()
 
+	slog.DebugContext(ctx, "tzkt request", utillog.KeyTzktURL, urlStr, "status", resp.StatusCode, "duration", time.Since(start))
+
 	buffer, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, fmt.Errorf("io ReadAll: %s", err)
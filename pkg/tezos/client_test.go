@@ -1,6 +1,7 @@
 package tezos_test
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -67,6 +68,30 @@ func TestTezos_FetchDelegatiosn(t *testing.T) {
 			response:               []tezos.DelegationResponse{},
 			err:                    nil,
 		},
+		{
+			name: "resume after operation id",
+			mocks: []*gock.Mocker{
+				gock.NewMock(
+					gock.NewRequest().URL("https://api.tzkt.io/v1/operations/delegations").MatchParam("id.gt", "42"),
+					gock.NewResponse().BodyString(`[]`).Status(200),
+				),
+			},
+			TezosDelegationsOption: tezos.TezosDelegationsOption{IDGreaterThan: 42},
+			response:               []tezos.DelegationResponse{},
+			err:                    nil,
+		},
+		{
+			name: "level range",
+			mocks: []*gock.Mocker{
+				gock.NewMock(
+					gock.NewRequest().URL("https://api.tzkt.io/v1/operations/delegations").MatchParam("level.ge", "100").MatchParam("level.lt", "200"),
+					gock.NewResponse().BodyString(`[]`).Status(200),
+				),
+			},
+			TezosDelegationsOption: tezos.TezosDelegationsOption{FromLevel: 100, BeforeLevel: 200},
+			response:               []tezos.DelegationResponse{},
+			err:                    nil,
+		},
 	} {
 		t.Run(tt.name, func(t *testing.T) {
 			defer gock.Off()
@@ -77,7 +102,7 @@ func TestTezos_FetchDelegatiosn(t *testing.T) {
 				gock.Register(mock)
 			}
 
-			res, err := tezosClient.FetchDelegations(tt.TezosDelegationsOption)
+			res, err := tezosClient.FetchDelegations(context.Background(), tt.TezosDelegationsOption)
 			require.Equal(t, err, tt.err)
 
 			require.Equal(t, res, tt.response)
@@ -86,3 +111,46 @@ func TestTezos_FetchDelegatiosn(t *testing.T) {
 		})
 	}
 }
+
+func TestTezos_FetchHead(t *testing.T) {
+	defer gock.Off()
+	gock.DisableNetworking()
+	gock.Intercept()
+
+	gock.New("https://api.tzkt.io").Get("/v1/head").
+		Reply(200).BodyString(`{"chain": "mainnet", "level": 5000000, "timestamp": "2024-01-01T10:00:00Z"}`)
+
+	head, err := tezos.NewClient().FetchHead(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 5000000, head.Level)
+	require.Equal(t, time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC), head.Timestamp)
+	require.True(t, gock.IsDone())
+}
+
+func TestTezos_FetchDelegation(t *testing.T) {
+	defer gock.Off()
+	gock.DisableNetworking()
+	gock.Intercept()
+
+	hash := "ooLCq9wNzGa2mNoCgAoW5wvXbnN6nFkFGr7a1xCZt6WGSGhcSbX"
+	gock.New("https://api.tzkt.io").Get("/v1/operations/delegations").MatchParam("hash", hash).MatchParam("limit", "1").
+		Reply(200).BodyString(`[{"id": 42, "hash": "` + hash + `", "level": 7, "timestamp": "2024-01-01T10:00:00Z", "amount": 10, "sender": {"address": "tz1"}}]`)
+	gock.New("https://api.tzkt.io").Get("/v1/operations/delegations").MatchParam("id", "43").MatchParam("limit", "1").
+		Reply(200).BodyString(`[]`)
+
+	tezosClient := tezos.NewClient()
+
+	d, err := tezosClient.FetchDelegation(context.Background(), tezos.TezosDelegationsOption{Hash: hash})
+	require.NoError(t, err)
+	require.Equal(t, 42, d.ID)
+	require.Equal(t, hash, d.Hash)
+	require.Equal(t, "tz1", d.Sender.Address)
+
+	d, err = tezosClient.FetchDelegation(context.Background(), tezos.TezosDelegationsOption{ID: 43})
+	require.NoError(t, err)
+	require.Nil(t, d)
+	require.True(t, gock.IsDone())
+
+	_, err = tezosClient.FetchDelegation(context.Background(), tezos.TezosDelegationsOption{})
+	require.Error(t, err)
+}
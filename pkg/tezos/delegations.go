@@ -2,10 +2,12 @@ package tezos
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/kiln-mid/pkg/miscellaneous"
@@ -13,16 +15,27 @@ import (
 
 // TezosDelegationsOption represent options accepted by the tezosClient.
 type TezosDelegationsOption struct {
-	From    time.Time
-	To      time.Time
+	From time.Time
+	To   time.Time
+	// Before only return delegations strictly older, it is the exclusive counterpart of To.
+	Before  time.Time
 	IDNotIn []int
-	Limit   int
-	Offset  int
+	// IDGreaterThan only return delegations whose operation id is strictly greater, ignored when equal to 0.
+	// Paging by operation id replace offsets, which tzkt caps and which shift when delegations are inserted.
+	IDGreaterThan int
+	// FromLevel and BeforeLevel only return delegations whose level is in [FromLevel, BeforeLevel), each is ignored when equal to 0.
+	FromLevel   int
+	BeforeLevel int
+	// ID and Hash only return the delegation of the operation whose id, or hash, is given, each is ignored when empty.
+	ID    int
+	Hash  string
+	Limit int
 }
 
 // DelegationResponse represent all value handled by the tezosClient from the endpoint "/v1/operations/delegations".
 type DelegationResponse struct {
 	ID        int    `json:"id"`
+	Hash      string `json:"hash"`
 	Level     int    `json:"level"`
 	Timestamp string `json:"timestamp"`
 	Amount    int    `json:"amount"`
@@ -33,6 +46,18 @@ type DelegationResponse struct {
 
 // createParams transform and return TezosDelegationsOptions into a url.Values variable.
 func (c *Client) createParams(options TezosDelegationsOption) url.Values {
+	params := c.createFilterParams(options)
+
+	if options.Limit == 0 {
+		options.Limit = 500
+	}
+	params.Add("limit", strconv.Itoa(options.Limit))
+
+	return params
+}
+
+// createFilterParams transform the filters of TezosDelegationsOptions into a url.Values variable, pagination is left out.
+func (c *Client) createFilterParams(options TezosDelegationsOption) url.Values {
 	params := url.Values{}
 
 	if !options.From.IsZero() {
@@ -43,29 +68,44 @@ func (c *Client) createParams(options TezosDelegationsOption) url.Values {
 		params.Add("timestamp.le", options.To.Format(time.RFC3339))
 	}
 
+	if !options.Before.IsZero() {
+		params.Add("timestamp.lt", options.Before.Format(time.RFC3339))
+	}
+
 	if len(options.IDNotIn) > 0 {
 		IDs := miscellaneous.SplitToString(options.IDNotIn, ",")
 		params.Add("id.ni", IDs)
 	}
 
-	if options.Offset != 0 {
-		params.Add("offset", strconv.Itoa(options.Offset))
+	if options.IDGreaterThan != 0 {
+		params.Add("id.gt", strconv.Itoa(options.IDGreaterThan))
 	}
 
-	if options.Limit == 0 {
-		options.Limit = 500
+	if options.FromLevel != 0 {
+		params.Add("level.ge", strconv.Itoa(options.FromLevel))
+	}
+
+	if options.BeforeLevel != 0 {
+		params.Add("level.lt", strconv.Itoa(options.BeforeLevel))
+	}
+
+	if options.ID != 0 {
+		params.Add("id", strconv.Itoa(options.ID))
+	}
+
+	if options.Hash != "" {
+		params.Add("hash", options.Hash)
 	}
-	params.Add("limit", strconv.Itoa(options.Limit))
 
 	return params
 }
 
 // FetchDelegations fetch all delegations from the endpoint "/v1/operations/delegations"
 // Based on the options present in TezosDelegationsOption it will check that `From` and `To` field are in the format of RFC3339
-func (c *Client) FetchDelegations(options TezosDelegationsOption) ([]DelegationResponse, error) {
+func (c *Client) FetchDelegations(ctx context.Context, options TezosDelegationsOption) ([]DelegationResponse, error) {
 	params := c.createParams(options)
 
-	buffer, err := c.fetcher("/v1/operations/delegations", params)
+	buffer, err := c.fetcher(ctx, "/v1/operations/delegations", params)
 	if err != nil {
 		return []DelegationResponse{}, fmt.Errorf("fetcher: %s", err)
 	}
@@ -80,3 +120,40 @@ func (c *Client) FetchDelegations(options TezosDelegationsOption) ([]DelegationR
 
 	return d, nil
 }
+
+// FetchDelegation fetch the delegation of a single operation, selected by the ID or the Hash of options, nil is returned when tzkt has none.
+// The operation is selected with query parameters rather than `/v1/operations/{hash}` so the path, used as a metric label, stays bounded.
+func (c *Client) FetchDelegation(ctx context.Context, options TezosDelegationsOption) (*DelegationResponse, error) {
+	if options.ID == 0 && options.Hash == "" {
+		return nil, fmt.Errorf("an operation id or hash is required")
+	}
+	options.Limit = 1
+
+	d, err := c.FetchDelegations(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+	if len(d) == 0 {
+		return nil, nil
+	}
+
+	return &d[0], nil
+}
+
+// CountDelegations count the delegations matching the filters of TezosDelegationsOption with the endpoint "/v1/operations/delegations/count".
+// Limit is ignored.
+func (c *Client) CountDelegations(ctx context.Context, options TezosDelegationsOption) (int64, error) {
+	params := c.createFilterParams(options)
+
+	buffer, err := c.fetcher(ctx, "/v1/operations/delegations/count", params)
+	if err != nil {
+		return 0, fmt.Errorf("fetcher: %s", err)
+	}
+
+	count, err := strconv.ParseInt(strings.TrimSpace(string(buffer)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("body count parse: %s", err)
+	}
+
+	return count, nil
+}
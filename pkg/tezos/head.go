@@ -0,0 +1,30 @@
+package tezos
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// HeadResponse represent the values handled by the tezosClient from the endpoint "/v1/head".
+type HeadResponse struct {
+	Level     int       `json:"level"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// FetchHead fetch the level and the timestamp of the last block indexed by tzkt from the endpoint "/v1/head".
+func (c *Client) FetchHead(ctx context.Context) (HeadResponse, error) {
+	buffer, err := c.fetcher(ctx, "/v1/head", nil)
+	if err != nil {
+		return HeadResponse{}, fmt.Errorf("fetcher: %s", err)
+	}
+
+	var head HeadResponse
+	if err := json.NewDecoder(bytes.NewReader(buffer)).Decode(&head); err != nil {
+		return HeadResponse{}, fmt.Errorf("body head unmarshal: %s", err)
+	}
+
+	return head, nil
+}
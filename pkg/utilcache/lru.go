@@ -0,0 +1,79 @@
+package utilcache
+
+import (
+	"container/list"
+	"sync"
+)
+
+// LRU is a cache of at most Size values, adding a value to a full cache evicts the least recently used one.
+// It is safe for concurrent use.
+type LRU[K comparable, V any] struct {
+	size    int
+	mu      sync.Mutex
+	order   *list.List
+	entries map[K]*list.Element
+}
+
+// entry is the element stored in the list of an LRU.
+type entry[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+// NewLRU return a cache of at most size values, size must be positive.
+func NewLRU[K comparable, V any](size int) *LRU[K, V] {
+	return &LRU[K, V]{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[K]*list.Element, size),
+	}
+}
+
+// Get return the value of key and mark it as the most recently used, ok is false when key is not cached.
+func (c *LRU[K, V]) Get(key K) (value V, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return value, false
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*entry[K, V]).value, true
+}
+
+// Add cache value for key as the most recently used, evicting the least recently used value when the cache is full.
+func (c *LRU[K, V]) Add(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*entry[K, V]).value = value
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&entry[K, V]{key: key, value: value})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*entry[K, V]).key)
+	}
+}
+
+// Purge remove every value.
+func (c *LRU[K, V]) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.order.Init()
+	c.entries = make(map[K]*list.Element, c.size)
+}
+
+// Len return the number of values cached.
+func (c *LRU[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
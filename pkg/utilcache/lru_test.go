@@ -0,0 +1,33 @@
+package utilcache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLRU(t *testing.T) {
+	c := NewLRU[string, int](2)
+
+	c.Add("a", 1)
+	c.Add("b", 2)
+	value, ok := c.Get("a")
+	require.True(t, ok)
+	require.Equal(t, 1, value)
+
+	// b is the least recently used since a was read.
+	c.Add("c", 3)
+	_, ok = c.Get("b")
+	require.False(t, ok)
+	require.Equal(t, 2, c.Len())
+
+	c.Add("a", 10)
+	value, _ = c.Get("a")
+	require.Equal(t, 10, value)
+	require.Equal(t, 2, c.Len())
+
+	c.Purge()
+	require.Zero(t, c.Len())
+	_, ok = c.Get("a")
+	require.False(t, ok)
+}
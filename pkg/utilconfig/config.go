@@ -1,45 +1,263 @@
 package utilconfig
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"time"
 
 	"github.com/joho/godotenv"
+	"github.com/kiln-mid/pkg/utillog"
+	"github.com/kiln-mid/pkg/utiltrace"
+	"github.com/kiln-mid/pkg/utilworker"
 )
 
-// solution based on : https://github.com/joho/godotenv/issues/126
+// Config is the configuration of kiln, see Loader for how it is built.
+type Config struct {
+	DB        DBConfig        `yaml:"db" toml:"db"`
+	Tezos     TezosConfig     `yaml:"tezos" toml:"tezos"`
+	HTTP      HTTPConfig      `yaml:"http" toml:"http"`
+	Workers   WorkersConfig   `yaml:"workers" toml:"workers"`
+	Retention RetentionConfig `yaml:"retention" toml:"retention"`
+	Leader    LeaderConfig    `yaml:"leader" toml:"leader"`
+	Log       LogConfig       `yaml:"log" toml:"log"`
+	Tracing   TracingConfig   `yaml:"tracing" toml:"tracing"`
+}
 
-// Load loads the environment variables from the .env file.
-func LoadConfig() {
-	err := godotenv.Load(dir(".env"))
-	if err != nil {
-		panic(fmt.Errorf("error loading .env file: %w", err))
+// DBConfig configure the MySQL connections and how delegations are written.
+type DBConfig struct {
+	DSN               string        `yaml:"dsn" toml:"dsn"`
+	ReplicaDSNs       []string      `yaml:"replica_dsns" toml:"replica_dsns"`
+	MaxReplicationLag time.Duration `yaml:"max_replication_lag" toml:"max_replication_lag"`
+	BatchSize         int           `yaml:"batch_size" toml:"batch_size"`
+	LoadData          bool          `yaml:"load_data" toml:"load_data"`
+}
+
+// TezosConfig configure the tzkt client, RateLimit is the number of requests per second shared by every worker, 0 disables it.
+type TezosConfig struct {
+	BaseURL   string        `yaml:"base_url" toml:"base_url"`
+	Network   string        `yaml:"network" toml:"network"`
+	Timeout   time.Duration `yaml:"timeout" toml:"timeout"`
+	RateLimit float64       `yaml:"rate_limit" toml:"rate_limit"`
+}
+
+// HTTPConfig configure the HTTP servers, Port is the API port of `serve` and IngestPort the administration port of `ingest`.
+// ReadyMaxLag is the ingestion lag above which `/readyz` fails, 0 disables the check.
+// CountLimit is the number of delegations counted exactly for the total of a list, above it the total is estimated.
+// CacheMaxAgeClosed and CacheMaxAgeLive are the `Cache-Control` max-age of the lists of a past year and of the other lists,
+// ResponseCacheSize is the number of lists kept in memory by `serve`, 0 disables the cache.
+type HTTPConfig struct {
+	Port            int           `yaml:"port" toml:"port"`
+	IngestPort      int           `yaml:"ingest_port" toml:"ingest_port"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+	ReadyMaxLag     time.Duration `yaml:"ready_max_lag" toml:"ready_max_lag"`
+	CountLimit      int           `yaml:"count_limit" toml:"count_limit"`
+
+	CacheMaxAgeClosed time.Duration `yaml:"cache_max_age_closed" toml:"cache_max_age_closed"`
+	CacheMaxAgeLive   time.Duration `yaml:"cache_max_age_live" toml:"cache_max_age_live"`
+	ResponseCacheSize int           `yaml:"response_cache_size" toml:"response_cache_size"`
+}
+
+// WorkersConfig configure the schedules and the run deadlines of the workers, schedules are accepted by utilworker.ParseSchedule.
+// The cron schedules run in ScheduleTimezone unless they start with `CRON_TZ=<zone>`.
+type WorkersConfig struct {
+	DelegationsInterval time.Duration `yaml:"delegations_interval" toml:"delegations_interval"`
+	DelegationsTimeout  time.Duration `yaml:"delegations_timeout" toml:"delegations_timeout"`
+	PartitionsSchedule  string        `yaml:"partitions_schedule" toml:"partitions_schedule"`
+	PartitionsTimeout   time.Duration `yaml:"partitions_timeout" toml:"partitions_timeout"`
+	GapsSchedule        string        `yaml:"gaps_schedule" toml:"gaps_schedule"`
+	GapsTimeout         time.Duration `yaml:"gaps_timeout" toml:"gaps_timeout"`
+	GapsLookbackDays    int           `yaml:"gaps_lookback_days" toml:"gaps_lookback_days"`
+	ScheduleTimezone    string        `yaml:"schedule_timezone" toml:"schedule_timezone"`
+}
+
+// ScheduleLocation return the time zone of the cron schedules.
+func (c WorkersConfig) ScheduleLocation() (*time.Location, error) {
+	return time.LoadLocation(c.ScheduleTimezone)
+}
+
+// RetentionConfig configure the partitions and the retention policy, Months equal to 0 disables the retention.
+type RetentionConfig struct {
+	Months      int    `yaml:"months" toml:"months"`
+	Mode        string `yaml:"mode" toml:"mode"`
+	MonthsAhead int    `yaml:"months_ahead" toml:"months_ahead"`
+}
+
+// LeaderConfig configure the election of the instance running each worker, Holder identify the instance.
+type LeaderConfig struct {
+	Enabled bool          `yaml:"enabled" toml:"enabled"`
+	TTL     time.Duration `yaml:"ttl" toml:"ttl"`
+	Holder  string        `yaml:"holder" toml:"holder"`
+}
+
+// LogConfig configure the logs, Format is json or text and Level one of debug, info, warn and error.
+type LogConfig struct {
+	Format string `yaml:"format" toml:"format"`
+	Level  string `yaml:"level" toml:"level"`
+}
+
+// TracingConfig configure the export of the traces, Exporter is none, stdout or otlp and Endpoint the URL of the OTLP/HTTP collector.
+// SampleRatio is the ratio of the traces started by kiln which are exported.
+type TracingConfig struct {
+	Exporter    string  `yaml:"exporter" toml:"exporter"`
+	Endpoint    string  `yaml:"endpoint" toml:"endpoint"`
+	SampleRatio float64 `yaml:"sample_ratio" toml:"sample_ratio"`
+}
+
+// Default return the configuration used when no source overrides a value.
+func Default() Config {
+	return Config{
+		DB: DBConfig{
+			MaxReplicationLag: 5 * time.Second,
+			BatchSize:         1000,
+		},
+		Tezos: TezosConfig{
+			BaseURL:   "https://api.tzkt.io/",
+			Network:   "mainnet",
+			Timeout:   45 * time.Second,
+			RateLimit: 10,
+		},
+		HTTP: HTTPConfig{
+			Port:            8080,
+			IngestPort:      8081,
+			ShutdownTimeout: 30 * time.Second,
+			ReadyMaxLag:     15 * time.Minute,
+			CountLimit:      10000,
+
+			CacheMaxAgeClosed: 24 * time.Hour,
+			CacheMaxAgeLive:   10 * time.Second,
+		},
+		Workers: WorkersConfig{
+			DelegationsInterval: 10 * time.Second,
+			DelegationsTimeout:  2 * time.Minute,
+			PartitionsSchedule:  "0 3 * * *",
+			PartitionsTimeout:   time.Hour,
+			GapsSchedule:        "@every 1h",
+			GapsTimeout:         30 * time.Minute,
+			GapsLookbackDays:    7,
+			ScheduleTimezone:    "UTC",
+		},
+		Retention: RetentionConfig{
+			Mode:        "drop",
+			MonthsAhead: 3,
+		},
+		Leader: LeaderConfig{
+			Enabled: true,
+			TTL:     30 * time.Second,
+		},
+		Log: LogConfig{
+			Format: utillog.FormatText,
+			Level:  "info",
+		},
+		Tracing: TracingConfig{
+			Exporter:    utiltrace.ExporterNone,
+			SampleRatio: 1,
+		},
 	}
 }
 
-// dir returns the absolute path of the given environment file (envFile) in the Go module's
-// root directory. It searches for the 'go.mod' file from the current working directory upwards
-// and appends the envFile to the directory containing 'go.mod'.
-// It panics if it fails to find the 'go.mod' file.
-func dir(envFile string) string {
+// Validate check every value of the configuration and return all the problems found, each naming its environment variable.
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, env string, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: "+format, append([]any{env}, args...)...))
+		}
+	}
+
+	check(c.DB.DSN != "", "MYSQL_DSN", "is required")
+	check(c.DB.MaxReplicationLag > 0, "MYSQL_REPLICA_MAX_LAG", "must be positive, got %s", c.DB.MaxReplicationLag)
+	check(c.DB.BatchSize > 0, "MYSQL_BATCH_SIZE", "must be positive, got %d", c.DB.BatchSize)
+
+	check(c.Tezos.BaseURL != "", "TZKT_URL", "is required")
+	check(c.Tezos.Network != "", "TZKT_NETWORK", "is required")
+	check(c.Tezos.Timeout > 0, "TZKT_TIMEOUT", "must be positive, got %s", c.Tezos.Timeout)
+	check(c.Tezos.RateLimit >= 0, "TZKT_RATE_LIMIT", "must not be negative, got %g", c.Tezos.RateLimit)
+
+	check(c.HTTP.Port > 0 && c.HTTP.Port < 65536, "PORT", "must be a port number, got %d", c.HTTP.Port)
+	check(c.HTTP.IngestPort > 0 && c.HTTP.IngestPort < 65536, "INGEST_PORT", "must be a port number, got %d", c.HTTP.IngestPort)
+	check(c.HTTP.ShutdownTimeout > 0, "SHUTDOWN_TIMEOUT", "must be positive, got %s", c.HTTP.ShutdownTimeout)
+	check(c.HTTP.ReadyMaxLag >= 0, "READY_MAX_LAG", "must not be negative, got %s", c.HTTP.ReadyMaxLag)
+	check(c.HTTP.CountLimit > 0, "COUNT_LIMIT", "must be positive, got %d", c.HTTP.CountLimit)
+	check(c.HTTP.CacheMaxAgeClosed >= 0, "CACHE_MAX_AGE_CLOSED", "must not be negative, got %s", c.HTTP.CacheMaxAgeClosed)
+	check(c.HTTP.CacheMaxAgeLive >= 0, "CACHE_MAX_AGE_LIVE", "must not be negative, got %s", c.HTTP.CacheMaxAgeLive)
+	check(c.HTTP.ResponseCacheSize >= 0, "RESPONSE_CACHE_SIZE", "must not be negative, got %d", c.HTTP.ResponseCacheSize)
+
+	check(c.Workers.DelegationsInterval > 0, "DELEGATIONS_INTERVAL", "must be positive, got %s", c.Workers.DelegationsInterval)
+	check(c.Workers.DelegationsTimeout >= 0, "DELEGATIONS_TIMEOUT", "must not be negative, got %s", c.Workers.DelegationsTimeout)
+	location, err := c.Workers.ScheduleLocation()
+	check(err == nil, "SCHEDULE_TIMEZONE", "%v", err)
+	_, err = utilworker.ParseSchedule(c.Workers.PartitionsSchedule, location)
+	check(err == nil, "PARTITIONS_SCHEDULE", "%v", err)
+	check(c.Workers.PartitionsTimeout >= 0, "PARTITIONS_TIMEOUT", "must not be negative, got %s", c.Workers.PartitionsTimeout)
+	_, err = utilworker.ParseSchedule(c.Workers.GapsSchedule, location)
+	check(err == nil, "GAPS_SCHEDULE", "%v", err)
+	check(c.Workers.GapsTimeout >= 0, "GAPS_TIMEOUT", "must not be negative, got %s", c.Workers.GapsTimeout)
+	check(c.Workers.GapsLookbackDays > 0, "GAPS_LOOKBACK_DAYS", "must be positive, got %d", c.Workers.GapsLookbackDays)
+
+	check(c.Retention.Months >= 0, "RETENTION_MONTHS", "must not be negative, got %d", c.Retention.Months)
+	check(c.Retention.Mode == "drop" || c.Retention.Mode == "archive", "RETENTION_MODE", "must be drop or archive, got %q", c.Retention.Mode)
+	check(c.Retention.MonthsAhead >= 0, "PARTITIONS_MONTHS_AHEAD", "must not be negative, got %d", c.Retention.MonthsAhead)
+
+	check(c.Leader.TTL > 0, "LEASE_TTL", "must be positive, got %s", c.Leader.TTL)
+
+	check(c.Log.Format == utillog.FormatJSON || c.Log.Format == utillog.FormatText, "LOG_FORMAT", "must be json or text, got %q", c.Log.Format)
+	_, err = utillog.ParseLevel(c.Log.Level)
+	check(err == nil, "LOG_LEVEL", "%v", err)
+
+	check(slices.Contains([]string{utiltrace.ExporterNone, utiltrace.ExporterStdout, utiltrace.ExporterOTLP}, c.Tracing.Exporter),
+		"TRACING_EXPORTER", "must be none, stdout or otlp, got %q", c.Tracing.Exporter)
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "TRACING_SAMPLE_RATIO", "must be between 0 and 1, got %g", c.Tracing.SampleRatio)
+
+	return errors.Join(errs...)
+}
+
+// LoadConfig loads the environment variables of the `.env` file found in the working directory or at the root of the Go module.
+// Variables already set are not overridden and a missing file is not an error, deployed binaries are configured by their environment.
+func LoadConfig() error {
+	path := findEnvFile(".env")
+	if path == "" {
+		return nil
+	}
+
+	if err := godotenv.Load(path); err != nil {
+		return fmt.Errorf("error loading %s: %w", path, err)
+	}
+	return nil
+}
+
+// findEnvFile returns the path of envFile in the working directory, or in the Go module's root directory found by searching
+// the 'go.mod' file from the working directory upwards. It returns an empty string when neither exists.
+func findEnvFile(envFile string) string {
 	currentDir, err := os.Getwd()
 	if err != nil {
-		panic(err)
+		return ""
 	}
 
-	for {
-		goModPath := filepath.Join(currentDir, "go.mod")
-		if _, err := os.Stat(goModPath); err == nil {
-			break
+	if path := filepath.Join(currentDir, envFile); exists(path) {
+		return path
+	}
+
+	for dir := currentDir; ; {
+		if exists(filepath.Join(dir, "go.mod")) {
+			if path := filepath.Join(dir, envFile); exists(path) {
+				return path
+			}
+			return ""
 		}
 
-		parent := filepath.Dir(currentDir)
-		if parent == currentDir {
-			panic(fmt.Errorf("go.mod not found"))
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
 		}
-		currentDir = parent
+		dir = parent
 	}
+}
 
-	return filepath.Join(currentDir, envFile)
+// exists report whether a regular file exists at path.
+func exists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
 }
@@ -0,0 +1,112 @@
+package utilconfig
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// chdir change the working directory for the duration of the test, so no `.env` file is found.
+func chdir(t *testing.T, dir string) {
+	previous, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	t.Cleanup(func() { os.Chdir(previous) })
+}
+
+func TestLoader_Layers(t *testing.T) {
+	dir := t.TempDir()
+	chdir(t, dir)
+
+	file := filepath.Join(dir, "kiln.yaml")
+	require.NoError(t, os.WriteFile(file, []byte(`
+db:
+  dsn: user:secret@tcp(file:3306)/db
+  batch_size: 500
+tezos:
+  timeout: 10s
+http:
+  port: 9000
+`), 0o600))
+
+	t.Setenv("MYSQL_BATCH_SIZE", "200")
+	t.Setenv("TZKT_RATE_LIMIT", "2.5")
+	t.Setenv("MYSQL_REPLICA_DSNS", "a:b@tcp(r1:3306)/db, a:b@tcp(r2:3306)/db")
+
+	var loader Loader
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	loader.RegisterFlags(fs)
+	require.NoError(t, fs.Parse([]string{"-config", file, "-port", "9100", "-leader-election=false"}))
+
+	c, err := loader.Load()
+	require.NoError(t, err)
+
+	require.Equal(t, "user:secret@tcp(file:3306)/db", c.DB.DSN)
+	require.Equal(t, 200, c.DB.BatchSize)
+	require.Equal(t, 10*time.Second, c.Tezos.Timeout)
+	require.Equal(t, 2.5, c.Tezos.RateLimit)
+	require.Equal(t, 9100, c.HTTP.Port)
+	require.False(t, c.Leader.Enabled)
+	require.Equal(t, []string{"a:b@tcp(r1:3306)/db", "a:b@tcp(r2:3306)/db"}, c.DB.ReplicaDSNs)
+	require.Equal(t, Default().Workers, c.Workers)
+}
+
+func TestLoader_TOML(t *testing.T) {
+	dir := t.TempDir()
+	chdir(t, dir)
+
+	file := filepath.Join(dir, "kiln.toml")
+	require.NoError(t, os.WriteFile(file, []byte(`
+[db]
+dsn = "user:secret@tcp(file:3306)/db"
+
+[workers]
+gaps_schedule = "@every 2h"
+gaps_timeout = "5m"
+schedule_timezone = "Europe/Paris"
+`), 0o600))
+	t.Setenv("KILN_CONFIG", file)
+
+	c, err := (&Loader{}).Load()
+	require.NoError(t, err)
+	require.Equal(t, "@every 2h", c.Workers.GapsSchedule)
+	require.Equal(t, 5*time.Minute, c.Workers.GapsTimeout)
+	location, err := c.Workers.ScheduleLocation()
+	require.NoError(t, err)
+	require.Equal(t, "Europe/Paris", location.String())
+}
+
+func TestLoader_Validate(t *testing.T) {
+	chdir(t, t.TempDir())
+	t.Setenv("RETENTION_MODE", "keep")
+	t.Setenv("PORT", "0")
+	t.Setenv("SCHEDULE_TIMEZONE", "Mars/Olympus")
+
+	_, err := (&Loader{}).Load()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "MYSQL_DSN: is required")
+	require.Contains(t, err.Error(), `RETENTION_MODE: must be drop or archive, got "keep"`)
+	require.Contains(t, err.Error(), "PORT: must be a port number, got 0")
+	require.Contains(t, err.Error(), "SCHEDULE_TIMEZONE: unknown time zone Mars/Olympus")
+
+	t.Setenv("MYSQL_BATCH_SIZE", "many")
+	_, err = (&Loader{}).Load()
+	require.ErrorContains(t, err, "MYSQL_BATCH_SIZE")
+}
+
+func TestConfig_Print(t *testing.T) {
+	c := Default()
+	c.DB.DSN = "user:secret@tcp(127.0.0.1:3310)/db?parseTime=true"
+	c.DB.ReplicaDSNs = []string{"user:secret@tcp(replica:3306)/db"}
+
+	var b strings.Builder
+	require.NoError(t, c.Print(&b))
+	require.NotContains(t, b.String(), "secret")
+	require.Contains(t, b.String(), "user:REDACTED@tcp(127.0.0.1:3310)/db")
+	require.Equal(t, "user:secret@tcp(127.0.0.1:3310)/db?parseTime=true", c.DB.DSN)
+}
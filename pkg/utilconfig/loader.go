@@ -0,0 +1,193 @@
+package utilconfig
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// option bind a configuration value to its environment variable and its command line flag.
+type option struct {
+	env   string
+	flag  string
+	usage string
+	value func(c *Config) any
+}
+
+// options is the list of the values which can be set by environment variables and flags.
+var options = []option{
+	{env: "MYSQL_DSN", flag: "db-dsn", usage: "DSN of the primary MySQL database", value: func(c *Config) any { return &c.DB.DSN }},
+	{env: "MYSQL_REPLICA_DSNS", flag: "db-replica-dsns", usage: "comma separated DSNs of the read replicas", value: func(c *Config) any { return &c.DB.ReplicaDSNs }},
+	{env: "MYSQL_REPLICA_MAX_LAG", flag: "db-max-replication-lag", usage: "replication lag above which a replica is not read", value: func(c *Config) any { return &c.DB.MaxReplicationLag }},
+	{env: "MYSQL_BATCH_SIZE", flag: "db-batch-size", usage: "number of delegations inserted per transaction", value: func(c *Config) any { return &c.DB.BatchSize }},
+	{env: "MYSQL_LOAD_DATA", flag: "db-load-data", usage: "insert delegations with LOAD DATA LOCAL INFILE", value: func(c *Config) any { return &c.DB.LoadData }},
+	{env: "TZKT_URL", flag: "tzkt-url", usage: "base URL of the tzkt API", value: func(c *Config) any { return &c.Tezos.BaseURL }},
+	{env: "TZKT_NETWORK", flag: "tzkt-network", usage: "tezos network served by the tzkt API", value: func(c *Config) any { return &c.Tezos.Network }},
+	{env: "TZKT_TIMEOUT", flag: "tzkt-timeout", usage: "timeout of a request to tzkt", value: func(c *Config) any { return &c.Tezos.Timeout }},
+	{env: "TZKT_RATE_LIMIT", flag: "tzkt-rate-limit", usage: "requests per second sent to tzkt, 0 disables the limit", value: func(c *Config) any { return &c.Tezos.RateLimit }},
+	{env: "PORT", flag: "port", usage: "port of the API", value: func(c *Config) any { return &c.HTTP.Port }},
+	{env: "INGEST_PORT", flag: "ingest-port", usage: "port of the administration endpoints of ingest", value: func(c *Config) any { return &c.HTTP.IngestPort }},
+	{env: "SHUTDOWN_TIMEOUT", flag: "shutdown-timeout", usage: "time given to requests and worker runs in flight on shutdown", value: func(c *Config) any { return &c.HTTP.ShutdownTimeout }},
+	{env: "READY_MAX_LAG", flag: "ready-max-lag", usage: "ingestion lag above which /readyz fails, 0 disables the check", value: func(c *Config) any { return &c.HTTP.ReadyMaxLag }},
+	{env: "COUNT_LIMIT", flag: "count-limit", usage: "number of delegations counted exactly for the total of a list, above it the total is estimated", value: func(c *Config) any { return &c.HTTP.CountLimit }},
+	{env: "CACHE_MAX_AGE_CLOSED", flag: "cache-max-age-closed", usage: "Cache-Control max-age of the delegations of a past year", value: func(c *Config) any { return &c.HTTP.CacheMaxAgeClosed }},
+	{env: "CACHE_MAX_AGE_LIVE", flag: "cache-max-age-live", usage: "Cache-Control max-age of the most recent delegations and of the current year", value: func(c *Config) any { return &c.HTTP.CacheMaxAgeLive }},
+	{env: "RESPONSE_CACHE_SIZE", flag: "response-cache-size", usage: "number of delegation lists kept in memory, 0 disables the cache", value: func(c *Config) any { return &c.HTTP.ResponseCacheSize }},
+	{env: "DELEGATIONS_INTERVAL", flag: "delegations-interval", usage: "interval between two polls of new delegations", value: func(c *Config) any { return &c.Workers.DelegationsInterval }},
+	{env: "DELEGATIONS_TIMEOUT", flag: "delegations-timeout", usage: "deadline of a poll of new delegations", value: func(c *Config) any { return &c.Workers.DelegationsTimeout }},
+	{env: "PARTITIONS_SCHEDULE", flag: "partitions-schedule", usage: "schedule of the partitions worker", value: func(c *Config) any { return &c.Workers.PartitionsSchedule }},
+	{env: "PARTITIONS_TIMEOUT", flag: "partitions-timeout", usage: "deadline of a run of the partitions worker", value: func(c *Config) any { return &c.Workers.PartitionsTimeout }},
+	{env: "GAPS_SCHEDULE", flag: "gaps-schedule", usage: "schedule of the gaps worker", value: func(c *Config) any { return &c.Workers.GapsSchedule }},
+	{env: "GAPS_TIMEOUT", flag: "gaps-timeout", usage: "deadline of a run of the gaps worker", value: func(c *Config) any { return &c.Workers.GapsTimeout }},
+	{env: "SCHEDULE_TIMEZONE", flag: "schedule-timezone", usage: "time zone of the cron schedules of the workers", value: func(c *Config) any { return &c.Workers.ScheduleTimezone }},
+	{env: "GAPS_LOOKBACK_DAYS", flag: "gaps-lookback-days", usage: "number of elapsed days audited by the gaps worker", value: func(c *Config) any { return &c.Workers.GapsLookbackDays }},
+	{env: "RETENTION_MONTHS", flag: "retention-months", usage: "number of months kept including the current one, 0 disables the retention", value: func(c *Config) any { return &c.Retention.Months }},
+	{env: "RETENTION_MODE", flag: "retention-mode", usage: "drop or archive the expired partitions", value: func(c *Config) any { return &c.Retention.Mode }},
+	{env: "PARTITIONS_MONTHS_AHEAD", flag: "partitions-months-ahead", usage: "number of monthly partitions created ahead", value: func(c *Config) any { return &c.Retention.MonthsAhead }},
+	{env: "LEADER_ELECTION", flag: "leader-election", usage: "run each worker on a single instance", value: func(c *Config) any { return &c.Leader.Enabled }},
+	{env: "LEASE_TTL", flag: "lease-ttl", usage: "duration a worker lease is held without being renewed", value: func(c *Config) any { return &c.Leader.TTL }},
+	{env: "LEASE_HOLDER", flag: "lease-holder", usage: "identifier of this instance, hostname-pid when empty", value: func(c *Config) any { return &c.Leader.Holder }},
+	{env: "LOG_FORMAT", flag: "log-format", usage: "format of the logs, json or text", value: func(c *Config) any { return &c.Log.Format }},
+	{env: "LOG_LEVEL", flag: "log-level", usage: "minimum level of the logs, debug, info, warn or error", value: func(c *Config) any { return &c.Log.Level }},
+	{env: "TRACING_EXPORTER", flag: "tracing-exporter", usage: "exporter of the traces, none, stdout or otlp", value: func(c *Config) any { return &c.Tracing.Exporter }},
+	{env: "TRACING_ENDPOINT", flag: "tracing-endpoint", usage: "URL of the OTLP/HTTP collector, OTEL_EXPORTER_OTLP_ENDPOINT when empty", value: func(c *Config) any { return &c.Tracing.Endpoint }},
+	{env: "TRACING_SAMPLE_RATIO", flag: "tracing-sample-ratio", usage: "ratio of the traces exported, between 0 and 1", value: func(c *Config) any { return &c.Tracing.SampleRatio }},
+}
+
+// Loader build a Config by layering, from the lowest to the highest priority: Default, the configuration file,
+// the environment variables, including the ones of the `.env` file, and the command line flags.
+type Loader struct {
+	file  string
+	flags []func(c *Config) error
+}
+
+// RegisterFlags add to fs a `-config` flag naming the configuration file and a flag for every value of the configuration.
+// Flags are applied by Load, only the flags given on the command line override the other sources.
+func (l *Loader) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&l.file, "config", "", "YAML or TOML configuration file, KILN_CONFIG when empty")
+	for _, o := range options {
+		apply := func(s string) error {
+			l.flags = append(l.flags, func(c *Config) error {
+				if err := set(o.value(c), s); err != nil {
+					return fmt.Errorf("-%s: %w", o.flag, err)
+				}
+				return nil
+			})
+			return nil
+		}
+
+		usage := o.usage + " (" + o.env + ")"
+		if _, ok := o.value(&Config{}).(*bool); ok {
+			fs.BoolFunc(o.flag, usage, apply)
+			continue
+		}
+		fs.Func(o.flag, usage, apply)
+	}
+}
+
+// Load build and validate the configuration.
+func (l *Loader) Load() (Config, error) {
+	if err := LoadConfig(); err != nil {
+		return Config{}, err
+	}
+
+	c := Default()
+
+	file := l.file
+	if file == "" {
+		file = os.Getenv("KILN_CONFIG")
+	}
+	if file != "" {
+		if err := loadFile(file, &c); err != nil {
+			return Config{}, err
+		}
+	}
+
+	for _, o := range options {
+		v, ok := os.LookupEnv(o.env)
+		if !ok || v == "" {
+			continue
+		}
+		if err := set(o.value(&c), v); err != nil {
+			return Config{}, fmt.Errorf("%s: %w", o.env, err)
+		}
+	}
+
+	for _, apply := range l.flags {
+		if err := apply(&c); err != nil {
+			return Config{}, err
+		}
+	}
+
+	if err := c.Validate(); err != nil {
+		return Config{}, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return c, nil
+}
+
+// loadFile decode a YAML or a TOML file, depending on its extension, into c. Values absent from the file are left untouched.
+func loadFile(path string, c *Config) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+	case ".toml":
+		// TOML is converted to YAML so both formats share the decoding of durations and the check of unknown fields.
+		var values map[string]any
+		if err := toml.Unmarshal(content, &values); err != nil {
+			return fmt.Errorf("config file %s: %w", path, err)
+		}
+		if content, err = yaml.Marshal(values); err != nil {
+			return fmt.Errorf("config file %s: %w", path, err)
+		}
+	default:
+		return fmt.Errorf("config file %s: unknown format, expected .yaml, .yml or .toml", path)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// set parse s into the value pointed by ptr.
+func set(ptr any, s string) error {
+	var err error
+	switch p := ptr.(type) {
+	case *string:
+		*p = s
+	case *int:
+		*p, err = strconv.Atoi(s)
+	case *float64:
+		*p, err = strconv.ParseFloat(s, 64)
+	case *bool:
+		*p, err = strconv.ParseBool(s)
+	case *time.Duration:
+		*p, err = time.ParseDuration(s)
+	case *[]string:
+		*p = nil
+		for _, v := range strings.Split(s, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				*p = append(*p, v)
+			}
+		}
+	default:
+		err = fmt.Errorf("unsupported type %T", ptr)
+	}
+	return err
+}
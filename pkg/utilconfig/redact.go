@@ -0,0 +1,50 @@
+package utilconfig
+
+import (
+	"io"
+
+	"github.com/go-sql-driver/mysql"
+	"gopkg.in/yaml.v3"
+)
+
+// redacted replace the secrets printed by Print.
+const redacted = "REDACTED"
+
+// Redacted return a copy of the configuration whose secrets, the database passwords, are replaced.
+func (c Config) Redacted() Config {
+	c.DB.DSN = redactDSN(c.DB.DSN)
+
+	replicas := make([]string, 0, len(c.DB.ReplicaDSNs))
+	for _, dsn := range c.DB.ReplicaDSNs {
+		replicas = append(replicas, redactDSN(dsn))
+	}
+	c.DB.ReplicaDSNs = replicas
+
+	return c
+}
+
+// redactDSN replace the password of a MySQL DSN, a DSN which cannot be parsed is entirely replaced.
+func redactDSN(dsn string) string {
+	if dsn == "" {
+		return ""
+	}
+
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return redacted
+	}
+	if cfg.Passwd != "" {
+		cfg.Passwd = redacted
+	}
+	return cfg.FormatDSN()
+}
+
+// Print write the redacted configuration as YAML.
+func (c Config) Print(w io.Writer) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(c.Redacted()); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
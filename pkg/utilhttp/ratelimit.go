@@ -0,0 +1,27 @@
+package utilhttp
+
+import (
+	"net/http"
+
+	"golang.org/x/time/rate"
+)
+
+// rateLimitedClient is a Client waiting for the limiter before each request.
+type rateLimitedClient struct {
+	client  Client
+	limiter *rate.Limiter
+}
+
+// NewRateLimitedClient returns a Client sending requests through client no faster than limiter allows.
+// Clients sharing a limiter share its rate, a request waits for the limiter until its context is done.
+func NewRateLimitedClient(client Client, limiter *rate.Limiter) Client {
+	return &rateLimitedClient{client: client, limiter: limiter}
+}
+
+// Do wait for the limiter then performs the request.
+func (c *rateLimitedClient) Do(req *http.Request) (*http.Response, error) {
+	if err := c.limiter.Wait(req.Context()); err != nil {
+		return nil, err
+	}
+	return c.client.Do(req)
+}
@@ -0,0 +1,77 @@
+package utillog
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestIDHeader is the header carrying the request id, it is read from the request and written to the response.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bound the length of a request id given by a client, longer ids are replaced.
+const maxRequestIDLength = 128
+
+// Middleware return a gin middleware giving every request an id, propagated in the request context to the repositories and
+// the tzkt client, and logging every request once it is served with logger. It replaces the default logger of gin.
+func Middleware(logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID(id) {
+			id = NewID()
+		}
+		c.Header(RequestIDHeader, id)
+
+		ctx := WithRequestID(c.Request.Context(), id)
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		}
+
+		attrs := []any{
+			"method", c.Request.Method,
+			"route", c.FullPath(),
+			"path", c.Request.URL.Path,
+			"status", status,
+			"duration", time.Since(start),
+			"client_ip", c.ClientIP(),
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, "error", c.Errors.String())
+		}
+		logger.Log(ctx, level, "request served", attrs...)
+	}
+}
+
+// validRequestID report whether id can be used as a request id, it must be non-empty, short and made of printable ASCII.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// NewID return a random id of 32 hexadecimal characters, used for the request ids and the run ids.
+func NewID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
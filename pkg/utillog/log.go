@@ -0,0 +1,123 @@
+package utillog
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Keys of the contextual fields carried by the logs.
+const (
+	KeyWorker       = "worker"
+	KeyRunID        = "run_id"
+	KeyRequestID    = "request_id"
+	KeyTzktURL      = "tzkt_url"
+	KeyRowsInserted = "rows_inserted"
+	KeyTraceID      = "trace_id"
+	KeySpanID       = "span_id"
+)
+
+// Formats accepted by New.
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// New return a logger writing to w in format, json or text, the records below level are dropped.
+// The fields added to a context with With are written with every record logged with this context.
+func New(w io.Writer, format string, level string) (*slog.Logger, error) {
+	l, err := ParseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+
+	options := &slog.HandlerOptions{Level: l}
+
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case FormatJSON:
+		handler = slog.NewJSONHandler(w, options)
+	case FormatText, "":
+		handler = slog.NewTextHandler(w, options)
+	default:
+		return nil, fmt.Errorf("unknown log format %q, expected json or text", format)
+	}
+
+	return slog.New(contextHandler{handler}), nil
+}
+
+// ParseLevel parse a level among debug, info, warn and error.
+func ParseLevel(s string) (slog.Level, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(s)); err != nil {
+		return l, fmt.Errorf("unknown log level %q, expected debug, info, warn or error", s)
+	}
+	return l, nil
+}
+
+// fieldsKey is the context key of the fields added with With.
+type fieldsKey struct{}
+
+// With return a copy of ctx carrying args, given as in slog.Logger.With, in addition to the fields already carried by ctx.
+func With(ctx context.Context, args ...any) context.Context {
+	attrs := append(fields(ctx), argsToAttrs(args)...)
+	return context.WithValue(ctx, fieldsKey{}, attrs)
+}
+
+// fields return a copy of the fields carried by ctx.
+func fields(ctx context.Context) []slog.Attr {
+	attrs, _ := ctx.Value(fieldsKey{}).([]slog.Attr)
+	return append([]slog.Attr{}, attrs...)
+}
+
+// argsToAttrs convert key value pairs and slog.Attr to a list of slog.Attr.
+func argsToAttrs(args []any) []slog.Attr {
+	r := slog.Record{}
+	r.Add(args...)
+	attrs := make([]slog.Attr, 0, r.NumAttrs())
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+	return attrs
+}
+
+// requestIDKey is the context key of the request id.
+type requestIDKey struct{}
+
+// WithRequestID return a copy of ctx carrying the request id, which is also added to the fields of the logs.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	ctx = context.WithValue(ctx, requestIDKey{}, id)
+	return With(ctx, KeyRequestID, id)
+}
+
+// RequestID return the request id carried by ctx, or an empty string.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// contextHandler add the fields carried by the context of a record before handing it to the wrapped handler.
+type contextHandler struct {
+	slog.Handler
+}
+
+// Handle add the fields of ctx to r.
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if attrs, ok := ctx.Value(fieldsKey{}).([]slog.Attr); ok {
+		r.AddAttrs(attrs...)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+// WithAttrs return a contextHandler wrapping the handler with attrs.
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+// WithGroup return a contextHandler wrapping the handler with the group.
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,77 @@
+package utillog_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kiln-mid/pkg/utillog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew_ContextFields(t *testing.T) {
+	var buffer bytes.Buffer
+	logger, err := utillog.New(&buffer, utillog.FormatJSON, "info")
+	require.NoError(t, err)
+
+	ctx := utillog.With(context.Background(), utillog.KeyWorker, "worker-delegations")
+	ctx = utillog.With(ctx, utillog.KeyRunID, "42")
+
+	logger.DebugContext(ctx, "dropped")
+	logger.InfoContext(ctx, "kept", utillog.KeyRowsInserted, 3)
+
+	var record map[string]any
+	require.NoError(t, json.Unmarshal(buffer.Bytes(), &record))
+	require.Equal(t, "kept", record["msg"])
+	require.Equal(t, "worker-delegations", record[utillog.KeyWorker])
+	require.Equal(t, "42", record[utillog.KeyRunID])
+	require.Equal(t, float64(3), record[utillog.KeyRowsInserted])
+
+	_, err = utillog.New(&buffer, "xml", "info")
+	require.Error(t, err)
+	_, err = utillog.New(&buffer, utillog.FormatText, "verbose")
+	require.Error(t, err)
+}
+
+func TestMiddleware_RequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var buffer bytes.Buffer
+	logger, err := utillog.New(&buffer, utillog.FormatJSON, "info")
+	require.NoError(t, err)
+
+	var seen string
+	router := gin.New()
+	router.Use(utillog.Middleware(logger))
+	router.GET("/ping", func(c *gin.Context) {
+		seen = utillog.RequestID(c.Request.Context())
+		slog.New(logger.Handler()).InfoContext(c.Request.Context(), "handled")
+		c.Status(http.StatusNoContent)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+	req.Header.Set(utillog.RequestIDHeader, "abc-123")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, "abc-123", seen)
+	require.Equal(t, "abc-123", w.Header().Get(utillog.RequestIDHeader))
+
+	lines := bytes.Split(bytes.TrimSpace(buffer.Bytes()), []byte("\n"))
+	require.Len(t, lines, 2)
+	for _, line := range lines {
+		var record map[string]any
+		require.NoError(t, json.Unmarshal(line, &record))
+		require.Equal(t, "abc-123", record[utillog.KeyRequestID])
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ping", nil))
+	require.Len(t, w.Header().Get(utillog.RequestIDHeader), 32)
+	require.Equal(t, w.Header().Get(utillog.RequestIDHeader), seen)
+}
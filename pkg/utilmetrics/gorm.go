@@ -0,0 +1,71 @@
+package utilmetrics
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// gormStartKey is the key of the start time of a query in the GORM statement settings.
+const gormStartKey = "utilmetrics:start"
+
+// gormPlugin is a GORM plugin recording the duration and the errors of every query.
+type gormPlugin struct {
+	metrics *Metrics
+}
+
+// GormPlugin return a GORM plugin recording the queries of the connections it is used by, see db.Client.Use.
+func (m *Metrics) GormPlugin() gorm.Plugin {
+	return gormPlugin{metrics: m}
+}
+
+// Name return the name of the plugin.
+func (p gormPlugin) Name() string {
+	return "utilmetrics"
+}
+
+// Initialize register a callback before and after every kind of query.
+func (p gormPlugin) Initialize(db *gorm.DB) error {
+	callback := db.Callback()
+	return errors.Join(
+		callback.Create().Before("gorm:create").Register("utilmetrics:before_create", p.before),
+		callback.Create().After("gorm:create").Register("utilmetrics:after_create", p.after("create")),
+		callback.Query().Before("gorm:query").Register("utilmetrics:before_query", p.before),
+		callback.Query().After("gorm:query").Register("utilmetrics:after_query", p.after("query")),
+		callback.Update().Before("gorm:update").Register("utilmetrics:before_update", p.before),
+		callback.Update().After("gorm:update").Register("utilmetrics:after_update", p.after("update")),
+		callback.Delete().Before("gorm:delete").Register("utilmetrics:before_delete", p.before),
+		callback.Delete().After("gorm:delete").Register("utilmetrics:after_delete", p.after("delete")),
+		callback.Row().Before("gorm:row").Register("utilmetrics:before_row", p.before),
+		callback.Row().After("gorm:row").Register("utilmetrics:after_row", p.after("row")),
+		callback.Raw().Before("gorm:raw").Register("utilmetrics:before_raw", p.before),
+		callback.Raw().After("gorm:raw").Register("utilmetrics:after_raw", p.after("raw")),
+	)
+}
+
+// before record the start time of the query.
+func (p gormPlugin) before(db *gorm.DB) {
+	db.InstanceSet(gormStartKey, time.Now())
+}
+
+// after record the duration of the query, and its failure.
+func (p gormPlugin) after(operation string) func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		value, ok := db.InstanceGet(gormStartKey)
+		if !ok {
+			return
+		}
+		start, _ := value.(time.Time)
+
+		table := db.Statement.Table
+		if table == "" {
+			table = "unknown"
+		}
+
+		p.metrics.dbDuration.WithLabelValues(operation, table).Observe(time.Since(start).Seconds())
+		if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+			p.metrics.dbErrors.WithLabelValues(operation, table).Inc()
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package utilmetrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/kiln-mid/pkg/utilhttp"
+)
+
+// instrumentedClient is a utilhttp.Client recording the duration, the status code and the errors of the requests to tzkt.
+type instrumentedClient struct {
+	client  utilhttp.Client
+	metrics *Metrics
+}
+
+// InstrumentClient return a client recording the requests sent through client.
+// Requests are labeled by URL path, which must not contain identifiers so the number of series stays bounded.
+func (m *Metrics) InstrumentClient(client utilhttp.Client) utilhttp.Client {
+	return &instrumentedClient{client: client, metrics: m}
+}
+
+// Do performs the request and record its outcome.
+func (c *instrumentedClient) Do(req *http.Request) (*http.Response, error) {
+	endpoint := req.URL.Path
+	start := time.Now()
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		c.metrics.tzktErrors.WithLabelValues(endpoint, "transport").Inc()
+		return resp, err
+	}
+
+	c.metrics.tzktDuration.WithLabelValues(endpoint, strconv.Itoa(resp.StatusCode)).Observe(time.Since(start).Seconds())
+	if resp.StatusCode >= http.StatusBadRequest {
+		c.metrics.tzktErrors.WithLabelValues(endpoint, "status").Inc()
+	}
+	return resp, nil
+}
@@ -0,0 +1,169 @@
+package utilmetrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/kiln-mid/pkg/delegations"
+	"github.com/kiln-mid/pkg/utilworker"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace prefix the name of every metric.
+const namespace = "kiln"
+
+// rowsBuckets are the buckets of the number of delegations fetched or inserted by a poll.
+var rowsBuckets = []float64{0, 1, 10, 50, 100, 500, 1000, 5000}
+
+// Metrics hold the collectors of kiln and the registry exposing them.
+// It implements delegations.Observer and utilworker.Observer, HTTP, tzkt and database metrics are collected by
+// Middleware, InstrumentClient and GormPlugin.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	httpDuration *prometheus.HistogramVec
+
+	tzktDuration *prometheus.HistogramVec
+	tzktErrors   *prometheus.CounterVec
+
+	pollFetched  prometheus.Histogram
+	pollInserted prometheus.Histogram
+	lagSeconds   prometheus.Gauge
+	lagLevels    prometheus.Gauge
+
+	workerDuration *prometheus.HistogramVec
+	workerFailures *prometheus.CounterVec
+
+	dbDuration *prometheus.HistogramVec
+	dbErrors   *prometheus.CounterVec
+}
+
+// New return Metrics registered in a new registry, along with the Go runtime and process collectors.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "request_duration_seconds",
+			Help:      "Duration of the HTTP requests served, by route and status. The count is the number of requests.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		tzktDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "tzkt",
+			Name:      "request_duration_seconds",
+			Help:      "Duration of the requests to tzkt which got a response, by endpoint and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"endpoint", "code"}),
+		tzktErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "tzkt",
+			Name:      "request_errors_total",
+			Help:      "Requests to tzkt which failed, type is transport when no response was received and status for a 4xx or 5xx response.",
+		}, []string{"endpoint", "type"}),
+		pollFetched: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "ingestion",
+			Name:      "poll_fetched_rows",
+			Help:      "Delegations fetched from tzkt per poll of new delegations.",
+			Buckets:   rowsBuckets,
+		}),
+		pollInserted: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "ingestion",
+			Name:      "poll_inserted_rows",
+			Help:      "Delegations inserted per poll of new delegations.",
+			Buckets:   rowsBuckets,
+		}),
+		lagSeconds: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "ingestion",
+			Name:      "lag_seconds",
+			Help:      "Seconds between the tzkt head and the newest stored delegation.",
+		}),
+		lagLevels: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "ingestion",
+			Name:      "lag_levels",
+			Help:      "Levels between the tzkt head and the newest stored delegation.",
+		}),
+		workerDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "worker",
+			Name:      "run_duration_seconds",
+			Help:      "Duration of the worker runs, by worker and outcome.",
+			Buckets:   []float64{.01, .05, .1, .5, 1, 5, 10, 30, 60, 300, 900, 3600},
+		}, []string{"worker", "outcome"}),
+		workerFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "worker",
+			Name:      "run_failures_total",
+			Help:      "Failed worker runs, by worker and error class.",
+		}, []string{"worker", "class"}),
+		dbDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "db",
+			Name:      "query_duration_seconds",
+			Help:      "Duration of the database queries, by operation and table.",
+			Buckets:   []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+		}, []string{"operation", "table"}),
+		dbErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "db",
+			Name:      "query_errors_total",
+			Help:      "Failed database queries, by operation and table. A record not found is not a failure.",
+		}, []string{"operation", "table"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpDuration,
+		m.tzktDuration,
+		m.tzktErrors,
+		m.pollFetched,
+		m.pollInserted,
+		m.lagSeconds,
+		m.lagLevels,
+		m.workerDuration,
+		m.workerFailures,
+		m.dbDuration,
+		m.dbErrors,
+	)
+
+	return m
+}
+
+// Handler return the handler serving the metrics in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Polled record the number of delegations fetched by a poll.
+func (m *Metrics) Polled(fetched int) {
+	m.pollFetched.Observe(float64(fetched))
+}
+
+// Inserted record the number of delegations inserted by a poll.
+func (m *Metrics) Inserted(inserted int64) {
+	m.pollInserted.Observe(float64(inserted))
+}
+
+// LagMeasured record the ingestion lag.
+func (m *Metrics) LagMeasured(lag delegations.Lag) {
+	m.lagSeconds.Set(lag.Seconds)
+	m.lagLevels.Set(float64(lag.Levels))
+}
+
+// RunFinished record the duration of a worker run and its failure.
+func (m *Metrics) RunFinished(name string, duration time.Duration, err error) {
+	outcome := "success"
+	if err != nil {
+		outcome = "failure"
+		m.workerFailures.WithLabelValues(name, string(utilworker.Classify(err))).Inc()
+	}
+	m.workerDuration.WithLabelValues(name, outcome).Observe(duration.Seconds())
+}
@@ -0,0 +1,81 @@
+package utilmetrics
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kiln-mid/pkg/delegations"
+	"github.com/kiln-mid/pkg/utilworker"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeClient struct {
+	status int
+	err    error
+}
+
+func (f fakeClient) Do(req *http.Request) (*http.Response, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &http.Response{StatusCode: f.status, Body: io.NopCloser(strings.NewReader(""))}, nil
+}
+
+func TestMetrics_Middleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := New()
+
+	router := gin.New()
+	router.Use(m.Middleware())
+	router.GET("/xtz/delegations/:id", func(c *gin.Context) { c.Status(http.StatusNotFound) })
+	router.GET("/metrics", gin.WrapH(m.Handler()))
+
+	for _, path := range []string{"/xtz/delegations/1", "/xtz/delegations/2", "/unknown"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	require.Equal(t, 2, testutil.CollectAndCount(m.httpDuration))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Contains(t, w.Body.String(), `kiln_http_request_duration_seconds_count{method="GET",route="/xtz/delegations/:id",status="404"} 2`)
+	require.Contains(t, w.Body.String(), `kiln_http_request_duration_seconds_count{method="GET",route="unmatched",status="404"} 1`)
+}
+
+func TestMetrics_InstrumentClient(t *testing.T) {
+	m := New()
+
+	for _, client := range []fakeClient{{status: 200}, {status: 503}, {err: errors.New("connection refused")}} {
+		req := httptest.NewRequest(http.MethodGet, "https://api.tzkt.io/v1/head", nil)
+		_, _ = m.InstrumentClient(client).Do(req)
+	}
+
+	require.Equal(t, 2, testutil.CollectAndCount(m.tzktDuration))
+	require.Equal(t, float64(1), testutil.ToFloat64(m.tzktErrors.WithLabelValues("/v1/head", "status")))
+	require.Equal(t, float64(1), testutil.ToFloat64(m.tzktErrors.WithLabelValues("/v1/head", "transport")))
+}
+
+func TestMetrics_Observers(t *testing.T) {
+	m := New()
+
+	var _ delegations.Observer = m
+	var _ utilworker.Observer = m
+
+	m.Polled(10)
+	m.Inserted(7)
+	m.LagMeasured(delegations.Lag{Seconds: 42, Levels: 3})
+	m.RunFinished("worker-delegations", time.Second, nil)
+	m.RunFinished("worker-delegations", time.Second, utilworker.Permanent(errors.New("invalid")))
+
+	require.Equal(t, float64(42), testutil.ToFloat64(m.lagSeconds))
+	require.Equal(t, float64(3), testutil.ToFloat64(m.lagLevels))
+	require.Equal(t, float64(1), testutil.ToFloat64(m.workerFailures.WithLabelValues("worker-delegations", "permanent")))
+	require.Equal(t, 2, testutil.CollectAndCount(m.workerDuration))
+}
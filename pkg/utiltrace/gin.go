@@ -0,0 +1,53 @@
+package utiltrace
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kiln-mid/pkg/utillog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Middleware return a gin middleware starting a server span for every request, child of the trace context propagated in the
+// W3C `traceparent` header if any. The span is carried by the request context, so the spans of the repositories and of the
+// tzkt calls are its children, and the logs of the request carry its trace id.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+
+		route := c.FullPath()
+		name := c.Request.Method
+		if route != "" {
+			name += " " + route
+		}
+
+		ctx, span := Tracer().Start(ctx, name,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(c.Request.Method),
+				semconv.HTTPRoute(route),
+				semconv.URLPath(c.Request.URL.Path),
+			),
+		)
+		defer span.End()
+
+		if id := utillog.RequestID(ctx); id != "" {
+			span.SetAttributes(attribute.String(utillog.KeyRequestID, id))
+		}
+
+		c.Request = c.Request.WithContext(WithLogFields(ctx))
+
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package utiltrace
+
+import (
+	"errors"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+// gormSpanKey is the key of the span of a query in the GORM statement settings.
+const gormSpanKey = "utiltrace:span"
+
+// gormPlugin is a GORM plugin running every query in a client span, child of the span of the query context.
+type gormPlugin struct{}
+
+// GormPlugin return a GORM plugin tracing the queries of the connections it is used by, see db.Client.Use.
+func GormPlugin() gorm.Plugin {
+	return gormPlugin{}
+}
+
+// Name return the name of the plugin.
+func (p gormPlugin) Name() string {
+	return "utiltrace"
+}
+
+// Initialize register a callback before and after every kind of query.
+func (p gormPlugin) Initialize(db *gorm.DB) error {
+	callback := db.Callback()
+	return errors.Join(
+		callback.Create().Before("gorm:create").Register("utiltrace:before_create", p.before("create")),
+		callback.Create().After("gorm:create").Register("utiltrace:after_create", p.after),
+		callback.Query().Before("gorm:query").Register("utiltrace:before_query", p.before("query")),
+		callback.Query().After("gorm:query").Register("utiltrace:after_query", p.after),
+		callback.Update().Before("gorm:update").Register("utiltrace:before_update", p.before("update")),
+		callback.Update().After("gorm:update").Register("utiltrace:after_update", p.after),
+		callback.Delete().Before("gorm:delete").Register("utiltrace:before_delete", p.before("delete")),
+		callback.Delete().After("gorm:delete").Register("utiltrace:after_delete", p.after),
+		callback.Row().Before("gorm:row").Register("utiltrace:before_row", p.before("row")),
+		callback.Row().After("gorm:row").Register("utiltrace:after_row", p.after),
+		callback.Raw().Before("gorm:raw").Register("utiltrace:before_raw", p.before("raw")),
+		callback.Raw().After("gorm:raw").Register("utiltrace:after_raw", p.after),
+	)
+}
+
+// before start the span of the query and make it the parent of the spans started while the query runs.
+func (p gormPlugin) before(operation string) func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		name := operation
+		if db.Statement.Table != "" {
+			name += " " + db.Statement.Table
+		}
+
+		ctx, span := Tracer().Start(db.Statement.Context, name,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				semconv.DBSystemMySQL,
+				semconv.DBOperationName(operation),
+				semconv.DBCollectionName(db.Statement.Table),
+			),
+		)
+		db.Statement.Context = ctx
+		db.InstanceSet(gormSpanKey, span)
+	}
+}
+
+// after end the span of the query with the statement run, the rows affected and the error.
+func (p gormPlugin) after(db *gorm.DB) {
+	value, ok := db.InstanceGet(gormSpanKey)
+	if !ok {
+		return
+	}
+	span, ok := value.(trace.Span)
+	if !ok {
+		return
+	}
+	defer span.End()
+
+	span.SetAttributes(
+		semconv.DBQueryText(db.Statement.SQL.String()),
+		attribute.Int64("db.rows_affected", db.Statement.RowsAffected),
+	)
+	if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+		span.RecordError(db.Error)
+		span.SetStatus(codes.Error, db.Error.Error())
+	}
+}
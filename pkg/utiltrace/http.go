@@ -0,0 +1,52 @@
+package utiltrace
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/kiln-mid/pkg/utilhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracedClient is a utilhttp.Client starting a client span for every request and propagating it in the W3C headers.
+type tracedClient struct {
+	client utilhttp.Client
+}
+
+// InstrumentClient return a client tracing the requests sent through client, as children of the span of the request context.
+func InstrumentClient(client utilhttp.Client) utilhttp.Client {
+	return &tracedClient{client: client}
+}
+
+// Do performs the request in a client span, which ends once the response headers are received.
+func (c *tracedClient) Do(req *http.Request) (*http.Response, error) {
+	ctx, span := Tracer().Start(req.Context(), req.Method+" "+req.URL.Path,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(req.Method),
+			semconv.URLFull(req.URL.String()),
+			semconv.ServerAddress(req.URL.Hostname()),
+		),
+	)
+	defer span.End()
+
+	req = req.Clone(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return resp, err
+	}
+
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+	if resp.StatusCode >= http.StatusBadRequest {
+		span.SetStatus(codes.Error, fmt.Sprintf("status %d", resp.StatusCode))
+	}
+	return resp, nil
+}
@@ -0,0 +1,92 @@
+package utiltrace
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/kiln-mid/pkg/utillog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracerName is the name of the tracer of kiln.
+const TracerName = "github.com/kiln-mid"
+
+// Exporters accepted by Setup.
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+)
+
+// Options represent how spans are exported.
+// Exporter is one of none, stdout and otlp. Endpoint is the URL of the OTLP/HTTP collector, the OTEL_EXPORTER_OTLP_* variables are used when empty.
+// SampleRatio is the ratio of the traces started by kiln which are sampled, the decision of a propagated parent is always followed.
+type Options struct {
+	Exporter    string
+	Endpoint    string
+	SampleRatio float64
+	ServiceName string
+}
+
+// Tracer return the tracer of kiln, spans are dropped until Setup installs an exporter.
+func Tracer() trace.Tracer {
+	return otel.Tracer(TracerName)
+}
+
+// WithLogFields return a copy of ctx whose logs carry the trace and span ids of the span of ctx, if any.
+func WithLogFields(ctx context.Context) context.Context {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.IsValid() {
+		return ctx
+	}
+	return utillog.With(ctx, utillog.KeyTraceID, spanContext.TraceID().String(), utillog.KeySpanID, spanContext.SpanID().String())
+}
+
+// Setup install the global tracer provider exporting spans as configured by options, and the W3C trace context propagator.
+// The returned function flushes the spans in flight and must be called before the process exits.
+func Setup(ctx context.Context, options Options) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch strings.ToLower(options.Exporter) {
+	case ExporterNone, "":
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stderr))
+	case ExporterOTLP:
+		var exporterOptions []otlptracehttp.Option
+		if options.Endpoint != "" {
+			exporterOptions = append(exporterOptions, otlptracehttp.WithEndpointURL(options.Endpoint))
+		}
+		exporter, err = otlptracehttp.New(ctx, exporterOptions...)
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q, expected none, stdout or otlp", options.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s exporter: %w", options.Exporter, err)
+	}
+
+	serviceName := options.ServiceName
+	if serviceName == "" {
+		serviceName = "kiln"
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(serviceName))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(options.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
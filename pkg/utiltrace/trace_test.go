@@ -0,0 +1,110 @@
+package utiltrace
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kiln-mid/pkg/models"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+// record install a tracer provider recording the spans in memory for the duration of the test.
+func record(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	previousProvider, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+	return recorder
+}
+
+// spanNamed return the ended span named name.
+func spanNamed(t *testing.T, recorder *tracetest.SpanRecorder, name string) sdktrace.ReadOnlySpan {
+	for _, span := range recorder.Ended() {
+		if span.Name() == name {
+			return span
+		}
+	}
+	require.Failf(t, "span not found", "no span named %q", name)
+	return nil
+}
+
+func TestMiddleware_Propagation(t *testing.T) {
+	recorder := record(t)
+	gin.SetMode(gin.TestMode)
+
+	var downstream string
+	tzkt := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downstream = r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer tzkt.Close()
+
+	client := InstrumentClient(tzkt.Client())
+
+	router := gin.New()
+	router.Use(Middleware())
+	router.GET("/xtz/delegations", func(c *gin.Context) {
+		req, err := http.NewRequestWithContext(c.Request.Context(), http.MethodGet, tzkt.URL+"/v1/head", nil)
+		require.NoError(t, err)
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		c.Status(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/xtz/delegations", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	server := spanNamed(t, recorder, "GET /xtz/delegations")
+	require.Equal(t, trace.SpanKindServer, server.SpanKind())
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", server.SpanContext().TraceID().String())
+	require.Equal(t, "00f067aa0ba902b7", server.Parent().SpanID().String())
+	require.True(t, server.Parent().IsRemote())
+
+	call := spanNamed(t, recorder, "GET /v1/head")
+	require.Equal(t, trace.SpanKindClient, call.SpanKind())
+	require.Equal(t, server.SpanContext().SpanID(), call.Parent().SpanID())
+	require.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-"+call.SpanContext().SpanID().String()+"-01", downstream)
+}
+
+func TestGormPlugin(t *testing.T) {
+	recorder := record(t)
+
+	// A dry run builds the statements and runs the callbacks without a server.
+	db, err := gorm.Open(mysql.New(mysql.Config{DSN: "user:password@tcp(127.0.0.1:3306)/db", SkipInitializeWithVersion: true}), &gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	require.NoError(t, err)
+	require.NoError(t, db.Use(GormPlugin()))
+
+	ctx, parent := Tracer().Start(context.Background(), "parent")
+	db.WithContext(ctx).Where("delegator = ?", "foo").Find(&[]models.Delegations{})
+	parent.End()
+
+	span := spanNamed(t, recorder, "query delegations")
+	require.Equal(t, parent.SpanContext().SpanID(), span.Parent().SpanID())
+
+	var query string
+	for _, attr := range span.Attributes() {
+		if attr.Key == "db.query.text" {
+			query = attr.Value.AsString()
+		}
+	}
+	require.True(t, strings.HasPrefix(query, "SELECT * FROM `delegations` WHERE delegator = ?"), query)
+}
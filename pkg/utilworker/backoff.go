@@ -0,0 +1,42 @@
+package utilworker
+
+import "time"
+
+// DefaultBackoff is the backoff policy used when a field of Backoff is equal to 0.
+var DefaultBackoff = Backoff{
+	Initial:    time.Second,
+	Max:        5 * time.Minute,
+	Multiplier: 2,
+}
+
+// Backoff represent an exponential backoff policy, the delay start at Initial and is multiplied by Multiplier after each failure, up to Max.
+type Backoff struct {
+	Initial    time.Duration
+	Max        time.Duration
+	Multiplier float64
+}
+
+// Duration return the delay to wait after the given number of consecutive failures, starting at 1.
+func (b Backoff) Duration(failures int) time.Duration {
+	b = b.withDefaults()
+
+	delay := float64(b.Initial)
+	for i := 1; i < failures && delay < float64(b.Max); i++ {
+		delay *= b.Multiplier
+	}
+	return min(time.Duration(delay), b.Max)
+}
+
+// withDefaults return the backoff with DefaultBackoff values in place of zero fields.
+func (b Backoff) withDefaults() Backoff {
+	if b.Initial == 0 {
+		b.Initial = DefaultBackoff.Initial
+	}
+	if b.Max == 0 {
+		b.Max = DefaultBackoff.Max
+	}
+	if b.Multiplier == 0 {
+		b.Multiplier = DefaultBackoff.Multiplier
+	}
+	return b
+}
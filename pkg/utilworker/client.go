@@ -3,55 +3,439 @@ package utilworker
 import (
 	"context"
 	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"runtime/debug"
 	"sync"
 	"time"
-)
 
-var wg sync.WaitGroup
+	"github.com/kiln-mid/pkg/utillog"
+	"github.com/kiln-mid/pkg/utiltrace"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
 
 // DefaultWorkerInterval is the default interval duration used by TimeoutClient when no duration is provided.
 const DefaultWorkerInterval = 10 * time.Second
 
+// Options represent how a worker is scheduled and how it reacts to errors.
+// Interval is the duration between two successful runs, DefaultWorkerInterval is used when equal to 0 and Schedule is nil.
+// Schedule replace Interval when set, see Every, Cron and ParseSchedule.
+// Jitter delay each scheduled run by a random duration in [0, Jitter).
+// CatchUp decide what happens to the runs missed while a run was in flight, CatchUpSkip is used when empty.
+// Clock is the clock used to schedule runs, the system clock is used when nil.
+// Backoff is the delay policy applied after a failed run, DefaultBackoff is used when its fields are equal to 0.
+// MaxConsecutiveFailures escalate to OnFatal after this number of failed runs in a row, 0 means the worker retries forever.
+// OnFatal is called with the last error when the worker gives up, the worker is stopped afterward.
+// Timeout is the deadline of the context given to each run, 0 means runs have no deadline.
+// Elector make the worker a singleton: a run only happens on the instance holding the leadership, which is renewed every Heartbeat.
+// Heartbeat must be shorter than the leadership expiration of the Elector, DefaultHeartbeat is used when equal to 0.
+// Observer is notified of the outcome of every run, it can be nil.
+type Options struct {
+	Interval               time.Duration
+	Schedule               Schedule
+	Jitter                 time.Duration
+	CatchUp                CatchUpPolicy
+	Clock                  Clock
+	Timeout                time.Duration
+	Backoff                Backoff
+	MaxConsecutiveFailures int
+	OnFatal                func(name string, err error)
+	Elector                Elector
+	Heartbeat              time.Duration
+	Observer               Observer
+}
+
+// Observer is notified of the runs of a worker, it is the extension point of the metrics.
+type Observer interface {
+	// RunFinished is called once a run returned, err is nil when the run succeeded.
+	RunFinished(name string, duration time.Duration, err error)
+}
+
+// Elector decide which instance runs a singleton worker when the application is scaled horizontally.
+type Elector interface {
+	// IsLeader acquire or renew the leadership of the named worker and report whether this instance holds it.
+	IsLeader(ctx context.Context, name string) (bool, error)
+	// Resign release the leadership of the named worker if this instance holds it.
+	Resign(ctx context.Context, name string) error
+}
+
+// DefaultHeartbeat is the default interval at which the leadership is renewed while a run is in flight.
+const DefaultHeartbeat = 10 * time.Second
+
+// resignTimeout bound the time spent releasing the leadership when a worker stops.
+const resignTimeout = 5 * time.Second
+
 // StartNewIntervalWorker start a new worker called at an interval which is provided in params
 // worker name is used only for logging purpose.
 // fct represent the function called inside the worker.
 // a context should also be passed to cancel the worker.
 func StartNewIntervalWorker(name string, fct func(context.Context) error, interval time.Duration, ctx context.Context) {
-	if interval == 0 {
-		interval = DefaultWorkerInterval
+	StartWorker(ctx, name, fct, Options{Interval: interval})
+}
+
+// StartWorker start a new worker calling fct on the schedule provided in options until ctx is done.
+// Runs never overlap, a run is only started once the previous one returned.
+// A failed run is retried with an exponential backoff, the worker goes back to the normal interval after a successful run.
+// A permanent error, or reaching MaxConsecutiveFailures, escalate to OnFatal and stop the worker.
+func StartWorker(ctx context.Context, name string, fct func(context.Context) error, options Options) {
+	w := newWorker(name, fct, options)
+	go w.run(ctx, ctx.Done())
+}
+
+// worker hold a worker function, its options and its status.
+type worker struct {
+	name    string
+	fct     func(context.Context) error
+	options Options
+
+	mu     sync.Mutex
+	status Status
+
+	// hung is the result channel of an abandoned run, it is only accessed by the worker loop.
+	hung chan error
+	// cancelRun cancel the run in flight of a singleton worker, it is guarded by mu.
+	cancelRun context.CancelFunc
+	// calls track the calls of fct, including the abandoned ones which outlive the worker loop.
+	calls sync.WaitGroup
+}
+
+// newWorker return a worker with default options applied.
+func newWorker(name string, fct func(context.Context) error, options Options) *worker {
+	if options.Interval == 0 {
+		options.Interval = DefaultWorkerInterval
+	}
+	if options.Schedule == nil {
+		options.Schedule = Every(options.Interval)
+	}
+	if options.CatchUp == "" {
+		options.CatchUp = CatchUpSkip
+	}
+	if options.Clock == nil {
+		options.Clock = systemClock{}
 	}
+	if options.Heartbeat == 0 {
+		options.Heartbeat = DefaultHeartbeat
+	}
+	options.Backoff = options.Backoff.withDefaults()
 
-	fmt.Printf("[WORKER] %s started.\n", name)
-	go func() {
-		cancel := make(chan bool)
-		defer close(cancel)
-
-		ticker := time.NewTicker(interval)
-		defer ticker.Stop()
-
-		for {
-			select {
-			case <-ticker.C:
-				fmt.Printf("[WORKER] %s called.\n", name)
-
-				wg.Add(1)
-
-				go func() {
-					defer wg.Done()
-					err := fct(ctx)
-					if err != nil {
-						fmt.Println(err.Error())
-
-						cancel <- true
-					}
-				}()
-
-				wg.Wait()
-			case <-cancel:
-			case <-ctx.Done():
-				fmt.Printf("[WORKER] %s stopped.\n", name)
-				return
+	return &worker{
+		name:    name,
+		fct:     fct,
+		options: options,
+		status:  Status{Name: name, State: StateIdle},
+	}
+}
+
+// run call the worker function until stop is closed or the worker gives up.
+// ctx is passed to every run, a run in flight when stop is closed is completed before returning.
+// The logs of the worker and of its runs carry the worker name.
+func (w *worker) run(ctx context.Context, stop <-chan struct{}) {
+	ctx = utillog.With(ctx, utillog.KeyWorker, w.name)
+
+	slog.InfoContext(ctx, "worker started")
+	defer w.setState(StateStopped)
+	defer slog.InfoContext(ctx, "worker stopped")
+
+	if w.options.Elector != nil {
+		quit := make(chan struct{})
+		campaignDone := make(chan struct{})
+		go func() {
+			defer close(campaignDone)
+			w.campaign(ctx, quit)
+		}()
+		defer func() {
+			close(quit)
+			<-campaignDone
+			w.resign(ctx)
+		}()
+	}
+
+	clock := w.options.Clock
+	slot := w.options.Schedule.Next(clock.Now())
+	next := w.jitter(slot)
+	failures := 0
+
+	for {
+		if slot.IsZero() {
+			slog.InfoContext(ctx, "worker has no next run scheduled")
+			return
+		}
+		w.scheduleNext(next)
+
+		select {
+		case <-clock.After(next.Sub(clock.Now())):
+		case <-stop:
+			return
+		}
+
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		if w.options.Elector != nil && !w.elect(ctx) {
+			slot = w.nextSlot(ctx, slot)
+			next = w.jitter(slot)
+			w.setState(StateStandby)
+			continue
+		}
+
+		err := w.call(ctx)
+		if err == nil {
+			failures = 0
+			slot = w.nextSlot(ctx, slot)
+			next = w.jitter(slot)
+			w.setState(StateIdle)
+			continue
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		failures++
+		class := Classify(err)
+
+		if class == ErrorPermanent || (w.options.MaxConsecutiveFailures > 0 && failures >= w.options.MaxConsecutiveFailures) {
+			slog.ErrorContext(ctx, "worker gave up", "failures", failures, "class", class, "error", err)
+			if w.options.OnFatal != nil {
+				w.options.OnFatal(w.name, err)
 			}
+			return
 		}
+
+		delay := w.options.Backoff.Duration(failures)
+		slog.WarnContext(ctx, "worker run failed, retrying", "failures", failures, "class", class, "error", err, "retry_in", delay)
+		next = clock.Now().Add(delay)
+		w.setState(StateBackoff)
+	}
+}
+
+// nextSlot return the scheduled time following slot, applying the catch-up policy when runs were missed.
+func (w *worker) nextSlot(ctx context.Context, slot time.Time) time.Time {
+	now := w.options.Clock.Now()
+	next := w.options.Schedule.Next(slot)
+	if next.IsZero() || !next.Before(now) {
+		return next
+	}
+
+	switch w.options.CatchUp {
+	case CatchUpOnce:
+		slog.WarnContext(ctx, "worker missed a run, running it now", "scheduled_at", next)
+		return now
+	default:
+		slog.WarnContext(ctx, "worker missed a run, skipping it", "scheduled_at", next)
+		return w.options.Schedule.Next(now)
+	}
+}
+
+// jitter delay t by a random duration in [0, Jitter).
+func (w *worker) jitter(t time.Time) time.Time {
+	if w.options.Jitter <= 0 || t.IsZero() {
+		return t
+	}
+	return t.Add(rand.N(w.options.Jitter))
+}
+
+// call run the worker function once and record the outcome in the worker status.
+// Each run has its own id, carried by the logs of the run, and runs in its own span, root of the spans of the run.
+func (w *worker) call(ctx context.Context) error {
+	runID := utillog.NewID()
+	ctx, span := utiltrace.Tracer().Start(ctx, "worker "+w.name,
+		trace.WithNewRoot(),
+		trace.WithAttributes(attribute.String(utillog.KeyWorker, w.name), attribute.String(utillog.KeyRunID, runID)),
+	)
+	defer span.End()
+	ctx = utiltrace.WithLogFields(utillog.With(ctx, utillog.KeyRunID, runID))
+
+	start := w.options.Clock.Now()
+	w.mu.Lock()
+	w.status.State = StateRunning
+	w.status.LastRunID = runID
+	w.status.LastRunAt = &start
+	w.mu.Unlock()
+
+	slog.DebugContext(ctx, "worker run started")
+	err := w.leaderCall(ctx)
+
+	end := w.options.Clock.Now()
+	if err == nil {
+		slog.DebugContext(ctx, "worker run succeeded", "duration", end.Sub(start))
+	}
+	if w.options.Observer != nil {
+		w.options.Observer.RunFinished(w.name, end.Sub(start), err)
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.status.Runs++
+	w.status.LastDurationSeconds = end.Sub(start).Seconds()
+	if err != nil {
+		w.status.Failures++
+		w.status.ConsecutiveFailures++
+		w.status.LastError = err.Error()
+		w.status.LastErrorClass = Classify(err)
+		w.status.LastFailureAt = &end
+	} else {
+		w.status.ConsecutiveFailures = 0
+		w.status.LastSuccessAt = &end
+	}
+	return err
+}
+
+// leaderCall call the worker function with a context canceled as soon as the leadership is lost,
+// so two instances never run a singleton worker together.
+func (w *worker) leaderCall(ctx context.Context) error {
+	if w.options.Elector == nil {
+		return w.protectedCall(ctx)
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	w.mu.Lock()
+	w.cancelRun = cancel
+	w.mu.Unlock()
+	defer func() {
+		w.mu.Lock()
+		w.cancelRun = nil
+		w.mu.Unlock()
+	}()
+
+	return w.protectedCall(runCtx)
+}
+
+// campaign renew or acquire the leadership every Options.Heartbeat until quit is closed.
+// The leader keeps its lease between runs so another instance cannot run the same slot, a run in flight is canceled when the leadership is lost.
+func (w *worker) campaign(ctx context.Context, quit <-chan struct{}) {
+	for {
+		if !w.elect(ctx) {
+			w.mu.Lock()
+			if w.cancelRun != nil {
+				slog.WarnContext(ctx, "worker lost the leadership, canceling the run")
+				w.cancelRun()
+			}
+			w.mu.Unlock()
+		}
+
+		select {
+		case <-w.options.Clock.After(w.options.Heartbeat):
+		case <-quit:
+			return
+		}
+	}
+}
+
+// elect ask the elector whether this instance leads the worker and record the answer, an election error is considered as a lost election.
+func (w *worker) elect(ctx context.Context) bool {
+	leader, err := w.options.Elector.IsLeader(ctx, w.name)
+	if err != nil {
+		slog.ErrorContext(ctx, "worker leader election failed", "error", err)
+		leader = false
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.status.Leader = leader
+	return leader
+}
+
+// resign release the leadership held by this instance so another instance can take over without waiting for the lease expiration.
+func (w *worker) resign(ctx context.Context) {
+	w.mu.Lock()
+	leader := w.status.Leader
+	w.status.Leader = false
+	w.mu.Unlock()
+
+	if w.options.Elector == nil || !leader {
+		return
+	}
+
+	resignCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), resignTimeout)
+	defer cancel()
+
+	if err := w.options.Elector.Resign(resignCtx, w.name); err != nil {
+		slog.ErrorContext(ctx, "worker resign failed", "error", err)
+	}
+}
+
+// protectedCall call the worker function in its own goroutine with a context bounded by Options.Timeout.
+// A panic is recovered and returned as a PanicError. A run still going when its context is done is abandoned and reported as failed,
+// the next run fails with ErrPreviousRunHung until the abandoned one returns so runs never overlap.
+func (w *worker) protectedCall(ctx context.Context) error {
+	if w.hung != nil {
+		select {
+		case <-w.hung:
+			w.hung = nil
+		default:
+			return ErrPreviousRunHung
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	runCtx, cancel := ctx, context.CancelFunc(func() {})
+	if w.options.Timeout > 0 {
+		runCtx, cancel = context.WithTimeout(ctx, w.options.Timeout)
+	}
+	defer cancel()
+
+	done := make(chan error, 1)
+	w.calls.Add(1)
+	go func() {
+		defer w.calls.Done()
+		defer func() {
+			if r := recover(); r != nil {
+				err := &PanicError{Value: r, Stack: debug.Stack()}
+				slog.ErrorContext(runCtx, "worker run panicked", "error", err, "stack", string(err.Stack))
+				done <- err
+			}
+		}()
+		done <- w.fct(runCtx)
 	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-runCtx.Done():
+		select {
+		case err := <-done:
+			return err
+		default:
+			w.hung = done
+			return fmt.Errorf("run abandoned: %w", runCtx.Err())
+		}
+	}
+}
+
+// setState update the state of the worker.
+func (w *worker) setState(state State) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.status.State = state
+	if state == StateStopped {
+		w.status.NextRunAt = nil
+	}
+}
+
+// scheduleNext record when the next run is expected.
+func (w *worker) scheduleNext(next time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.status.NextRunAt = &next
+}
+
+// Status return a copy of the worker status.
+func (w *worker) Status() Status {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.status
 }
@@ -3,50 +3,282 @@ package utilworker_test
 import (
 	"context"
 	"fmt"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/kiln-mid/pkg/utiltrace"
 	"github.com/kiln-mid/pkg/utilworker"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 func TestWorker_StartAndStop(t *testing.T) {
-	fnCalled := false
+	var calls atomic.Int32
 	fn := func(ctx context.Context) error {
-		fnCalled = true
+		calls.Add(1)
 		return nil
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	go utilworker.StartNewIntervalWorker("testWorker", fn, 5*time.Millisecond, ctx)
 
-	time.Sleep(50 * time.Millisecond)
-	assert.True(t, fnCalled)
+	require.Eventually(t, func() bool { return calls.Load() > 0 }, time.Second, time.Millisecond)
 
 	cancel()
 
-	fnCalled = false
+	// A run in flight when ctx is canceled may still complete, no other run is started.
+	stopped := calls.Load()
+	require.Never(t, func() bool { return calls.Load() > stopped+1 }, 50*time.Millisecond, 5*time.Millisecond)
+}
+
+func TestWorker_StartWithError(t *testing.T) {
+	var calls atomic.Int32
+	fn := func(ctx context.Context) error {
+		calls.Add(1)
+		return fmt.Errorf("AN ERROR OCCURED")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	utilworker.StartWorker(ctx, "testWorker", fn, utilworker.Options{
+		Interval: 5 * time.Millisecond,
+		Backoff:  utilworker.Backoff{Initial: time.Millisecond, Max: 2 * time.Millisecond},
+		Clock:    clock,
+	})
+	clock.blocked(t, 1)
 
-	time.Sleep(50 * time.Millisecond)
+	clock.Advance(5 * time.Millisecond)
+	clock.blocked(t, 1)
+	assert.Equal(t, int32(1), calls.Load())
 
-	assert.False(t, fnCalled)
+	// The failed run is retried after the backoff, not the interval.
+	clock.Advance(time.Millisecond)
+	clock.blocked(t, 1)
+	assert.Equal(t, int32(2), calls.Load())
+
+	// The backoff doubles up to its max.
+	clock.Advance(time.Millisecond)
+	assert.Equal(t, int32(2), calls.Load())
+	clock.Advance(time.Millisecond)
+	clock.blocked(t, 1)
+	assert.Equal(t, int32(3), calls.Load())
+
+	clock.Advance(2 * time.Millisecond)
+	clock.blocked(t, 1)
+	assert.Equal(t, int32(4), calls.Load())
 }
 
-func TestWorker_StartWithError(t *testing.T) {
-	fnCalled := false
+func TestWorker_RecoverAfterError(t *testing.T) {
+	var calls atomic.Int32
 	fn := func(ctx context.Context) error {
-		fnCalled = true
+		if calls.Add(1) == 1 {
+			return fmt.Errorf("AN ERROR OCCURED")
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	utilworker.StartWorker(ctx, "testWorker", fn, utilworker.Options{
+		Interval: 20 * time.Millisecond,
+		Backoff:  utilworker.Backoff{Initial: time.Millisecond},
+		Clock:    clock,
+	})
+	clock.blocked(t, 1)
+
+	clock.Advance(20 * time.Millisecond)
+	clock.blocked(t, 1)
+	assert.Equal(t, int32(1), calls.Load())
+
+	clock.Advance(time.Millisecond)
+	clock.blocked(t, 1)
+	assert.Equal(t, int32(2), calls.Load())
+
+	// After a successful run the worker goes back to the interval.
+	clock.Advance(18 * time.Millisecond)
+	assert.Equal(t, int32(2), calls.Load())
+	clock.Advance(time.Millisecond)
+	clock.blocked(t, 1)
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+func TestWorker_MaxConsecutiveFailures(t *testing.T) {
+	var calls atomic.Int32
+	fn := func(ctx context.Context) error {
+		calls.Add(1)
 		return fmt.Errorf("AN ERROR OCCURED")
 	}
 
-	go utilworker.StartNewIntervalWorker("testWorker", fn, 5*time.Millisecond, context.Background())
+	fatal := make(chan error, 1)
+
+	utilworker.StartWorker(context.Background(), "testWorker", fn, utilworker.Options{
+		Interval:               time.Millisecond,
+		Backoff:                utilworker.Backoff{Initial: time.Millisecond},
+		MaxConsecutiveFailures: 3,
+		OnFatal: func(name string, err error) {
+			fatal <- err
+		},
+	})
+
+	select {
+	case err := <-fatal:
+		assert.EqualError(t, err, "AN ERROR OCCURED")
+	case <-time.After(time.Second):
+		t.Fatal("OnFatal was not called")
+	}
+
+	// OnFatal is called once the worker gave up, it does not run again.
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+func TestWorker_PermanentError(t *testing.T) {
+	var calls atomic.Int32
+	fn := func(ctx context.Context) error {
+		calls.Add(1)
+		return utilworker.Permanent(fmt.Errorf("AN ERROR OCCURED"))
+	}
+
+	fatal := make(chan error, 1)
 
-	time.Sleep(50 * time.Millisecond)
-	assert.True(t, fnCalled)
+	utilworker.StartWorker(context.Background(), "testWorker", fn, utilworker.Options{
+		Interval: time.Millisecond,
+		OnFatal: func(name string, err error) {
+			fatal <- err
+		},
+	})
 
-	fnCalled = false
+	select {
+	case err := <-fatal:
+		assert.Equal(t, utilworker.ErrorPermanent, utilworker.Classify(err))
+	case <-time.After(time.Second):
+		t.Fatal("OnFatal was not called")
+	}
 
-	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestBackoff_Duration(t *testing.T) {
+	backoff := utilworker.Backoff{Initial: time.Second, Max: 10 * time.Second, Multiplier: 2}
+
+	for failures, expected := range map[int]time.Duration{
+		1: time.Second,
+		2: 2 * time.Second,
+		3: 4 * time.Second,
+		4: 8 * time.Second,
+		5: 10 * time.Second,
+		9: 10 * time.Second,
+	} {
+		assert.Equal(t, expected, backoff.Duration(failures))
+	}
+}
+
+func TestWorker_RecoverPanic(t *testing.T) {
+	var calls atomic.Int32
+	fn := func(ctx context.Context) error {
+		calls.Add(1)
+		var d *struct{ Level int }
+		_ = d.Level
+		return nil
+	}
+
+	fatal := make(chan error, 1)
+
+	utilworker.StartWorker(context.Background(), "testWorker", fn, utilworker.Options{
+		Interval:               time.Millisecond,
+		Backoff:                utilworker.Backoff{Initial: time.Millisecond},
+		MaxConsecutiveFailures: 2,
+		OnFatal: func(name string, err error) {
+			fatal <- err
+		},
+	})
+
+	select {
+	case err := <-fatal:
+		var panicErr *utilworker.PanicError
+		assert.ErrorAs(t, err, &panicErr)
+		assert.Contains(t, string(panicErr.Stack), "TestWorker_RecoverPanic")
+		assert.NotContains(t, err.Error(), "\n")
+		assert.Equal(t, utilworker.ErrorPanic, utilworker.Classify(err))
+	case <-time.After(time.Second):
+		t.Fatal("OnFatal was not called")
+	}
+
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestWorker_Timeout(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	fn := func(ctx context.Context) error {
+		calls.Add(1)
+		<-release
+		return nil
+	}
+
+	fatal := make(chan error, 2)
+
+	utilworker.StartWorker(context.Background(), "testWorker", fn, utilworker.Options{
+		Interval:               time.Millisecond,
+		Timeout:                5 * time.Millisecond,
+		Backoff:                utilworker.Backoff{Initial: time.Millisecond},
+		MaxConsecutiveFailures: 3,
+		OnFatal: func(name string, err error) {
+			fatal <- err
+		},
+	})
+
+	select {
+	case err := <-fatal:
+		assert.ErrorIs(t, err, utilworker.ErrPreviousRunHung)
+		assert.Equal(t, utilworker.ErrorTimeout, utilworker.Classify(err))
+	case <-time.After(time.Second):
+		t.Fatal("OnFatal was not called")
+	}
+
+	close(release)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestWorker_Span(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(previous)
+
+	fatal := make(chan error, 1)
+	fn := func(ctx context.Context) error {
+		_, child := utiltrace.Tracer().Start(ctx, "child")
+		child.End()
+		return utilworker.Permanent(fmt.Errorf("invalid"))
+	}
+
+	utilworker.StartWorker(context.Background(), "testWorker", fn, utilworker.Options{
+		Interval: time.Millisecond,
+		OnFatal: func(name string, err error) {
+			fatal <- err
+		},
+	})
+
+	select {
+	case <-fatal:
+	case <-time.After(time.Second):
+		t.Fatal("OnFatal was not called")
+	}
 
-	assert.False(t, fnCalled)
+	spans := recorder.Ended()
+	assert.Len(t, spans, 2)
+	child, run := spans[0], spans[1]
+	assert.Equal(t, "worker testWorker", run.Name())
+	assert.Equal(t, codes.Error, run.Status().Code)
+	assert.False(t, run.Parent().IsValid())
+	assert.Equal(t, run.SpanContext().SpanID(), child.Parent().SpanID())
 }
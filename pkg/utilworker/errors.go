@@ -0,0 +1,72 @@
+package utilworker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrorClass represent how a worker react to an error returned by its function.
+type ErrorClass string
+
+const (
+	// ErrorTransient is retried with a backoff.
+	ErrorTransient ErrorClass = "transient"
+	// ErrorTimeout is a run which exceeded its deadline, it is retried with a backoff.
+	ErrorTimeout ErrorClass = "timeout"
+	// ErrorPanic is a run which panicked, it is retried with a backoff.
+	ErrorPanic ErrorClass = "panic"
+	// ErrorPermanent cannot be fixed by retrying, the worker escalate it immediately.
+	ErrorPermanent ErrorClass = "permanent"
+)
+
+// ErrPreviousRunHung is returned instead of running the worker function while an abandoned run has not returned yet.
+var ErrPreviousRunHung = errors.New("previous run is still hung")
+
+// PanicError is returned when the worker function panicked, Stack is the stack trace of the panicking goroutine.
+// The stack is logged once where the panic is recovered, it is left out of the message so statuses and logs stay on one line.
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// permanentError mark an error as permanent.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent wrap err so the worker escalate it instead of retrying.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// Classify return the class of an error returned by a worker function.
+func Classify(err error) ErrorClass {
+	var permanent *permanentError
+	var panicked *PanicError
+	switch {
+	case errors.As(err, &permanent):
+		return ErrorPermanent
+	case errors.As(err, &panicked):
+		return ErrorPanic
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, ErrPreviousRunHung):
+		return ErrorTimeout
+	default:
+		return ErrorTransient
+	}
+}
@@ -0,0 +1,259 @@
+package utilworker
+
+import (
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule decide when a worker runs.
+type Schedule interface {
+	// Next return the first run time strictly after t, a zero time means there is no next run.
+	Next(t time.Time) time.Time
+}
+
+// CatchUpPolicy decide what happens to the scheduled runs missed while a run was in flight.
+type CatchUpPolicy string
+
+const (
+	// CatchUpSkip drop missed runs and wait for the next scheduled time.
+	CatchUpSkip CatchUpPolicy = "skip"
+	// CatchUpOnce run once immediately for all the missed runs, then resume the schedule.
+	CatchUpOnce CatchUpPolicy = "once"
+)
+
+// Clock provide the current time and timers to the workers, it can be replaced in tests.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// systemClock is the Clock based on the time package.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// intervalSchedule run every interval.
+type intervalSchedule struct {
+	interval time.Duration
+}
+
+// Every return a Schedule running every interval.
+func Every(interval time.Duration) Schedule {
+	return intervalSchedule{interval: interval}
+}
+
+func (s intervalSchedule) Next(t time.Time) time.Time {
+	return t.Add(s.interval)
+}
+
+// cronDescriptors are the predefined cron specs accepted by Cron.
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// cronField describe the bounds and the names accepted by a cron field.
+type cronField struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var (
+	minuteField = cronField{name: "minute", min: 0, max: 59}
+	hourField   = cronField{name: "hour", min: 0, max: 23}
+	domField    = cronField{name: "day of month", min: 1, max: 31}
+	monthField  = cronField{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	dowField = cronField{name: "day of week", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+// cronSchedule run at the minutes matching a 5 fields cron spec, in a time zone.
+// Each field is a bitset of the accepted values.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// domStar and dowStar record whether the day fields are `*`, a day then only has to match the other field.
+	domStar, dowStar bool
+	location         *time.Location
+}
+
+// Cron return a Schedule from a standard 5 fields cron spec: minute, hour, day of month, month and day of week.
+// Fields accept `*`, values, ranges `a-b`, steps `*/n` or `a-b/n`, lists `a,b` and english names for months and days.
+// Descriptors `@yearly`, `@monthly`, `@weekly`, `@daily`, `@hourly` are accepted. Times are computed in location, UTC when nil.
+func Cron(spec string, location *time.Location) (Schedule, error) {
+	if location == nil {
+		location = time.UTC
+	}
+	if descriptor, ok := cronDescriptors[strings.ToLower(strings.TrimSpace(spec))]; ok {
+		spec = descriptor
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron spec %q: expected 5 fields, got %d", spec, len(fields))
+	}
+
+	s := &cronSchedule{location: location}
+	var err error
+	if s.minute, err = parseCronField(fields[0], minuteField); err != nil {
+		return nil, err
+	}
+	if s.hour, err = parseCronField(fields[1], hourField); err != nil {
+		return nil, err
+	}
+	if s.dom, err = parseCronField(fields[2], domField); err != nil {
+		return nil, err
+	}
+	if s.month, err = parseCronField(fields[3], monthField); err != nil {
+		return nil, err
+	}
+	if s.dow, err = parseCronField(fields[4], dowField); err != nil {
+		return nil, err
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domStar = fields[2] == "*"
+	s.dowStar = fields[4] == "*"
+	return s, nil
+}
+
+// ParseSchedule return a Schedule from `@every <duration>` or from a cron spec accepted by Cron.
+// A `CRON_TZ=<zone>` prefix computes the times of a cron spec in zone rather than in location.
+func ParseSchedule(spec string, location *time.Location) (Schedule, error) {
+	if zoned, ok := strings.CutPrefix(strings.TrimSpace(spec), "CRON_TZ="); ok {
+		zone, cron, _ := strings.Cut(zoned, " ")
+		l, err := time.LoadLocation(zone)
+		if err != nil {
+			return nil, fmt.Errorf("schedule %q: %w", spec, err)
+		}
+		return Cron(strings.TrimSpace(cron), l)
+	}
+
+	if interval, ok := strings.CutPrefix(strings.TrimSpace(spec), "@every "); ok {
+		d, err := time.ParseDuration(strings.TrimSpace(interval))
+		if err != nil {
+			return nil, fmt.Errorf("schedule %q: %w", spec, err)
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("schedule %q: interval must be positive", spec)
+		}
+		return Every(d), nil
+	}
+	return Cron(spec, location)
+}
+
+// parseCronField return the bitset of the values accepted by a cron field.
+func parseCronField(expr string, field cronField) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(expr, ",") {
+		rangeExpr, stepExpr, hasStep := strings.Cut(part, "/")
+
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepExpr); err != nil || step <= 0 {
+				return 0, fmt.Errorf("cron %s: invalid step %q", field.name, stepExpr)
+			}
+		}
+
+		start, end := field.min, field.max
+		if rangeExpr != "*" {
+			low, high, isRange := strings.Cut(rangeExpr, "-")
+			var err error
+			if start, err = parseCronValue(low, field); err != nil {
+				return 0, err
+			}
+			end = start
+			if isRange {
+				if end, err = parseCronValue(high, field); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				end = field.max
+			}
+			if start > end {
+				return 0, fmt.Errorf("cron %s: invalid range %q", field.name, rangeExpr)
+			}
+		}
+
+		for v := start; v <= end; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+// parseCronValue return a value of a cron field, either a number or a name.
+func parseCronValue(expr string, field cronField) (int, error) {
+	if v, ok := field.names[strings.ToLower(expr)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(expr)
+	if err != nil || v < field.min || v > field.max {
+		return 0, fmt.Errorf("cron %s: invalid value %q", field.name, expr)
+	}
+	return v, nil
+}
+
+// cronSearchLimit bound the search of the next run, a spec like `0 0 30 2 *` never matches.
+const cronSearchLimit = 5 * 366 * 24 * time.Hour
+
+func (s *cronSchedule) Next(t time.Time) time.Time {
+	t = t.In(s.location)
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, s.location).Add(time.Minute)
+	limit := t.Add(cronSearchLimit)
+
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, s.location)
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, s.location)
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, s.location)
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = s.nextMinute(t)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// nextMinute return the next accepted minute of the hour holding t, or the start of the next hour.
+func (s *cronSchedule) nextMinute(t time.Time) time.Time {
+	remaining := s.minute >> uint(t.Minute())
+	if remaining == 0 {
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, s.location)
+	}
+	return t.Add(time.Duration(bits.TrailingZeros64(remaining)) * time.Minute)
+}
+
+// dayMatches report whether the day of t is accepted, a day restricted by both day fields only has to match one of them.
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
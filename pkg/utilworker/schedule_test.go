@@ -0,0 +1,238 @@
+package utilworker_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kiln-mid/pkg/utilworker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCron_Next(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	require.NoError(t, err)
+
+	for _, tt := range []struct {
+		name     string
+		spec     string
+		location *time.Location
+		from     time.Time
+		next     time.Time
+	}{
+		{
+			name: "every minute",
+			spec: "* * * * *",
+			from: time.Date(2024, 1, 1, 10, 0, 30, 0, time.UTC),
+			next: time.Date(2024, 1, 1, 10, 1, 0, 0, time.UTC),
+		},
+		{
+			name: "daily at 3am",
+			spec: "0 3 * * *",
+			from: time.Date(2024, 1, 1, 3, 0, 0, 0, time.UTC),
+			next: time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "steps and ranges",
+			spec: "*/15 9-17 * * mon-fri",
+			from: time.Date(2024, 1, 5, 17, 50, 0, 0, time.UTC),
+			next: time.Date(2024, 1, 8, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "list of minutes",
+			spec: "5,35 * * * *",
+			from: time.Date(2024, 1, 1, 10, 6, 0, 0, time.UTC),
+			next: time.Date(2024, 1, 1, 10, 35, 0, 0, time.UTC),
+		},
+		{
+			name: "day of month or day of week",
+			spec: "0 0 15 * sun",
+			from: time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC),
+			next: time.Date(2024, 1, 14, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "leap day",
+			spec: "0 0 29 feb *",
+			from: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+			next: time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "descriptor",
+			spec: "@monthly",
+			from: time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC),
+			next: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "time zone",
+			spec:     "0 3 * * *",
+			location: paris,
+			from:     time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC),
+			next:     time.Date(2024, 7, 1, 1, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "never matches",
+			spec: "0 0 30 feb *",
+			from: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			next: time.Time{},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := utilworker.Cron(tt.spec, tt.location)
+			require.NoError(t, err)
+
+			next := schedule.Next(tt.from)
+			if tt.next.IsZero() {
+				require.True(t, next.IsZero())
+				return
+			}
+			require.True(t, tt.next.Equal(next), "expected %s, got %s", tt.next, next)
+		})
+	}
+}
+
+func TestParseSchedule(t *testing.T) {
+	schedule, err := utilworker.ParseSchedule("@every 90s", nil)
+	require.NoError(t, err)
+
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	require.Equal(t, from.Add(90*time.Second), schedule.Next(from))
+
+	// The time zone of the spec replace the one given.
+	paris, err := time.LoadLocation("Europe/Paris")
+	require.NoError(t, err)
+	schedule, err = utilworker.ParseSchedule("CRON_TZ=Europe/Paris 0 3 * * *", time.UTC)
+	require.NoError(t, err)
+	require.True(t, time.Date(2024, 7, 1, 3, 0, 0, 0, paris).Equal(schedule.Next(from.AddDate(0, 6, 0))))
+
+	schedule, err = utilworker.ParseSchedule("0 3 * * *", paris)
+	require.NoError(t, err)
+	require.True(t, time.Date(2024, 1, 1, 3, 0, 0, 0, paris).Equal(schedule.Next(from)))
+
+	for _, spec := range []string{"@every -1s", "CRON_TZ=Mars/Olympus 0 3 * * *", "CRON_TZ=UTC @every 1h", "* * * *", "60 * * * *", "* * * 13 *", "5-1 * * * *", "*/0 * * * *"} {
+		_, err := utilworker.ParseSchedule(spec, nil)
+		require.Error(t, err, spec)
+	}
+}
+
+// fakeClock is a Clock whose time only moves with Advance.
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+}
+
+type fakeWaiter struct {
+	at time.Time
+	c  chan time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.waiters = append(c.waiters, fakeWaiter{at: c.now.Add(d), c: ch})
+	return ch
+}
+
+// Advance move the clock and fire the timers which are due.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	waiters := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.at.After(c.now) {
+			waiters = append(waiters, w)
+			continue
+		}
+		w.c <- c.now
+	}
+	c.waiters = waiters
+	c.mu.Unlock()
+}
+
+// blocked wait for n timers to be pending, the worker is then waiting for the clock to move.
+func (c *fakeClock) blocked(t *testing.T, n int) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return len(c.waiters) == n
+	}, time.Second, time.Millisecond)
+}
+
+func TestWorker_CatchUp(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		catchUp utilworker.CatchUpPolicy
+		runs    []time.Time
+	}{
+		{
+			name:    "skip missed runs",
+			catchUp: utilworker.CatchUpSkip,
+			runs: []time.Time{
+				time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC),
+				time.Date(2024, 1, 1, 5, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:    "run once for missed runs",
+			catchUp: utilworker.CatchUpOnce,
+			runs: []time.Time{
+				time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC),
+				time.Date(2024, 1, 1, 4, 30, 0, 0, time.UTC),
+				time.Date(2024, 1, 1, 5, 0, 0, 0, time.UTC),
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 30, 0, 0, time.UTC)}
+			schedule, err := utilworker.Cron("@hourly", nil)
+			require.NoError(t, err)
+
+			var mu sync.Mutex
+			runs := []time.Time{}
+			fn := func(ctx context.Context) error {
+				mu.Lock()
+				defer mu.Unlock()
+				runs = append(runs, clock.Now())
+				if len(runs) == 1 {
+					clock.mu.Lock()
+					clock.now = clock.now.Add(3*time.Hour + 30*time.Minute)
+					clock.mu.Unlock()
+				}
+				return nil
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			utilworker.StartWorker(ctx, "testWorker", fn, utilworker.Options{
+				Schedule: schedule,
+				CatchUp:  tt.catchUp,
+				Clock:    clock,
+			})
+			clock.blocked(t, 1)
+
+			clock.Advance(30 * time.Minute)
+			clock.blocked(t, 1)
+			clock.Advance(30 * time.Minute)
+			clock.blocked(t, 1)
+
+			mu.Lock()
+			defer mu.Unlock()
+			assert.Equal(t, tt.runs, runs)
+		})
+	}
+}
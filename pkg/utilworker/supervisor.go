@@ -0,0 +1,157 @@
+package utilworker
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// State represent what a worker is doing.
+type State string
+
+const (
+	// StateIdle is a worker waiting for its next run.
+	StateIdle State = "idle"
+	// StateRunning is a worker whose function is being called.
+	StateRunning State = "running"
+	// StateBackoff is a worker waiting to retry a failed run.
+	StateBackoff State = "backoff"
+	// StateStandby is a singleton worker waiting for another instance to lose the leadership.
+	StateStandby State = "standby"
+	// StateStopped is a worker which is not scheduled anymore.
+	StateStopped State = "stopped"
+)
+
+// Status represent the state of a worker and the outcome of its runs.
+type Status struct {
+	Name                string     `json:"name"`
+	State               State      `json:"state"`
+	Leader              bool       `json:"leader"`
+	Runs                int        `json:"runs"`
+	Failures            int        `json:"failures"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	LastRunID           string     `json:"last_run_id,omitempty"`
+	LastRunAt           *time.Time `json:"last_run_at"`
+	LastDurationSeconds float64    `json:"last_duration_seconds"`
+	LastSuccessAt       *time.Time `json:"last_success_at"`
+	LastFailureAt       *time.Time `json:"last_failure_at"`
+	LastError           string     `json:"last_error,omitempty"`
+	LastErrorClass      ErrorClass `json:"last_error_class,omitempty"`
+	NextRunAt           *time.Time `json:"next_run_at"`
+}
+
+// Supervisor register named workers, start them together and drain them on shutdown.
+type Supervisor struct {
+	mu         sync.Mutex
+	workers    []*worker
+	started    bool
+	stop       chan struct{}
+	cancelRuns context.CancelFunc
+	wg         sync.WaitGroup
+}
+
+// NewSupervisor return an empty Supervisor.
+func NewSupervisor() *Supervisor {
+	return &Supervisor{
+		stop: make(chan struct{}),
+	}
+}
+
+// Register add a named worker to the supervisor, it is started with the supervisor.
+// An error is returned if the name is already registered or the supervisor is started.
+func (s *Supervisor) Register(name string, fct func(context.Context) error, options Options) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.started {
+		return fmt.Errorf("supervisor already started, cannot register %s", name)
+	}
+	for _, w := range s.workers {
+		if w.name == name {
+			return fmt.Errorf("worker %s already registered", name)
+		}
+	}
+
+	s.workers = append(s.workers, newWorker(name, fct, options))
+	return nil
+}
+
+// Start start every registered worker, ctx is passed to every run.
+func (s *Supervisor) Start(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.started {
+		return
+	}
+	s.started = true
+
+	runCtx, cancel := context.WithCancel(ctx)
+	s.cancelRuns = cancel
+
+	for _, w := range s.workers {
+		s.wg.Add(1)
+		go func(w *worker) {
+			defer s.wg.Done()
+			w.run(runCtx, s.stop)
+		}(w)
+	}
+}
+
+// Status return the status of every registered worker in registration order.
+func (s *Supervisor) Status() []Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statuses := make([]Status, 0, len(s.workers))
+	for _, w := range s.workers {
+		statuses = append(statuses, w.Status())
+	}
+	return statuses
+}
+
+// Shutdown stop scheduling new runs and wait for the runs in flight to complete.
+// If ctx is done first, the context of the runs in flight is canceled and ctx error is returned.
+func (s *Supervisor) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	select {
+	case <-s.stop:
+	default:
+		close(s.stop)
+	}
+	cancel := s.cancelRuns
+	s.mu.Unlock()
+
+	if cancel == nil {
+		return nil
+	}
+
+	err := s.Wait(ctx)
+	cancel()
+	return err
+}
+
+// Wait wait for the runs in flight to return, including the runs abandoned when a Shutdown timed out.
+// ctx error is returned if it is done first.
+func (s *Supervisor) Wait(ctx context.Context) error {
+	s.mu.Lock()
+	workers := append([]*worker{}, s.workers...)
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		for _, w := range workers {
+			w.calls.Wait()
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("workers still running: %w", ctx.Err())
+	}
+}
@@ -0,0 +1,218 @@
+package utilworker_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kiln-mid/pkg/utilworker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSupervisor_Status(t *testing.T) {
+	s := utilworker.NewSupervisor()
+
+	require.NoError(t, s.Register("success", func(ctx context.Context) error { return nil }, utilworker.Options{Interval: 5 * time.Millisecond}))
+	require.NoError(t, s.Register("failure", func(ctx context.Context) error { return fmt.Errorf("AN ERROR OCCURED") }, utilworker.Options{
+		Interval: 5 * time.Millisecond,
+		Backoff:  utilworker.Backoff{Initial: time.Hour},
+	}))
+	require.Error(t, s.Register("success", func(ctx context.Context) error { return nil }, utilworker.Options{}))
+
+	s.Start(context.Background())
+	require.Eventually(t, func() bool {
+		statuses := s.Status()
+		return statuses[0].Runs > 1 && statuses[1].State == utilworker.StateBackoff
+	}, time.Second, time.Millisecond)
+
+	statuses := s.Status()
+	require.Len(t, statuses, 2)
+
+	assert.Equal(t, "success", statuses[0].Name)
+	assert.Equal(t, utilworker.StateIdle, statuses[0].State)
+	assert.Greater(t, statuses[0].Runs, 1)
+	assert.NotNil(t, statuses[0].LastSuccessAt)
+
+	assert.Equal(t, "failure", statuses[1].Name)
+	assert.Equal(t, utilworker.StateBackoff, statuses[1].State)
+	assert.Equal(t, 1, statuses[1].ConsecutiveFailures)
+	assert.Equal(t, "AN ERROR OCCURED", statuses[1].LastError)
+
+	require.NoError(t, s.Shutdown(context.Background()))
+	for _, status := range s.Status() {
+		assert.Equal(t, utilworker.StateStopped, status.State)
+	}
+}
+
+func TestSupervisor_ShutdownWaitInFlightRuns(t *testing.T) {
+	s := utilworker.NewSupervisor()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var completed atomic.Bool
+	require.NoError(t, s.Register("slow", func(ctx context.Context) error {
+		close(started)
+		<-release
+		completed.Store(true)
+		return nil
+	}, utilworker.Options{Interval: time.Millisecond, Backoff: utilworker.Backoff{Initial: time.Hour}}))
+
+	s.Start(context.Background())
+	<-started
+
+	shutdown := make(chan error, 1)
+	go func() {
+		shutdown <- s.Shutdown(context.Background())
+	}()
+
+	select {
+	case <-shutdown:
+		t.Fatal("Shutdown returned before the run in flight")
+	default:
+	}
+
+	close(release)
+	require.NoError(t, <-shutdown)
+	assert.True(t, completed.Load())
+}
+
+func TestSupervisor_ShutdownDeadline(t *testing.T) {
+	s := utilworker.NewSupervisor()
+
+	started := make(chan struct{})
+	require.NoError(t, s.Register("hung", func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	}, utilworker.Options{Interval: time.Millisecond}))
+
+	s.Start(context.Background())
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	require.ErrorIs(t, s.Shutdown(ctx), context.DeadlineExceeded)
+
+	// The run abandoned at the deadline is canceled, it returns.
+	require.NoError(t, s.Wait(context.Background()))
+}
+
+func TestSupervisor_WaitAbandonedRun(t *testing.T) {
+	s := utilworker.NewSupervisor()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	require.NoError(t, s.Register("stuck", func(ctx context.Context) error {
+		close(started)
+		<-release
+		return nil
+	}, utilworker.Options{Interval: time.Millisecond}))
+
+	s.Start(context.Background())
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, s.Shutdown(ctx), context.DeadlineExceeded)
+
+	// A run ignoring the cancellation is still running.
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, s.Wait(ctx), context.DeadlineExceeded)
+
+	close(release)
+	require.NoError(t, s.Wait(context.Background()))
+}
+
+// fakeElector is an in-memory Elector shared by several supervisors, the first instance asking for a worker leads it until it resigns.
+type fakeElector struct {
+	mu      sync.Mutex
+	leaders map[string]string
+}
+
+// instance return the Elector used by the named instance.
+func (e *fakeElector) instance(holder string) utilworker.Elector {
+	return fakeInstance{elector: e, holder: holder}
+}
+
+type fakeInstance struct {
+	elector *fakeElector
+	holder  string
+}
+
+func (i fakeInstance) IsLeader(ctx context.Context, name string) (bool, error) {
+	i.elector.mu.Lock()
+	defer i.elector.mu.Unlock()
+	if _, ok := i.elector.leaders[name]; !ok {
+		i.elector.leaders[name] = i.holder
+	}
+	return i.elector.leaders[name] == i.holder, nil
+}
+
+func (i fakeInstance) Resign(ctx context.Context, name string) error {
+	i.elector.mu.Lock()
+	defer i.elector.mu.Unlock()
+	if i.elector.leaders[name] == i.holder {
+		delete(i.elector.leaders, name)
+	}
+	return nil
+}
+
+func TestSupervisor_LeaderElection(t *testing.T) {
+	elector := &fakeElector{leaders: map[string]string{}}
+
+	var runsA, runsB atomic.Int32
+	a := utilworker.NewSupervisor()
+	require.NoError(t, a.Register("singleton", func(ctx context.Context) error {
+		runsA.Add(1)
+		return nil
+	}, utilworker.Options{Interval: 5 * time.Millisecond, Elector: elector.instance("a"), Heartbeat: 5 * time.Millisecond}))
+	a.Start(context.Background())
+	require.Eventually(t, func() bool { return runsA.Load() > 0 && a.Status()[0].Leader }, time.Second, time.Millisecond)
+
+	b := utilworker.NewSupervisor()
+	require.NoError(t, b.Register("singleton", func(ctx context.Context) error {
+		runsB.Add(1)
+		return nil
+	}, utilworker.Options{Interval: 5 * time.Millisecond, Elector: elector.instance("b"), Heartbeat: 5 * time.Millisecond}))
+	b.Start(context.Background())
+	require.Eventually(t, func() bool { return b.Status()[0].State == utilworker.StateStandby }, time.Second, time.Millisecond)
+
+	assert.Equal(t, int32(0), runsB.Load())
+	assert.True(t, a.Status()[0].Leader)
+
+	// a resigns on shutdown, b takes the lead.
+	require.NoError(t, a.Shutdown(context.Background()))
+	require.Eventually(t, func() bool { return runsB.Load() > 0 && b.Status()[0].Leader }, time.Second, time.Millisecond)
+	require.NoError(t, b.Shutdown(context.Background()))
+}
+
+func TestSupervisor_LeadershipLost(t *testing.T) {
+	elector := &fakeElector{leaders: map[string]string{}}
+
+	canceled := make(chan struct{})
+	s := utilworker.NewSupervisor()
+	require.NoError(t, s.Register("singleton", func(ctx context.Context) error {
+		elector.mu.Lock()
+		elector.leaders["singleton"] = "another"
+		elector.mu.Unlock()
+
+		<-ctx.Done()
+		close(canceled)
+		return ctx.Err()
+	}, utilworker.Options{Interval: time.Millisecond, Elector: elector.instance("a"), Heartbeat: 5 * time.Millisecond}))
+	s.Start(context.Background())
+
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Fatal("the run was not canceled after losing the leadership")
+	}
+	require.NoError(t, s.Shutdown(context.Background()))
+	assert.False(t, s.Status()[0].Leader)
+}
@@ -0,0 +1,313 @@
+package verify
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/kiln-mid/pkg/backfill"
+	"github.com/kiln-mid/pkg/db"
+	"github.com/kiln-mid/pkg/delegations"
+	"github.com/kiln-mid/pkg/models"
+	"github.com/kiln-mid/pkg/tezos"
+)
+
+const (
+	// DefaultBucketDuration is the default duration of the buckets of a time range.
+	DefaultBucketDuration = 24 * time.Hour
+	// DefaultBucketLevels is the default number of levels of the buckets of a level range.
+	DefaultBucketLevels = 10000
+	// DefaultPageSize is the default number of delegations read per query or request.
+	DefaultPageSize = 1000
+)
+
+// Options represent how a range is verified, default values are used for fields equal to 0.
+// Repair store the missing and mismatched delegations fetched from tzkt and delete the extra ones.
+type Options struct {
+	BucketDuration time.Duration
+	BucketLevels   int
+	PageSize       int
+	Repair         bool
+}
+
+// withDefaults return the options with default values applied to fields equal to 0.
+func (o Options) withDefaults() Options {
+	if o.BucketDuration <= 0 {
+		o.BucketDuration = DefaultBucketDuration
+	}
+	if o.BucketLevels <= 0 {
+		o.BucketLevels = DefaultBucketLevels
+	}
+	if o.PageSize <= 0 {
+		o.PageSize = DefaultPageSize
+	}
+	return o
+}
+
+// Mismatch is a delegation stored with values different from tzkt.
+type Mismatch struct {
+	ID     int                `json:"id"`
+	Local  models.Delegations `json:"local"`
+	Remote models.Delegations `json:"remote"`
+}
+
+// Bucket is the comparison of a part of the verified range, either a time range [From, To) or a level range [FromLevel, ToLevel).
+// Checksums are the hex SHA-256 of the sorted tezos ids and amounts. Missing, Extra and Mismatched are only filled for divergent buckets.
+type Bucket struct {
+	From           *time.Time `json:"from,omitempty"`
+	To             *time.Time `json:"to,omitempty"`
+	FromLevel      int        `json:"from_level,omitempty"`
+	ToLevel        int        `json:"to_level,omitempty"`
+	LocalCount     int        `json:"local_count"`
+	RemoteCount    int        `json:"remote_count"`
+	LocalChecksum  string     `json:"local_checksum"`
+	RemoteChecksum string     `json:"remote_checksum"`
+	Missing        []int      `json:"missing,omitempty"`
+	Extra          []int      `json:"extra,omitempty"`
+	Mismatched     []Mismatch `json:"mismatched,omitempty"`
+	Repaired       bool       `json:"repaired,omitempty"`
+}
+
+// Divergent report whether the bucket differs from tzkt.
+func (b Bucket) Divergent() bool {
+	return len(b.Missing) > 0 || len(b.Extra) > 0 || len(b.Mismatched) > 0
+}
+
+// Report is the outcome of a verification.
+type Report struct {
+	Buckets    []Bucket `json:"buckets"`
+	Divergent  int      `json:"divergent_buckets"`
+	Missing    int      `json:"missing"`
+	Extra      int      `json:"extra"`
+	Mismatched int      `json:"mismatched"`
+	Repaired   int      `json:"repaired_buckets"`
+}
+
+// Unresolved report whether a divergent bucket has not been repaired.
+func (r Report) Unresolved() bool {
+	return r.Divergent > r.Repaired
+}
+
+// Verifier compare the delegations stored with tzkt bucket by bucket, and drill down to the operations which differ.
+type Verifier struct {
+	options               Options
+	delegationsClient     *delegations.Client
+	delegationsRepository db.DelegationsRepository
+	now                   func() time.Time
+}
+
+// NewVerifier return a new Verifier fetching tzkt through delegationsClient and reading the database with dr.
+func NewVerifier(delegationsClient *delegations.Client, dr db.DelegationsRepository, options Options) *Verifier {
+	return &Verifier{
+		options:               options.withDefaults(),
+		delegationsClient:     delegationsClient,
+		delegationsRepository: dr,
+		now:                   time.Now,
+	}
+}
+
+// Run verify every bucket of the range and repair the divergent ones when Options.Repair is set.
+func (v *Verifier) Run(ctx context.Context, r backfill.Range) (Report, error) {
+	if err := r.Validate(v.now()); err != nil {
+		return Report{}, err
+	}
+
+	report := Report{Buckets: []Bucket{}}
+	for _, bucket := range v.split(r) {
+		bucket, err := v.verifyBucket(ctx, bucket)
+		if err != nil {
+			return report, err
+		}
+
+		if bucket.Divergent() {
+			report.Divergent++
+			report.Missing += len(bucket.Missing)
+			report.Extra += len(bucket.Extra)
+			report.Mismatched += len(bucket.Mismatched)
+			if bucket.Repaired {
+				report.Repaired++
+			}
+		}
+		report.Buckets = append(report.Buckets, bucket)
+	}
+
+	return report, nil
+}
+
+// split cut the range into buckets of BucketDuration or BucketLevels, the last bucket may be shorter.
+func (v *Verifier) split(r backfill.Range) []Bucket {
+	buckets := []Bucket{}
+
+	if r.IsLevel() {
+		for from := r.FromLevel; from < r.ToLevel; from += v.options.BucketLevels {
+			buckets = append(buckets, Bucket{FromLevel: from, ToLevel: min(from+v.options.BucketLevels, r.ToLevel)})
+		}
+		return buckets
+	}
+
+	for from := r.From.UTC(); from.Before(r.To); from = from.Add(v.options.BucketDuration) {
+		bucketFrom, bucketTo := from, from.Add(v.options.BucketDuration)
+		if bucketTo.After(r.To) {
+			bucketTo = r.To.UTC()
+		}
+		buckets = append(buckets, Bucket{From: &bucketFrom, To: &bucketTo})
+	}
+	return buckets
+}
+
+// verifyBucket compare the checksums of a bucket and, when they differ, list the missing, extra and mismatched delegations.
+func (v *Verifier) verifyBucket(ctx context.Context, bucket Bucket) (Bucket, error) {
+	local, err := v.fetchLocal(ctx, bucket)
+	if err != nil {
+		return bucket, err
+	}
+
+	remote, err := v.fetchRemote(ctx, bucket)
+	if err != nil {
+		return bucket, err
+	}
+
+	bucket.LocalCount, bucket.RemoteCount = len(local), len(remote)
+	bucket.LocalChecksum, bucket.RemoteChecksum = Checksum(local), Checksum(remote)
+
+	// The checksum only covers ids and amounts, the drill down also compares the delegator, the level and the timestamp.
+	d := diff(local, remote)
+	bucket.Missing, bucket.Extra, bucket.Mismatched = d.MissingIDs(), d.Extra, d.Mismatched
+
+	if v.options.Repair && bucket.Divergent() {
+		if err := v.repair(ctx, d); err != nil {
+			return bucket, fmt.Errorf("repair: %w", err)
+		}
+		bucket.Repaired = true
+	}
+
+	return bucket, nil
+}
+
+// repair delete the extra and mismatched delegations and store the missing ones and the tzkt version of the mismatched ones,
+// in a single transaction so a failed insert keeps the delegations which were to be replaced.
+func (v *Verifier) repair(ctx context.Context, d difference) error {
+	deleted := append([]int{}, d.Extra...)
+	create := append([]models.Delegations{}, d.Missing...)
+	for _, m := range d.Mismatched {
+		deleted = append(deleted, m.ID)
+		create = append(create, m.Remote)
+	}
+
+	if _, err := v.delegationsRepository.ReplaceByTezosIDs(ctx, deleted, &create); err != nil {
+		return fmt.Errorf("delegationsRepository ReplaceByTezosIDs: %w", err)
+	}
+	return nil
+}
+
+// fetchLocal read the delegations of the bucket stored in the database, ordered by tezos id.
+func (v *Verifier) fetchLocal(ctx context.Context, bucket Bucket) ([]models.Delegations, error) {
+	r := db.DelegationsRange{FromLevel: bucket.FromLevel, BeforeLevel: bucket.ToLevel}
+	if bucket.From != nil && bucket.To != nil {
+		r.From, r.Before = *bucket.From, *bucket.To
+	}
+
+	all := []models.Delegations{}
+	afterTezosID := 0
+	for {
+		page, err := v.delegationsRepository.FindInRange(ctx, r, afterTezosID, v.options.PageSize)
+		if err != nil {
+			return nil, fmt.Errorf("delegationsRepository FindInRange: %w", err)
+		}
+		all = append(all, page...)
+		if len(page) < v.options.PageSize {
+			return all, nil
+		}
+		afterTezosID = page[len(page)-1].TezosID
+	}
+}
+
+// fetchRemote fetch the delegations of the bucket from tzkt, ordered by operation id.
+// Pages are chained on the operations returned by tzkt, the operations skipped by parsing do not end the bucket early.
+func (v *Verifier) fetchRemote(ctx context.Context, bucket Bucket) ([]models.Delegations, error) {
+	options := tezos.TezosDelegationsOption{
+		FromLevel:   bucket.FromLevel,
+		BeforeLevel: bucket.ToLevel,
+		Limit:       v.options.PageSize,
+	}
+	if bucket.From != nil && bucket.To != nil {
+		options.From, options.Before = *bucket.From, *bucket.To
+	}
+
+	all := []models.Delegations{}
+	for {
+		page, last, err := v.delegationsClient.PollPage(ctx, options)
+		if err != nil {
+			return nil, fmt.Errorf("PollPage: %w", err)
+		}
+		if last.ID == 0 {
+			return all, nil
+		}
+		all = append(all, page...)
+		options.IDGreaterThan = last.ID
+	}
+}
+
+// Checksum return the hex SHA-256 of the tezos ids and amounts of delegations, which must be sorted by tezos id.
+func Checksum(delegations []models.Delegations) string {
+	h := sha256.New()
+	for _, d := range delegations {
+		h.Write(strconv.AppendInt(nil, int64(d.TezosID), 10))
+		h.Write([]byte{':'})
+		h.Write(strconv.AppendInt(nil, int64(d.Amount), 10))
+		h.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// difference is the detail of the delegations which differ between the database and tzkt.
+type difference struct {
+	// Missing are the tzkt delegations absent from the database.
+	Missing []models.Delegations
+	// Extra are the tezos ids of the stored delegations absent from tzkt.
+	Extra      []int
+	Mismatched []Mismatch
+}
+
+// MissingIDs return the tezos ids of the missing delegations.
+func (d difference) MissingIDs() []int {
+	ids := make([]int, 0, len(d.Missing))
+	for _, m := range d.Missing {
+		ids = append(ids, m.TezosID)
+	}
+	return ids
+}
+
+// diff merge local and remote, both sorted by tezos id, and return the delegations which differ.
+func diff(local []models.Delegations, remote []models.Delegations) difference {
+	d := difference{}
+	i, j := 0, 0
+	for i < len(local) || j < len(remote) {
+		switch {
+		case j >= len(remote) || (i < len(local) && local[i].TezosID < remote[j].TezosID):
+			d.Extra = append(d.Extra, local[i].TezosID)
+			i++
+		case i >= len(local) || remote[j].TezosID < local[i].TezosID:
+			d.Missing = append(d.Missing, remote[j])
+			j++
+		default:
+			if !sameDelegation(local[i], remote[j]) {
+				d.Mismatched = append(d.Mismatched, Mismatch{ID: local[i].TezosID, Local: local[i], Remote: remote[j]})
+			}
+			i++
+			j++
+		}
+	}
+	return d
+}
+
+// sameDelegation report whether a stored delegation has the values of tzkt, the database id is ignored.
+func sameDelegation(local models.Delegations, remote models.Delegations) bool {
+	return local.Amount == remote.Amount &&
+		local.Delegator == remote.Delegator &&
+		local.Level == remote.Level &&
+		local.Timestamp.Equal(remote.Timestamp)
+}
@@ -0,0 +1,180 @@
+package verify
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/h2non/gock"
+	"github.com/kiln-mid/pkg/backfill"
+	"github.com/kiln-mid/pkg/db"
+	"github.com/kiln-mid/pkg/delegations"
+	"github.com/kiln-mid/pkg/models"
+	"github.com/kiln-mid/pkg/tezos"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeDelegationsRepository struct {
+	db.DelegationsRepository
+	stored  []models.Delegations
+	created []models.Delegations
+	deleted []int
+	err     error
+}
+
+func (f *fakeDelegationsRepository) FindInRange(ctx context.Context, r db.DelegationsRange, afterTezosID int, limit int) ([]models.Delegations, error) {
+	d := []models.Delegations{}
+	for _, delegation := range f.stored {
+		if delegation.TezosID > afterTezosID && len(d) < limit {
+			d = append(d, delegation)
+		}
+	}
+	return d, nil
+}
+
+// ReplaceByTezosIDs is transactional, nothing is deleted when the insert fails with err.
+func (f *fakeDelegationsRepository) ReplaceByTezosIDs(ctx context.Context, tezosIDs []int, d *[]models.Delegations) (int64, error) {
+	if f.err != nil {
+		return 0, f.err
+	}
+	f.deleted = append(f.deleted, tezosIDs...)
+	f.created = append(f.created, *d...)
+	return int64(len(*d)), nil
+}
+
+// mockDivergentBucket mock tzkt with the delegations of a bucket diverging from storedDelegations by a missing,
+// an extra and a mismatched delegation.
+func mockDivergentBucket() {
+	gock.New("https://api.tzkt.io").Get("/v1/operations/delegations").
+		MatchParam("level.ge", "1").
+		MatchParam("level.lt", "100").
+		Reply(200).BodyString(`[
+			{"id": 1, "level": 5, "timestamp": "2024-01-01T10:00:00Z", "sender": {"address": "foo"}, "amount": 10},
+			{"id": 2, "level": 5, "timestamp": "2024-01-01T10:00:00Z", "sender": {"address": "bar"}, "amount": 20},
+			{"id": 4, "level": 6, "timestamp": "2024-01-01T10:00:00Z", "sender": {"address": "baz"}, "amount": 40}
+		]`)
+	gock.New("https://api.tzkt.io").Get("/v1/operations/delegations").
+		MatchParam("level.ge", "1").
+		MatchParam("level.lt", "100").
+		MatchParam("id.gt", "4").
+		Reply(200).BodyString(`[]`)
+}
+
+// storedDelegations return the stored delegations of the bucket mocked by mockDivergentBucket.
+func storedDelegations() []models.Delegations {
+	timestamp := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	return []models.Delegations{
+		{TezosID: 1, Level: 5, Timestamp: timestamp, Delegator: "foo", Amount: 10},
+		{TezosID: 2, Level: 5, Timestamp: timestamp, Delegator: "bar", Amount: 25},
+		{TezosID: 3, Level: 5, Timestamp: timestamp, Delegator: "qux", Amount: 30},
+	}
+}
+
+func TestVerifier_Run(t *testing.T) {
+	defer gock.Off()
+	gock.DisableNetworking()
+	gock.Intercept()
+	mockDivergentBucket()
+
+	delegationsRepository := &fakeDelegationsRepository{stored: storedDelegations()}
+
+	verifier := NewVerifier(delegations.NewClient(tezos.NewClient(), delegationsRepository, nil), delegationsRepository, Options{Repair: true})
+
+	report, err := verifier.Run(context.Background(), backfill.Range{FromLevel: 1, ToLevel: 100})
+	require.NoError(t, err)
+
+	require.Len(t, report.Buckets, 1)
+	bucket := report.Buckets[0]
+	require.Equal(t, 3, bucket.LocalCount)
+	require.Equal(t, 3, bucket.RemoteCount)
+	require.NotEqual(t, bucket.LocalChecksum, bucket.RemoteChecksum)
+	require.Equal(t, []int{4}, bucket.Missing)
+	require.Equal(t, []int{3}, bucket.Extra)
+	require.Len(t, bucket.Mismatched, 1)
+	require.Equal(t, 2, bucket.Mismatched[0].ID)
+	require.Equal(t, 20, bucket.Mismatched[0].Remote.Amount)
+	require.True(t, bucket.Repaired)
+
+	require.Equal(t, 1, report.Divergent)
+	require.False(t, report.Unresolved())
+
+	require.ElementsMatch(t, []int{3, 2}, delegationsRepository.deleted)
+	require.Len(t, delegationsRepository.created, 2)
+	require.True(t, gock.IsDone())
+}
+
+func TestVerifier_RepairFailure(t *testing.T) {
+	defer gock.Off()
+	gock.DisableNetworking()
+	gock.Intercept()
+	mockDivergentBucket()
+
+	delegationsRepository := &fakeDelegationsRepository{stored: storedDelegations(), err: errors.New("insert failed")}
+	verifier := NewVerifier(delegations.NewClient(tezos.NewClient(), delegationsRepository, nil), delegationsRepository, Options{Repair: true})
+
+	_, err := verifier.Run(context.Background(), backfill.Range{FromLevel: 1, ToLevel: 100})
+	require.ErrorContains(t, err, "insert failed")
+
+	// The delegations to replace are kept.
+	require.Empty(t, delegationsRepository.deleted)
+	require.Empty(t, delegationsRepository.created)
+	require.True(t, gock.IsDone())
+}
+
+func TestVerifier_SkippedOperations(t *testing.T) {
+	defer gock.Off()
+	gock.DisableNetworking()
+	gock.Intercept()
+
+	page := func(idGreaterThan string, body string) {
+		request := gock.New("https://api.tzkt.io").Get("/v1/operations/delegations").
+			MatchParam("level.ge", "1").
+			MatchParam("level.lt", "100").
+			MatchParam("limit", "2")
+		if idGreaterThan != "" {
+			request.MatchParam("id.gt", idGreaterThan)
+		}
+		request.Reply(200).BodyString(body)
+	}
+	// Full pages whose operations are partly or all skipped, the bucket goes on after the last operation of each page.
+	page("", `[
+		{"id": 1, "level": 5, "timestamp": "2024-01-01T10:00:00Z", "sender": {"address": "foo"}, "amount": 10},
+		{"id": 5, "level": 5, "timestamp": "2024-01-01T10:00:00Z", "sender": {}, "amount": 50}
+	]`)
+	page("5", `[
+		{"id": 6, "level": 5, "timestamp": "2024-01-01T10:00:00Z", "sender": {}, "amount": 60},
+		{"id": 7, "level": 5, "timestamp": "2024-01-01T10:00:00Z", "sender": {}, "amount": 70}
+	]`)
+	page("7", `[
+		{"id": 8, "level": 6, "timestamp": "2024-01-01T10:00:00Z", "sender": {"address": "bar"}, "amount": 20}
+	]`)
+	page("8", `[]`)
+
+	timestamp := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	delegationsRepository := &fakeDelegationsRepository{stored: []models.Delegations{
+		{TezosID: 1, Level: 5, Timestamp: timestamp, Delegator: "foo", Amount: 10},
+		{TezosID: 8, Level: 6, Timestamp: timestamp, Delegator: "bar", Amount: 20},
+	}}
+	verifier := NewVerifier(delegations.NewClient(tezos.NewClient(), delegationsRepository, nil), delegationsRepository, Options{Repair: true, PageSize: 2})
+
+	report, err := verifier.Run(context.Background(), backfill.Range{FromLevel: 1, ToLevel: 100})
+	require.NoError(t, err)
+	require.True(t, gock.IsDone())
+
+	require.Len(t, report.Buckets, 1)
+	require.Equal(t, 2, report.Buckets[0].RemoteCount)
+	require.Zero(t, report.Divergent)
+	require.Empty(t, delegationsRepository.deleted, "the delegations after a skipped operation must not be deleted")
+	require.Empty(t, delegationsRepository.created)
+}
+
+func TestChecksum(t *testing.T) {
+	a := []models.Delegations{{TezosID: 1, Amount: 10}, {TezosID: 2, Amount: 20}}
+	b := []models.Delegations{{TezosID: 1, Amount: 10, Delegator: "other"}, {TezosID: 2, Amount: 20}}
+	c := []models.Delegations{{TezosID: 1, Amount: 10}, {TezosID: 2, Amount: 21}}
+
+	require.Equal(t, Checksum(a), Checksum(b))
+	require.NotEqual(t, Checksum(a), Checksum(c))
+	require.Equal(t, Checksum(nil), Checksum([]models.Delegations{}))
+}